@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/callgraph/cha"
+	"golang.org/x/tools/go/callgraph/static"
+	"golang.org/x/tools/go/callgraph/vta"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// Call graph construction algorithms, from cheapest and least complete to
+// most precise
+const (
+	callGraphStatic = "static"
+	callGraphCHA    = "cha"
+	callGraphVTA    = "vta"
+)
+
+// ssaProgram returns the SSA form of the workspace together with the
+// packages it was built from. Dependencies are loaded without function
+// bodies, so their functions appear as external declarations.
+func (ws *workspace) ssaProgram(ctx context.Context) (*ssa.Program, []*packages.Package, error) {
+	state, err := ws.load(ctx, ws.root)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ws.ssaMu.Lock()
+	defer ws.ssaMu.Unlock()
+
+	return ws.programFor(state.pkgs, state.generation), state.pkgs, nil
+}
+
+// programFor builds the SSA program for pkgs unless the cached one is
+// already current; the caller must hold ssaMu
+func (ws *workspace) programFor(pkgs []*packages.Package, generation int) *ssa.Program {
+	if (ws.program == nil || ws.ssaGeneration != generation) && len(pkgs) > 0 {
+		prog := ssa.NewProgram(pkgs[0].Fset, ssa.InstantiateGenerics)
+
+		// ssautil.AllPackages skips anything marked IllTyped, which after
+		// stripping bodies is every dependency, so only workspace packages
+		// with errors of their own are left out here, along with the
+		// packages importing them, which SSA cannot build without them
+		skipped := make(map[*packages.Package]bool)
+		packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+			skip := pkg.Types == nil || isWithin(ws.root, pkg.Dir) && len(pkg.Errors) > 0
+			for _, imp := range pkg.Imports {
+				skip = skip || skipped[imp]
+			}
+			if skip {
+				skipped[pkg] = true
+				return
+			}
+			prog.CreatePackage(pkg.Types, pkg.Syntax, pkg.TypesInfo, true)
+		})
+		prog.Build()
+
+		ws.program = prog
+		ws.ssaGeneration = generation
+		ws.callGraphs = make(map[string]*callgraph.Graph)
+	}
+	return ws.program
+}
+
+// callGraph returns the workspace call graph built with algorithm, which
+// is one of static, cha or vta
+func (ws *workspace) callGraph(ctx context.Context, algorithm string) (*callgraph.Graph, []*packages.Package, error) {
+	switch algorithm {
+	case callGraphStatic, callGraphCHA, callGraphVTA:
+	default:
+		return nil, nil, fmt.Errorf("unknown call graph algorithm %q (want static, cha or vta)", algorithm)
+	}
+
+	state, err := ws.load(ctx, ws.root)
+	if err != nil {
+		return nil, nil, err
+	}
+	pkgs := state.pkgs
+
+	ws.ssaMu.Lock()
+	defer ws.ssaMu.Unlock()
+
+	prog := ws.programFor(pkgs, state.generation)
+
+	if graph, ok := ws.callGraphs[algorithm]; ok {
+		return graph, pkgs, nil
+	}
+
+	var graph *callgraph.Graph
+	switch algorithm {
+	case callGraphStatic:
+		graph = static.CallGraph(prog)
+	case callGraphCHA:
+		graph = cha.CallGraph(prog)
+	case callGraphVTA:
+		// VTA refines the dynamic edges of an initial CHA graph
+		initial, ok := ws.callGraphs[callGraphCHA]
+		if !ok {
+			initial = cha.CallGraph(prog)
+			ws.callGraphs[callGraphCHA] = initial
+		}
+		graph = vta.CallGraph(ssautil.AllFunctions(prog), initial)
+	}
+	graph.DeleteSyntheticNodes()
+
+	ws.callGraphs[algorithm] = graph
+	return graph, pkgs, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// methodCancelled is the notification a client sends to cancel a request
+// it made earlier
+const methodCancelled = "notifications/cancelled"
+
+// toolCalls tracks the tool calls in flight, so that a client's
+// cancellation notification can cancel the context of the call it names
+type toolCalls struct {
+	timeout time.Duration // 0 for none
+
+	mu      sync.Mutex
+	cancels map[callKey]context.CancelFunc
+}
+
+// callKey identifies a request by session, since request IDs are only
+// unique within one
+type callKey struct {
+	session string
+	id      string
+}
+
+type requestIDKey struct{}
+
+func newToolCalls(timeout time.Duration) *toolCalls {
+	return &toolCalls{
+		timeout: timeout,
+		cancels: make(map[callKey]context.CancelFunc),
+	}
+}
+
+// middleware gives every tool call a context that ends with the client's
+// cancellation, the call timeout or the transport, and flags results
+// returned after it ended as truncated
+func (c *toolCalls) middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		var cancel context.CancelFunc
+		if c.timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		} else {
+			ctx, cancel = context.WithCancel(ctx)
+		}
+		defer cancel()
+
+		if id, ok := ctx.Value(requestIDKey{}).(mcp.RequestId); ok {
+			key := callKey{session: sessionID(ctx), id: id.String()}
+			c.mu.Lock()
+			c.cancels[key] = cancel
+			c.mu.Unlock()
+			defer func() {
+				c.mu.Lock()
+				delete(c.cancels, key)
+				c.mu.Unlock()
+			}()
+		}
+
+		result, err := next(ctx, request)
+		if err == nil && result != nil && !result.IsError && ctx.Err() != nil {
+			markTruncated(result, ctx.Err())
+		}
+		return result, err
+	}
+}
+
+// cancelled handles notifications/cancelled by cancelling the named call,
+// if it is still running
+func (c *toolCalls) cancelled(ctx context.Context, notification mcp.JSONRPCNotification) {
+	id, ok := notification.Params.AdditionalFields["requestId"]
+	if !ok {
+		return
+	}
+	key := callKey{session: sessionID(ctx), id: mcp.NewRequestId(id).String()}
+
+	c.mu.Lock()
+	cancel, ok := c.cancels[key]
+	c.mu.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+// withRequestID records the JSON-RPC ID of message in ctx, for transports
+// to call before handing the message to the server
+func withRequestID(ctx context.Context, message []byte) context.Context {
+	var envelope struct {
+		ID *mcp.RequestId `json:"id"`
+	}
+	if json.Unmarshal(message, &envelope) != nil || envelope.ID == nil || envelope.ID.IsNil() {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey{}, *envelope.ID)
+}
+
+func sessionID(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
+
+// markTruncated flags a result computed after its context ended as partial,
+// both to the model reading the content and in the result metadata
+func markTruncated(result *mcp.CallToolResult, cause error) {
+	note, _ := json.Marshal(map[string]any{
+		"truncated": true,
+		"reason":    cause.Error(),
+	})
+	result.Content = append(result.Content, mcp.NewTextContent(string(note)))
+
+	if result.Meta == nil {
+		result.Meta = make(map[string]any)
+	}
+	result.Meta["truncated"] = true
+}
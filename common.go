@@ -1,8 +1,8 @@
 package main
 
 import (
+	"context"
 	"go/ast"
-	"go/parser"
 	"go/token"
 	"io/fs"
 	"os"
@@ -30,30 +30,70 @@ func newPosition(pos token.Position) Position {
 
 type fileVisitor func(path string, src []byte, file *ast.File, fset *token.FileSet) error
 
-func walkGoFiles(dir string, visitor fileVisitor) error {
-	fset := token.NewFileSet()
+// walkGoFiles visits every Go file under dir outside vendor directories,
+// reporting files scanned of the total as progress. Cancelling ctx stops
+// the walk early without an error, so that analyzers return what they
+// found so far; the handler layer flags such results as truncated.
+func walkGoFiles(ctx context.Context, dir string, visitor fileVisitor) error {
+	ws, absDir, err := workspaces.forDir(dir)
+	if err != nil {
+		return err
+	}
 
-	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+	// List the files first so that progress has a total
+	var paths []string
+	err = filepath.WalkDir(absDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
+		if ctx.Err() != nil {
+			return filepath.SkipAll
+		}
 
 		if d.IsDir() || !strings.HasSuffix(path, ".go") || strings.Contains(path, "vendor/") {
 			return nil
 		}
 
-		src, err := os.ReadFile(path)
+		paths = append(paths, path)
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	progress := startProgress(ctx, len(paths), "scanning Go files")
+	seen := make(map[string]bool)
+	for i, path := range paths {
+		if ctx.Err() != nil {
+			break
+		}
+		progress(i)
+
+		// Stat rather than lstat, so that edits to a symlink's target
+		// are noticed
+		info, err := os.Stat(path)
 		if err != nil {
-			return nil
+			continue
 		}
 
-		file, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+		cached, err := ws.parsedFile(path, info)
 		if err != nil {
-			return nil
+			continue
 		}
+		seen[path] = true
 
-		return visitor(path, src, file, fset)
-	})
+		if err := visitor(path, cached.src, cached.file, cached.fset); err != nil {
+			return err
+		}
+	}
+
+	// Files not reached before cancellation may still exist
+	if ctx.Err() == nil {
+		progress(len(paths))
+		ws.forget(absDir, seen)
+	}
+	return nil
 }
 
 func exprToString(expr ast.Expr) string {
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configNames are the per-repository configuration files looked up at the
+// module root, in order
+var configNames = []string{".gocp.yaml", ".gocp.yml"}
+
+// gocpConfig is the per-repository configuration read from .gocp.yaml
+type gocpConfig struct {
+	Architecture architectureConfig `yaml:"architecture"`
+	Errors       errorsConfig       `yaml:"errors"`
+}
+
+type architectureConfig struct {
+	Layers []layerConfig `yaml:"layers"`
+	Rules  []importRule  `yaml:"rules"`
+}
+
+// errorsConfig lists calls find_errors may see discarding their error, in
+// the form pkg.Func, (recv).Method or either with a (first argument type)
+type errorsConfig struct {
+	Ignore         []string `yaml:"ignore"`
+	DefaultIgnores *bool    `yaml:"default_ignores"`
+}
+
+// layerConfig assigns packages to a layer. MayImport, when set, lists the
+// only other layers the layer may depend on; MayNotImport lists forbidden ones.
+type layerConfig struct {
+	Name         string   `yaml:"name"`
+	Packages     []string `yaml:"packages"`
+	MayImport    []string `yaml:"may_import"`
+	MayNotImport []string `yaml:"may_not_import"`
+}
+
+// importRule is either a deny rule (packages matching From may not import
+// Deny) or an exclusive rule (only packages matching Only may import Imports)
+type importRule struct {
+	Description string   `yaml:"description"`
+	From        []string `yaml:"from"`
+	Deny        []string `yaml:"deny"`
+	Imports     []string `yaml:"imports"`
+	Only        []string `yaml:"only"`
+}
+
+// loadConfig reads the configuration at path, or the first of configNames
+// found at the module root of dir. A missing file yields an empty config
+// and an empty path.
+func loadConfig(dir, path string) (*gocpConfig, string, error) {
+	if path == "" {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to resolve %s: %w", dir, err)
+		}
+		root := findModuleRoot(absDir)
+		for _, name := range configNames {
+			candidate := filepath.Join(root, name)
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+				break
+			}
+		}
+		if path == "" {
+			return &gocpConfig{}, "", nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read config: %w", err)
+	}
+
+	config := &gocpConfig{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, "", fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, "", fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	return config, path, nil
+}
+
+func (c *gocpConfig) validate() error {
+	layers := make(map[string]bool)
+	for _, layer := range c.Architecture.Layers {
+		if layer.Name == "" {
+			return errors.New("architecture layer without a name")
+		}
+		if layers[layer.Name] {
+			return fmt.Errorf("duplicate architecture layer %q", layer.Name)
+		}
+		layers[layer.Name] = true
+	}
+	for _, layer := range c.Architecture.Layers {
+		for _, other := range append(append([]string{}, layer.MayImport...), layer.MayNotImport...) {
+			if !layers[other] {
+				return fmt.Errorf("layer %q refers to unknown layer %q", layer.Name, other)
+			}
+		}
+	}
+
+	for i, rule := range c.Architecture.Rules {
+		deny := len(rule.Deny) > 0
+		only := len(rule.Imports) > 0 || len(rule.Only) > 0
+		switch {
+		case deny && only:
+			return fmt.Errorf("architecture rule %d mixes deny with imports/only", i+1)
+		case only && (len(rule.Imports) == 0 || len(rule.Only) == 0):
+			return fmt.Errorf("architecture rule %d needs both imports and only", i+1)
+		case !deny && !only:
+			return fmt.Errorf("architecture rule %d has neither deny nor imports/only", i+1)
+		}
+	}
+
+	return nil
+}
+
+// matchPackagePattern reports whether the import path pkg matches pattern,
+// which uses the go command's `...` wildcard and may be written relative to
+// module
+func matchPackagePattern(pattern, pkg, module string) bool {
+	pattern = strings.TrimPrefix(strings.TrimSuffix(pattern, "/"), "./")
+	if pattern == "." || pattern == "" {
+		return pkg == module
+	}
+
+	candidates := []string{pattern}
+	if module != "" {
+		candidates = append(candidates, module+"/"+pattern)
+	}
+
+	for _, candidate := range candidates {
+		expr := regexp.QuoteMeta(candidate)
+		// x/... also matches x itself
+		expr = strings.ReplaceAll(expr, `/\.\.\.`, `(/.*)?`)
+		expr = strings.ReplaceAll(expr, `\.\.\.`, `.*`)
+		if regexp.MustCompile("^" + expr + "$").MatchString(pkg) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAnyPattern(patterns []string, pkg, module string) bool {
+	for _, pattern := range patterns {
+		if matchPackagePattern(pattern, pkg, module) {
+			return true
+		}
+	}
+	return false
+}
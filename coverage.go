@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const coverageTimeout = 5 * time.Minute
+
+// FunctionCoverage is the statement coverage of one function from a
+// coverage profile
+type FunctionCoverage struct {
+	Statements int         `json:"statements"`
+	Covered    int         `json:"covered"`
+	Percentage float64     `json:"percentage"`
+	Uncovered  []LineRange `json:"uncovered,omitempty"`
+}
+
+type LineRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// coverageProfile holds the blocks of a `go test -coverprofile` run keyed by
+// absolute file path
+type coverageProfile struct {
+	blocks      map[string][]coverBlock
+	testsFailed bool
+}
+
+type coverBlock struct {
+	startLine, startCol int
+	endLine, endCol     int
+	statements          int
+	count               int
+}
+
+// collectCoverage runs the tests of every package under dir with a
+// coverage profile and parses it. Failing tests still yield a profile;
+// only a run that produces none is an error.
+func collectCoverage(ctx context.Context, dir string) (*coverageProfile, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+
+	profileFile, err := os.CreateTemp("", "gocp-cover-*.out")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create coverage profile: %w", err)
+	}
+	profileFile.Close()
+	defer os.Remove(profileFile.Name())
+
+	ctx, cancel := context.WithTimeout(ctx, coverageTimeout)
+	defer cancel()
+
+	cmd := goCommand(ctx, absDir, "test", "-covermode=count", "-coverprofile="+profileFile.Name(), "./...")
+
+	stdout, stderr, exitCode, err := runCommand(cmd)
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("go test -coverprofile: %s", interruption(ctx))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to run go test: %w", err)
+	}
+
+	profile, err := parseCoverProfile(profileFile.Name(), packageDirs(ctx, absDir))
+	if err != nil || len(profile.blocks) == 0 && exitCode != 0 {
+		// A panicking test exits before the profile is written
+		return nil, fmt.Errorf("go test -coverprofile produced no profile: %s", strings.TrimSpace(stderr+"\n"+lastLines(stdout, 20)))
+	}
+	profile.testsFailed = exitCode != 0
+
+	return profile, nil
+}
+
+// packageDirs maps the import path of each package under dir to its
+// directory, for resolving the file names in a coverage profile
+func packageDirs(ctx context.Context, dir string) map[string]string {
+	dirs := make(map[string]string)
+
+	pkgs, err := loadPackages(ctx, dir)
+	if err != nil {
+		return dirs
+	}
+	for _, pkg := range pkgs {
+		dirs[pkg.PkgPath] = pkg.Dir
+	}
+	return dirs
+}
+
+// parseCoverProfile reads a profile in the `go tool cover` text format,
+// merging blocks reported by more than one package
+func parseCoverProfile(name string, dirs map[string]string) (*coverageProfile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	type blockKey struct {
+		file                string
+		startLine, startCol int
+		endLine, endCol     int
+	}
+	merged := make(map[blockKey]*coverBlock)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+
+		// import/path/file.go:startLine.startCol,endLine.endCol statements count
+		colon := strings.LastIndex(line, ":")
+		if colon < 0 {
+			continue
+		}
+		fields := strings.Fields(line[colon+1:])
+		if len(fields) != 3 {
+			continue
+		}
+
+		var b coverBlock
+		if _, err := fmt.Sscanf(fields[0], "%d.%d,%d.%d", &b.startLine, &b.startCol, &b.endLine, &b.endCol); err != nil {
+			continue
+		}
+		b.statements, _ = strconv.Atoi(fields[1])
+		b.count, _ = strconv.Atoi(fields[2])
+
+		file := line[:colon]
+		if pkgDir, ok := dirs[path.Dir(file)]; ok {
+			file = filepath.Join(pkgDir, path.Base(file))
+		}
+
+		key := blockKey{file, b.startLine, b.startCol, b.endLine, b.endCol}
+		if existing, ok := merged[key]; ok {
+			existing.count += b.count
+			continue
+		}
+		merged[key] = &b
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	profile := &coverageProfile{blocks: make(map[string][]coverBlock)}
+	for key, b := range merged {
+		profile.blocks[key.file] = append(profile.blocks[key.file], *b)
+	}
+	for _, blocks := range profile.blocks {
+		sort.Slice(blocks, func(i, j int) bool {
+			if blocks[i].startLine != blocks[j].startLine {
+				return blocks[i].startLine < blocks[j].startLine
+			}
+			return blocks[i].startCol < blocks[j].startCol
+		})
+	}
+
+	return profile, nil
+}
+
+// function returns the coverage of the blocks inside fn, or nil when the
+// profile has no data for its file
+func (p *coverageProfile) function(fset *token.FileSet, fn *ast.FuncDecl) *FunctionCoverage {
+	start := fset.Position(fn.Pos())
+	end := fset.Position(fn.End())
+
+	blocks, ok := p.blocks[start.Filename]
+	if !ok {
+		return nil
+	}
+
+	cov := &FunctionCoverage{}
+	for _, b := range blocks {
+		if !positionBefore(start.Line, start.Column, b.startLine, b.startCol) || !positionBefore(b.endLine, b.endCol, end.Line, end.Column) {
+			continue
+		}
+		cov.Statements += b.statements
+		if b.count > 0 {
+			cov.Covered += b.statements
+			continue
+		}
+		if b.statements == 0 {
+			continue
+		}
+
+		// Merge with the previous uncovered range when they touch
+		if n := len(cov.Uncovered); n > 0 && b.startLine <= cov.Uncovered[n-1].End+1 {
+			cov.Uncovered[n-1].End = max(cov.Uncovered[n-1].End, b.endLine)
+		} else {
+			cov.Uncovered = append(cov.Uncovered, LineRange{Start: b.startLine, End: b.endLine})
+		}
+	}
+
+	if cov.Statements > 0 {
+		cov.Percentage = float64(cov.Covered) / float64(cov.Statements) * 100
+	}
+	return cov
+}
+
+func positionBefore(line1, col1, line2, col2 int) bool {
+	return line1 < line2 || line1 == line2 && col1 <= col2
+}
+
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseCoverProfile(t *testing.T) {
+	profile := `mode: count
+example.com/m/a/a.go:3.14,5.2 1 2
+example.com/m/a/a.go:7.14,9.2 1 0
+example.com/m/a/a.go:3.14,5.2 1 3
+example.com/m/b/b.go:1.1,2.2 2 1
+example.com/m/unknown/u.go:1.1,1.9 1 1
+
+not a block
+example.com/m/a/a.go:bad 1 1
+example.com/m/a/a.go:1.1,1.2 1
+`
+	name := filepath.Join(t.TempDir(), "cover.out")
+	if err := os.WriteFile(name, []byte(profile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dirs := map[string]string{
+		"example.com/m/a": "/src/m/a",
+		"example.com/m/b": "/src/m/b",
+	}
+
+	got, err := parseCoverProfile(name, dirs)
+	if err != nil {
+		t.Fatalf("parseCoverProfile() error = %v", err)
+	}
+
+	want := map[string][]coverBlock{
+		// The block reported twice is merged with its counts summed
+		"/src/m/a/a.go": {
+			{startLine: 3, startCol: 14, endLine: 5, endCol: 2, statements: 1, count: 5},
+			{startLine: 7, startCol: 14, endLine: 9, endCol: 2, statements: 1, count: 0},
+		},
+		"/src/m/b/b.go": {
+			{startLine: 1, startCol: 1, endLine: 2, endCol: 2, statements: 2, count: 1},
+		},
+		// Files of packages with no known directory keep their import path
+		"example.com/m/unknown/u.go": {
+			{startLine: 1, startCol: 1, endLine: 1, endCol: 9, statements: 1, count: 1},
+		},
+	}
+	if !reflect.DeepEqual(got.blocks, want) {
+		t.Errorf("parseCoverProfile() blocks = %+v, want %+v", got.blocks, want)
+	}
+}
+
+func TestParseCoverProfileMissing(t *testing.T) {
+	if _, err := parseCoverProfile(filepath.Join(t.TempDir(), "none.out"), nil); err == nil {
+		t.Errorf("parseCoverProfile() of a missing file succeeded")
+	}
+}
+
+func TestFunctionCoverage(t *testing.T) {
+	src := `package a
+
+func F(x int) int {
+	if x > 0 {
+		return 1
+	}
+	if x < 0 {
+		return -1
+	}
+	for i := 0; i < x; i++ {
+		x--
+	}
+	return 0
+}
+
+func G() {}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "/src/a.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	funcs := make(map[string]*ast.FuncDecl)
+	for _, decl := range file.Decls {
+		fn := decl.(*ast.FuncDecl)
+		funcs[fn.Name.Name] = fn
+	}
+
+	profile := &coverageProfile{blocks: map[string][]coverBlock{
+		"/src/a.go": {
+			{startLine: 3, startCol: 19, endLine: 4, endCol: 11, statements: 1, count: 4},
+			{startLine: 4, startCol: 11, endLine: 6, endCol: 3, statements: 1, count: 4},
+			{startLine: 7, startCol: 2, endLine: 7, endCol: 11, statements: 1, count: 0},
+			{startLine: 7, startCol: 11, endLine: 9, endCol: 3, statements: 1, count: 0},
+			{startLine: 10, startCol: 2, endLine: 10, endCol: 28, statements: 1, count: 0},
+			{startLine: 12, startCol: 2, endLine: 12, endCol: 10, statements: 1, count: 0},
+			// G's empty body
+			{startLine: 16, startCol: 10, endLine: 16, endCol: 11, statements: 0, count: 0},
+		},
+	}}
+
+	got := profile.function(fset, funcs["F"])
+	want := &FunctionCoverage{
+		Statements: 6,
+		Covered:    2,
+		Percentage: float64(2) / 6 * 100,
+		// Adjacent uncovered blocks merge into one range
+		Uncovered: []LineRange{{Start: 7, End: 10}, {Start: 12, End: 12}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("function(F) = %+v, want %+v", got, want)
+	}
+
+	if got := profile.function(fset, funcs["G"]); !reflect.DeepEqual(got, &FunctionCoverage{}) {
+		t.Errorf("function(G) = %+v, want no statements", got)
+	}
+
+	other := token.NewFileSet()
+	otherFile, err := parser.ParseFile(other, "/src/b.go", "package a\n\nfunc H() {}\n", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := profile.function(other, otherFile.Decls[0].(*ast.FuncDecl)); got != nil {
+		t.Errorf("function(H) = %+v, want nil for a file without data", got)
+	}
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const diffContext = 3
+
+// maxDiffCells bounds the LCS table; larger changes degrade to a single
+// delete-all/insert-all hunk over the differing region
+const maxDiffCells = 4 << 20
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// unifiedDiff renders the changes from old to new as a unified diff, or ""
+// when the contents are identical
+func unifiedDiff(path string, old, new string) string {
+	if old == new {
+		return ""
+	}
+
+	ops := diffLines(splitLines(old), splitLines(new))
+
+	var out strings.Builder
+	out.WriteString("--- " + path + "\n")
+	out.WriteString("+++ " + path + "\n")
+
+	for _, h := range diffHunks(ops) {
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(h.oldStart, h.oldLen), hunkRange(h.newStart, h.newLen))
+		for _, op := range ops[h.from:h.to] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+
+	return out.String()
+}
+
+// splitLines splits s into lines, each keeping its trailing newline
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	am := a[prefix : len(a)-suffix]
+	bm := b[prefix : len(b)-suffix]
+
+	if len(am)*len(bm) > maxDiffCells {
+		for _, line := range am {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range bm {
+			ops = append(ops, diffOp{'+', line})
+		}
+	} else {
+		ops = append(ops, lcsDiff(am, bm)...)
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	return ops
+}
+
+func lcsDiff(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	table := make([][]int, n+1)
+	for i := range table {
+		table[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				table[i][j] = table[i+1][j+1] + 1
+			} else {
+				table[i][j] = max(table[i+1][j], table[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case table[i+1][j] >= table[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+
+	return ops
+}
+
+type diffHunk struct {
+	from, to         int
+	oldStart, oldLen int
+	newStart, newLen int
+}
+
+func diffHunks(ops []diffOp) []diffHunk {
+	var hunks []diffHunk
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		from := max(i-diffContext, 0)
+		to := i
+		for to < len(ops) {
+			if ops[to].kind != ' ' {
+				to++
+				continue
+			}
+			// Extend through unchanged runs short enough to join the next change
+			run := to
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run < len(ops) && run-to <= 2*diffContext {
+				to = run
+				continue
+			}
+			to = min(to+diffContext, len(ops))
+			break
+		}
+
+		h := diffHunk{from: from, to: to}
+		oldLine, newLine := 1, 1
+		for _, op := range ops[:from] {
+			if op.kind != '+' {
+				oldLine++
+			}
+			if op.kind != '-' {
+				newLine++
+			}
+		}
+		h.oldStart, h.newStart = oldLine, newLine
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				h.oldLen++
+			}
+			if op.kind != '-' {
+				h.newLen++
+			}
+		}
+		hunks = append(hunks, h)
+		i = to
+	}
+
+	return hunks
+}
+
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, length)
+}
+
+// textEdit replaces src[start:end] with text
+type textEdit struct {
+	start int
+	end   int
+	text  string
+}
+
+// applyEdits applies non-overlapping edits to src
+func applyEdits(src []byte, edits []textEdit) ([]byte, error) {
+	sorted := append([]textEdit(nil), edits...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].start < sorted[j].start
+	})
+
+	var out []byte
+	last := 0
+	for _, edit := range sorted {
+		if edit.start < last || edit.end < edit.start || edit.end > len(src) {
+			return nil, fmt.Errorf("invalid or overlapping edit at byte %d", edit.start)
+		}
+		out = append(out, src[last:edit.start]...)
+		out = append(out, edit.text...)
+		last = edit.end
+	}
+	out = append(out, src[last:]...)
+
+	return out, nil
+}
+
+// devNull marks the missing side of a created or deleted file in a patch
+const devNull = "/dev/null"
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// filePatch is the part of a unified diff that changes one file
+type filePatch struct {
+	oldPath string
+	newPath string
+	hunks   []patchHunk
+}
+
+// patchHunk holds the lines a hunk expects and produces, each keeping its
+// trailing newline as splitLines does
+type patchHunk struct {
+	oldStart, oldLen int
+	newStart, newLen int
+	old, new         []string
+}
+
+// parsePatch reads a unified diff, as produced by unifiedDiff, diff -u or
+// git diff, into per-file patches
+func parsePatch(patch string) ([]filePatch, error) {
+	var files []filePatch
+	var hunk *patchHunk
+	oldLeft, newLeft := 0, 0
+	// Lists the previous hunk line went to, for "\ No newline at end of file"
+	var lastLists []*[]string
+
+	finishHunk := func() error {
+		if hunk == nil {
+			return nil
+		}
+		if oldLeft != 0 || newLeft != 0 {
+			return fmt.Errorf("hunk @@ -%d +%d @@ is truncated", hunk.oldStart, hunk.newStart)
+		}
+		file := &files[len(files)-1]
+		file.hunks = append(file.hunks, *hunk)
+		hunk = nil
+		return nil
+	}
+
+	for i, line := range splitLines(patch) {
+		text := strings.TrimRight(line, "\r\n")
+
+		if strings.HasPrefix(text, "\\") {
+			for _, list := range lastLists {
+				if n := len(*list); n > 0 {
+					(*list)[n-1] = strings.TrimSuffix((*list)[n-1], "\n")
+				}
+			}
+			continue
+		}
+
+		if hunk != nil && (oldLeft > 0 || newLeft > 0) {
+			kind, body := byte(' '), ""
+			if text != "" {
+				kind, body = line[0], line[1:]
+			} else {
+				// Editors sometimes strip the space of an empty context line
+				body = strings.TrimPrefix(line, " ")
+			}
+			switch kind {
+			case ' ':
+				hunk.old = append(hunk.old, body)
+				hunk.new = append(hunk.new, body)
+				lastLists = []*[]string{&hunk.old, &hunk.new}
+				oldLeft--
+				newLeft--
+			case '-':
+				hunk.old = append(hunk.old, body)
+				lastLists = []*[]string{&hunk.old}
+				oldLeft--
+			case '+':
+				hunk.new = append(hunk.new, body)
+				lastLists = []*[]string{&hunk.new}
+				newLeft--
+			default:
+				return nil, fmt.Errorf("line %d: unexpected %q in hunk", i+1, text)
+			}
+			if oldLeft < 0 || newLeft < 0 {
+				return nil, fmt.Errorf("line %d: hunk longer than its header", i+1)
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(text, "--- "):
+			if err := finishHunk(); err != nil {
+				return nil, err
+			}
+			files = append(files, filePatch{oldPath: patchPath(text[4:])})
+
+		case strings.HasPrefix(text, "+++ "):
+			if len(files) == 0 || files[len(files)-1].newPath != "" {
+				return nil, fmt.Errorf("line %d: +++ without ---", i+1)
+			}
+			files[len(files)-1].newPath = patchPath(text[4:])
+
+		case strings.HasPrefix(text, "@@"):
+			if err := finishHunk(); err != nil {
+				return nil, err
+			}
+			m := hunkHeader.FindStringSubmatch(text)
+			if m == nil || len(files) == 0 || files[len(files)-1].newPath == "" {
+				return nil, fmt.Errorf("line %d: unexpected hunk header %q", i+1, text)
+			}
+			hunk = &patchHunk{
+				oldStart: atoiDefault(m[1], 0),
+				oldLen:   atoiDefault(m[2], 1),
+				newStart: atoiDefault(m[3], 0),
+				newLen:   atoiDefault(m[4], 1),
+			}
+			oldLeft, newLeft = hunk.oldLen, hunk.newLen
+		}
+		// Anything else (diff --git, index, file mode lines) is a preamble
+	}
+
+	if err := finishHunk(); err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no file headers found in patch")
+	}
+	return files, nil
+}
+
+// patchPath strips the timestamp diff -u appends to header paths
+func patchPath(header string) string {
+	path, _, _ := strings.Cut(header, "\t")
+	return strings.TrimSpace(path)
+}
+
+func atoiDefault(s string, def int) int {
+	if s == "" {
+		return def
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// applyHunks applies hunks to content in order. Each hunk must match
+// exactly, at its stated line or, if the file has shifted, at the nearest
+// line after the previous hunk; the offsets from the stated lines are
+// returned.
+func applyHunks(content string, hunks []patchHunk) (string, []int, error) {
+	lines := splitLines(content)
+	var out []string
+	var offsets []int
+	next := 0
+
+	for _, h := range hunks {
+		want := h.oldStart - 1
+		if h.oldLen == 0 {
+			// Pure insertions name the line they follow
+			want = h.oldStart
+		}
+
+		at := locateHunk(lines, h.old, want, next)
+		if at < 0 {
+			return "", nil, fmt.Errorf("hunk @@ -%s +%s @@ does not apply", hunkRange(h.oldStart, h.oldLen), hunkRange(h.newStart, h.newLen))
+		}
+
+		out = append(out, lines[next:at]...)
+		out = append(out, h.new...)
+		offsets = append(offsets, at-want)
+		next = at + len(h.old)
+	}
+	out = append(out, lines[next:]...)
+
+	return strings.Join(out, ""), offsets, nil
+}
+
+// locateHunk returns the line index at or after from where old matches,
+// nearest to want, or -1
+func locateHunk(lines, old []string, want, from int) int {
+	matches := func(at int) bool {
+		if at < from || at+len(old) > len(lines) {
+			return false
+		}
+		for i, line := range old {
+			if lines[at+i] != line {
+				return false
+			}
+		}
+		return true
+	}
+
+	for distance := 0; want-distance >= from || want+distance <= len(lines); distance++ {
+		if matches(want - distance) {
+			return want - distance
+		}
+		if matches(want + distance) {
+			return want + distance
+		}
+	}
+	return -1
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{
+			name: "identical",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+			want: "",
+		},
+		{
+			name: "changed line",
+			old:  "a\nb\nc\n",
+			new:  "a\nB\nc\n",
+			want: "--- f.go\n+++ f.go\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name: "created from empty",
+			old:  "",
+			new:  "x\ny\n",
+			want: "--- f.go\n+++ f.go\n@@ -0,0 +1,2 @@\n+x\n+y\n",
+		},
+		{
+			name: "emptied",
+			old:  "x\n",
+			new:  "",
+			want: "--- f.go\n+++ f.go\n@@ -1 +0,0 @@\n-x\n",
+		},
+		{
+			name: "no newline at end of file",
+			old:  "a\nb",
+			new:  "a\nc",
+			want: "--- f.go\n+++ f.go\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+		{
+			name: "newline added at end of file",
+			old:  "a",
+			new:  "a\n",
+			want: "--- f.go\n+++ f.go\n@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+a\n",
+		},
+		{
+			name: "distant changes in separate hunks",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			new:  "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+			want: "--- f.go\n+++ f.go\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff("f.go", tt.old, tt.new); got != tt.want {
+				t.Errorf("unifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   string
+		want    []filePatch
+		wantErr string
+	}{
+		{
+			name:  "single hunk",
+			patch: "--- f.go\n+++ f.go\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			want: []filePatch{{
+				oldPath: "f.go",
+				newPath: "f.go",
+				hunks: []patchHunk{{
+					oldStart: 1, oldLen: 3, newStart: 1, newLen: 3,
+					old: []string{"a\n", "b\n", "c\n"},
+					new: []string{"a\n", "B\n", "c\n"},
+				}},
+			}},
+		},
+		{
+			name:  "git preamble and timestamps",
+			patch: "diff --git a/f.go b/f.go\nindex 1234567..89abcde 100644\n--- a/f.go\t2024-01-01 00:00:00\n+++ b/f.go\t2024-01-02 00:00:00\n@@ -1 +1 @@\n-x\n+y\n",
+			want: []filePatch{{
+				oldPath: "a/f.go",
+				newPath: "b/f.go",
+				hunks: []patchHunk{{
+					oldStart: 1, oldLen: 1, newStart: 1, newLen: 1,
+					old: []string{"x\n"},
+					new: []string{"y\n"},
+				}},
+			}},
+		},
+		{
+			name:  "no newline at end of file",
+			patch: "--- f.go\n+++ f.go\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+			want: []filePatch{{
+				oldPath: "f.go",
+				newPath: "f.go",
+				hunks: []patchHunk{{
+					oldStart: 1, oldLen: 2, newStart: 1, newLen: 2,
+					old: []string{"a\n", "b"},
+					new: []string{"a\n", "c"},
+				}},
+			}},
+		},
+		{
+			name:  "created file",
+			patch: "--- /dev/null\n+++ new.go\n@@ -0,0 +1,2 @@\n+x\n+y\n",
+			want: []filePatch{{
+				oldPath: devNull,
+				newPath: "new.go",
+				hunks: []patchHunk{{
+					oldStart: 0, oldLen: 0, newStart: 1, newLen: 2,
+					new: []string{"x\n", "y\n"},
+				}},
+			}},
+		},
+		{
+			name:  "several files",
+			patch: "--- a.go\n+++ a.go\n@@ -1 +1 @@\n-a\n+A\n--- b.go\n+++ b.go\n@@ -2 +2 @@\n-b\n+B\n",
+			want: []filePatch{
+				{oldPath: "a.go", newPath: "a.go", hunks: []patchHunk{{oldStart: 1, oldLen: 1, newStart: 1, newLen: 1, old: []string{"a\n"}, new: []string{"A\n"}}}},
+				{oldPath: "b.go", newPath: "b.go", hunks: []patchHunk{{oldStart: 2, oldLen: 1, newStart: 2, newLen: 1, old: []string{"b\n"}, new: []string{"B\n"}}}},
+			},
+		},
+		{
+			name:  "empty context line without its space",
+			patch: "--- f.go\n+++ f.go\n@@ -1,3 +1,3 @@\n a\n\n-b\n+B\n",
+			want: []filePatch{{
+				oldPath: "f.go",
+				newPath: "f.go",
+				hunks: []patchHunk{{
+					oldStart: 1, oldLen: 3, newStart: 1, newLen: 3,
+					old: []string{"a\n", "\n", "b\n"},
+					new: []string{"a\n", "\n", "B\n"},
+				}},
+			}},
+		},
+		{
+			name:    "truncated hunk",
+			patch:   "--- f.go\n+++ f.go\n@@ -1,3 +1,3 @@\n a\n-b\n",
+			wantErr: "is truncated",
+		},
+		{
+			name:    "hunk longer than its header",
+			patch:   "--- f.go\n+++ f.go\n@@ -1 +1,2 @@\n-a\n-b\n+c\n",
+			wantErr: "hunk longer than its header",
+		},
+		{
+			name:    "unexpected line in hunk",
+			patch:   "--- f.go\n+++ f.go\n@@ -1,2 +1,2 @@\n a\n*b\n",
+			wantErr: "unexpected",
+		},
+		{
+			name:    "hunk before file headers",
+			patch:   "@@ -1 +1 @@\n-a\n+b\n",
+			wantErr: "unexpected hunk header",
+		},
+		{
+			name:    "+++ without ---",
+			patch:   "+++ f.go\n@@ -1 +1 @@\n-a\n+b\n",
+			wantErr: "+++ without ---",
+		},
+		{
+			name:    "empty",
+			patch:   "",
+			wantErr: "no file headers",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePatch(tt.patch)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parsePatch() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePatch() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePatch() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyHunks(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		patch       string
+		want        string
+		wantOffsets []int
+		wantErr     bool
+	}{
+		{
+			name:        "at stated line",
+			content:     "a\nb\nc\n",
+			patch:       "--- f.go\n+++ f.go\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			want:        "a\nB\nc\n",
+			wantOffsets: []int{0},
+		},
+		{
+			name:        "offset by lines added above",
+			content:     "x\ny\na\nb\nc\n",
+			patch:       "--- f.go\n+++ f.go\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			want:        "x\ny\na\nB\nc\n",
+			wantOffsets: []int{2},
+		},
+		{
+			name:        "offset by lines removed above",
+			content:     "c\nd\ne\n",
+			patch:       "--- f.go\n+++ f.go\n@@ -3,2 +3,2 @@\n c\n-d\n+D\n",
+			want:        "c\nD\ne\n",
+			wantOffsets: []int{-2},
+		},
+		{
+			name:        "later hunk follows earlier one",
+			content:     "a\nb\na\nb\n",
+			patch:       "--- f.go\n+++ f.go\n@@ -1,2 +1,2 @@\n a\n-b\n+B\n@@ -3,2 +3,2 @@\n a\n-b\n+C\n",
+			want:        "a\nB\na\nC\n",
+			wantOffsets: []int{0, 0},
+		},
+		{
+			name:        "pure insertion",
+			content:     "a\nc\n",
+			patch:       "--- f.go\n+++ f.go\n@@ -1,0 +2 @@\n+b\n",
+			want:        "a\nb\nc\n",
+			wantOffsets: []int{0},
+		},
+		{
+			name:    "context mismatch",
+			content: "a\nX\nc\n",
+			patch:   "--- f.go\n+++ f.go\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			wantErr: true,
+		},
+		{
+			name:    "hunk past end of file",
+			content: "a\n",
+			patch:   "--- f.go\n+++ f.go\n@@ -2,2 +2,2 @@\n b\n-c\n+C\n",
+			wantErr: true,
+		},
+		{
+			name:        "empty file created",
+			content:     "",
+			patch:       "--- /dev/null\n+++ f.go\n@@ -0,0 +1,2 @@\n+x\n+y\n",
+			want:        "x\ny\n",
+			wantOffsets: []int{0},
+		},
+		{
+			name:        "file emptied",
+			content:     "x\n",
+			patch:       "--- f.go\n+++ f.go\n@@ -1 +0,0 @@\n-x\n",
+			want:        "",
+			wantOffsets: []int{0},
+		},
+		{
+			name:        "no newline at end of file",
+			content:     "a\nb",
+			patch:       "--- f.go\n+++ f.go\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+			want:        "a\nc",
+			wantOffsets: []int{0},
+		},
+		{
+			name:    "missing newline does not match one present",
+			content: "a\nb\n",
+			patch:   "--- f.go\n+++ f.go\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := parsePatch(tt.patch)
+			if err != nil {
+				t.Fatalf("parsePatch() error = %v", err)
+			}
+
+			got, offsets, err := applyHunks(tt.content, files[0].hunks)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("applyHunks() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyHunks() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("applyHunks() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(offsets, tt.wantOffsets) {
+				t.Errorf("applyHunks() offsets = %v, want %v", offsets, tt.wantOffsets)
+			}
+		})
+	}
+}
+
+// Diffs from unifiedDiff must apply back to the content they were made from
+func TestUnifiedDiffRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+	}{
+		{"changed line", "a\nb\nc\n", "a\nB\nc\n"},
+		{"created from empty", "", "x\ny\n"},
+		{"emptied", "x\ny\n", ""},
+		{"no newline at end of file", "a\nb", "a\nb\nc"},
+		{"newline removed at end of file", "a\nb\n", "a\nb"},
+		{"several hunks", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n", "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\neleven\n12\n13\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := parsePatch(unifiedDiff("f.go", tt.old, tt.new))
+			if err != nil {
+				t.Fatalf("parsePatch() error = %v", err)
+			}
+			got, _, err := applyHunks(tt.old, files[0].hunks)
+			if err != nil {
+				t.Fatalf("applyHunks() error = %v", err)
+			}
+			if got != tt.new {
+				t.Errorf("applying the diff gave %q, want %q", got, tt.new)
+			}
+		})
+	}
+}
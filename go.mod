@@ -4,10 +4,16 @@ go 1.23.2
 
 toolchain go1.24.4
 
-require github.com/mark3labs/mcp-go v0.32.0
+require (
+	github.com/mark3labs/mcp-go v0.32.0
+	golang.org/x/mod v0.25.0
+	golang.org/x/tools v0.34.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/spf13/cast v1.7.1 // indirect
 	github.com/yosida95/uritemplate/v3 v3.0.2 // indirect
+	golang.org/x/sync v0.15.0 // indirect
 )
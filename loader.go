@@ -0,0 +1,498 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+)
+
+const loadMode = packages.NeedName |
+	packages.NeedFiles |
+	packages.NeedCompiledGoFiles |
+	packages.NeedImports |
+	packages.NeedDeps |
+	packages.NeedTypes |
+	packages.NeedTypesSizes |
+	packages.NeedSyntax |
+	packages.NeedTypesInfo |
+	packages.NeedModule |
+	packages.NeedForTest
+
+type typedFileVisitor func(path string, src []byte, file *ast.File, pkg *packages.Package) error
+
+// loadPackages returns the type-checked packages under dir, including test
+// variants, served from the workspace index when nothing has changed
+func loadPackages(ctx context.Context, dir string) ([]*packages.Package, error) {
+	state, absDir, err := loadTyped(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	return packagesUnder(state.pkgs, absDir), nil
+}
+
+// loadTyped returns the typed state of the workspace containing dir, up to
+// date for the packages under dir
+func loadTyped(ctx context.Context, dir string) (*typedState, string, error) {
+	ws, absDir, err := workspaces.forDir(dir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var state *typedState
+	err = await(ctx, func() (err error) {
+		state, err = ws.load(ctx, absDir)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return state, absDir, nil
+}
+
+// packagesUnder returns the packages of pkgs whose directory is within dir
+func packagesUnder(pkgs []*packages.Package, dir string) []*packages.Package {
+	var result []*packages.Package
+	for _, pkg := range pkgs {
+		if isWithin(dir, pkg.Dir) {
+			result = append(result, pkg)
+		}
+	}
+	return result
+}
+
+// loadModulePackages returns every type-checked package of the workspace
+// containing dir, for analyses that must see all uses regardless of dir
+func loadModulePackages(ctx context.Context, dir string) ([]*packages.Package, string, error) {
+	state, root, err := loadModule(ctx, dir)
+	if err != nil {
+		return nil, "", err
+	}
+	return state.pkgs, root, nil
+}
+
+// loadModule returns the typed state of the whole workspace containing dir
+// and its root
+func loadModule(ctx context.Context, dir string) (*typedState, string, error) {
+	ws, _, err := workspaces.forDir(dir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var state *typedState
+	err = await(ctx, func() (err error) {
+		state, err = ws.load(ctx, ws.root)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return state, ws.root, nil
+}
+
+// loadWorkspace type-checks every package under root from source, reading
+// file contents from overlay where present. It also returns the source of
+// every file under root it parsed.
+func loadWorkspace(ctx context.Context, root string, overlay map[string][]byte) ([]*packages.Package, map[string][]byte, error) {
+	sources := make(map[string][]byte)
+	cfg := &packages.Config{
+		Context:   ctx,
+		Mode:      loadMode,
+		Dir:       root,
+		Tests:     true,
+		Fset:      token.NewFileSet(),
+		ParseFile: workspaceParser(root, sources),
+		Overlay:   overlay,
+	}
+
+	pkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load packages: %w", err)
+	}
+
+	return analysisPackages(pkgs), sources, nil
+}
+
+// workspaceParser parses dependencies outside root without function bodies,
+// which keeps source type-checking of the standard library and module cache
+// cheap while still exposing their declarations and doc comments. The
+// sources of files under root are kept in sources.
+func workspaceParser(root string, sources map[string][]byte) func(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
+	var mu sync.Mutex
+	return func(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
+		file, err := parser.ParseFile(fset, filename, src, parser.ParseComments|parser.SkipObjectResolution)
+		if file == nil {
+			return file, err
+		}
+		if isWithin(root, filename) {
+			mu.Lock()
+			sources[filename] = src
+			mu.Unlock()
+			return file, err
+		}
+		for _, decl := range file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok {
+				fn.Body = nil
+			}
+		}
+		return file, err
+	}
+}
+
+func isWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// analysisPackages drops generated test mains and packages superseded by
+// their in-package test variant, so that every file is seen exactly once
+func analysisPackages(pkgs []*packages.Package) []*packages.Package {
+	hasVariant := make(map[string]bool)
+	for _, pkg := range pkgs {
+		if pkg.ForTest != "" && pkg.PkgPath == pkg.ForTest {
+			hasVariant[pkg.PkgPath] = true
+		}
+	}
+
+	var result []*packages.Package
+	for _, pkg := range pkgs {
+		if strings.HasSuffix(pkg.ID, ".test") {
+			continue
+		}
+		if pkg.ForTest == "" && hasVariant[pkg.PkgPath] {
+			continue
+		}
+		if pkg.TypesInfo == nil {
+			continue
+		}
+		result = append(result, pkg)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	return result
+}
+
+// walkTypedFiles visits every type-checked Go file under dir once. Like
+// walkGoFiles, it reports progress and cancelling ctx stops the walk early
+// without an error.
+func walkTypedFiles(ctx context.Context, dir string, visitor typedFileVisitor) error {
+	state, absDir, err := loadTyped(ctx, dir)
+	if err != nil {
+		return err
+	}
+	pkgs := packagesUnder(state.pkgs, absDir)
+
+	total := 0
+	for _, pkg := range pkgs {
+		total += len(pkg.Syntax)
+	}
+	progress := startProgress(ctx, total, "scanning type-checked files")
+
+	seen := make(map[string]bool)
+	done := 0
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Syntax {
+			done++
+			path := pkg.Fset.File(file.Pos()).Name()
+			if seen[path] || !strings.HasSuffix(path, ".go") {
+				continue
+			}
+			if ctx.Err() != nil {
+				return nil
+			}
+			seen[path] = true
+			progress(done)
+
+			// The source the syntax was parsed from, not what is on disk
+			// now; only files generated outside the workspace, such as
+			// by cgo, are read
+			src, ok := state.sources[path]
+			if !ok {
+				if src, err = os.ReadFile(path); err != nil {
+					return fmt.Errorf("failed to read %s: %w", path, err)
+				}
+			}
+
+			if err := visitor(path, src, file, pkg); err != nil {
+				return err
+			}
+		}
+	}
+
+	progress(total)
+	return nil
+}
+
+// objectKey identifies an object by its declaring position, which is stable
+// across the test and non-test variants of a package
+func objectKey(fset *token.FileSet, obj types.Object) string {
+	if obj == nil || !obj.Pos().IsValid() {
+		return ""
+	}
+	pos := fset.Position(obj.Pos())
+	return fmt.Sprintf("%s:%d:%d:%s", pos.Filename, pos.Line, pos.Column, obj.Name())
+}
+
+// qualifiedName renders an object as pkg.Name or (pkg.Type).Method
+func qualifiedName(obj types.Object) string {
+	if obj == nil {
+		return ""
+	}
+	if fn, ok := obj.(*types.Func); ok {
+		if recv := fn.Signature().Recv(); recv != nil {
+			return "(" + types.TypeString(recv.Type(), nil) + ")." + fn.Name()
+		}
+	}
+	if obj.Pkg() == nil {
+		return obj.Name()
+	}
+	return obj.Pkg().Path() + "." + obj.Name()
+}
+
+// receiverTypeName returns the name of the named type a method is declared on
+func receiverTypeName(obj types.Object) string {
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return ""
+	}
+	recv := fn.Signature().Recv()
+	if recv == nil {
+		return ""
+	}
+	t := recv.Type()
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	switch named := t.(type) {
+	case *types.Named:
+		return named.Obj().Name()
+	case *types.Alias:
+		return named.Obj().Name()
+	}
+	return ""
+}
+
+// objectMatches reports whether obj is named by symbol, which may be a bare
+// name or qualified by package name, package path and/or receiver type,
+// e.g. "Get", "http.Get", "Client.Do" or "net/http.Client.Do"
+func objectMatches(obj types.Object, symbol string) bool {
+	if obj == nil {
+		return false
+	}
+
+	name := symbol
+	qualifier := ""
+	if idx := strings.LastIndex(symbol, "."); idx >= 0 {
+		qualifier = symbol[:idx]
+		name = symbol[idx+1:]
+	}
+
+	if obj.Name() != name {
+		return false
+	}
+	if qualifier == "" {
+		return true
+	}
+
+	recv := receiverTypeName(obj)
+	if recv != "" && qualifier == recv {
+		return true
+	}
+
+	if obj.Pkg() == nil {
+		return false
+	}
+	pkgName := obj.Pkg().Name()
+	pkgPath := obj.Pkg().Path()
+
+	candidates := []string{pkgName, pkgPath}
+	if recv != "" {
+		candidates = []string{pkgName + "." + recv, pkgPath + "." + recv}
+	}
+	for _, candidate := range candidates {
+		if qualifier == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// identAtPosition finds the identifier covering file:line:column in pkgs
+func identAtPosition(pkgs []*packages.Package, file string, line, column int) (*ast.Ident, *packages.Package, error) {
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve %s: %w", file, err)
+	}
+
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Syntax {
+			tokFile := pkg.Fset.File(f.Pos())
+			if tokFile == nil || tokFile.Name() != absFile {
+				continue
+			}
+			if line < 1 || line > tokFile.LineCount() {
+				return nil, nil, fmt.Errorf("line %d out of range in %s", line, file)
+			}
+			pos := tokFile.LineStart(line) + token.Pos(column-1)
+
+			var found *ast.Ident
+			ast.Inspect(f, func(n ast.Node) bool {
+				if n == nil || found != nil || pos < n.Pos() || pos > n.End() {
+					return false
+				}
+				if ident, ok := n.(*ast.Ident); ok && pos < ident.End() {
+					found = ident
+				}
+				return true
+			})
+			if found == nil {
+				return nil, nil, fmt.Errorf("no identifier at %s:%d:%d", file, line, column)
+			}
+			return found, pkg, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("file %s is not part of any loaded package", file)
+}
+
+// identObject resolves ident, preferring the referenced type for embedded fields
+func identObject(info *types.Info, ident *ast.Ident) types.Object {
+	if obj := info.Uses[ident]; obj != nil {
+		return obj
+	}
+	return info.Defs[ident]
+}
+
+// lookupSymbol resolves a possibly qualified symbol to the package-level
+// objects, methods and struct fields it names in pkgs
+func lookupSymbol(pkgs []*packages.Package, symbol string) []types.Object {
+	var result []types.Object
+	seen := make(map[string]bool)
+
+	add := func(fset *token.FileSet, obj types.Object) {
+		key := objectKey(fset, obj)
+		if key != "" && !seen[key] {
+			seen[key] = true
+			result = append(result, obj)
+		}
+	}
+
+	name := symbol
+	qualifier := ""
+	if idx := strings.LastIndex(symbol, "."); idx >= 0 {
+		qualifier = symbol[:idx]
+		name = symbol[idx+1:]
+	}
+
+	for _, pkg := range pkgs {
+		scope := pkg.Types.Scope()
+		for _, n := range scope.Names() {
+			obj := scope.Lookup(n)
+			if objectMatches(obj, symbol) {
+				add(pkg.Fset, obj)
+			}
+
+			typeName, ok := obj.(*types.TypeName)
+			if !ok || typeName.IsAlias() {
+				continue
+			}
+			named, ok := typeName.Type().(*types.Named)
+			if !ok {
+				continue
+			}
+
+			for i := 0; i < named.NumMethods(); i++ {
+				if objectMatches(named.Method(i), symbol) {
+					add(pkg.Fset, named.Method(i))
+				}
+			}
+
+			owners := []string{typeName.Name(), pkg.Types.Name() + "." + typeName.Name(), pkg.Types.Path() + "." + typeName.Name()}
+			switch u := named.Underlying().(type) {
+			case *types.Interface:
+				for i := 0; i < u.NumExplicitMethods(); i++ {
+					if u.ExplicitMethod(i).Name() == name && (qualifier == "" || contains(owners, qualifier)) {
+						add(pkg.Fset, u.ExplicitMethod(i))
+					}
+				}
+			case *types.Struct:
+				for i := 0; i < u.NumFields(); i++ {
+					if u.Field(i).Name() == name && (qualifier == "" || contains(owners, qualifier)) {
+						add(pkg.Fset, u.Field(i))
+					}
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// resolveObject resolves a target given either a file position or a
+// possibly qualified symbol name
+func resolveObject(pkgs []*packages.Package, file string, line, column int, symbol string) (types.Object, error) {
+	if file != "" {
+		ident, pkg, err := identAtPosition(pkgs, file, line, column)
+		if err != nil {
+			return nil, err
+		}
+		obj := identObject(pkg.TypesInfo, ident)
+		if obj == nil {
+			return nil, fmt.Errorf("identifier %s does not refer to an object", ident.Name)
+		}
+		return obj, nil
+	}
+
+	if symbol == "" {
+		return nil, fmt.Errorf("either file/line/column or symbol is required")
+	}
+
+	objs := lookupSymbol(pkgs, symbol)
+	switch len(objs) {
+	case 0:
+		return nil, fmt.Errorf("symbol %s not found", symbol)
+	case 1:
+		return objs[0], nil
+	}
+
+	var candidates []string
+	for _, obj := range objs {
+		candidates = append(candidates, qualifiedName(obj))
+	}
+	return nil, fmt.Errorf("symbol %s is ambiguous: %s", symbol, strings.Join(candidates, ", "))
+}
+
+// packageIndex maps every type-checked package reachable from pkgs,
+// including dependencies, by its types.Package
+func packageIndex(pkgs []*packages.Package) map[*types.Package]*packages.Package {
+	index := make(map[*types.Package]*packages.Package)
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if pkg.Types != nil {
+			index[pkg.Types] = pkg
+		}
+	})
+	return index
+}
+
+// fileForPos returns the syntax tree of pkg containing pos
+func fileForPos(pkg *packages.Package, pos token.Pos) *ast.File {
+	for _, file := range pkg.Syntax {
+		if file.FileStart <= pos && pos <= file.FileEnd {
+			return file
+		}
+	}
+	return nil
+}
@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,12 +25,60 @@ type RunResult struct {
 	Error    string `json:"error,omitempty"`
 }
 
+// toolArguments records the arguments each tool declares, for middleware
+// that treats tools differently depending on their schema
+var toolArguments = make(map[string]map[string]bool)
+
+// declareTool records the arguments of tool as it is registered
+func declareTool(tool mcp.Tool) mcp.Tool {
+	args := make(map[string]bool, len(tool.InputSchema.Properties))
+	for name := range tool.InputSchema.Properties {
+		args[name] = true
+	}
+	toolArguments[tool.Name] = args
+	return tool
+}
+
+// declares reports whether the named tool declares the argument arg
+func declares(tool, arg string) bool {
+	return toolArguments[tool][arg]
+}
+
 func main() {
+	var opts serveOptions
+	flag.StringVar(&opts.transport, "transport", transportStdio, "Transport to serve MCP over: stdio, http (streamable HTTP) or sse")
+	flag.StringVar(&opts.listen, "listen", "localhost:8080", "Address to listen on for the http and sse transports")
+	flag.StringVar(&opts.authToken, "auth-token", os.Getenv("GOCP_AUTH_TOKEN"), "Bearer token HTTP clients must send (default $GOCP_AUTH_TOKEN)")
+	flag.BoolVar(&opts.noAuth, "insecure-no-auth", false, "Allow the http and sse transports to serve without -auth-token")
+	var roots rootList
+	flag.Var(&roots, "root", "Directory tools may access, repeatable (default $GOCP_ROOTS, unrestricted if empty)")
+	readOnlyDefault, _ := strconv.ParseBool(os.Getenv("GOCP_READ_ONLY"))
+	readOnly := flag.Bool("read-only", readOnlyDefault, "Refuse tools that write files or run code (default $GOCP_READ_ONLY)")
+	toolTimeout := flag.Duration("tool-timeout", 0, "Cancel tool calls running longer than this, returning partial results (0 for no limit)")
+	flag.Parse()
+	if len(roots) == 0 {
+		roots = filepath.SplitList(os.Getenv("GOCP_ROOTS"))
+	}
+
+	sb, err := newSandbox(roots, *readOnly)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid sandbox: %v\n", err)
+		os.Exit(1)
+	}
+
+	calls := newToolCalls(*toolTimeout)
+
 	mcpServer := server.NewMCPServer(
 		"gocp",
 		"1.0.0",
 		server.WithToolCapabilities(false),
+		server.WithToolHandlerMiddleware(calls.middleware),
+		server.WithToolHandlerMiddleware(progressMiddleware),
+		server.WithToolHandlerMiddleware(sb.middleware),
+		server.WithToolHandlerMiddleware(resultOptionsMiddleware),
+		server.WithToolFilter(resultOptionsFilter),
 	)
+	mcpServer.AddNotificationHandler(methodCancelled, calls.cancelled)
 
 	// Define the build_and_run_go tool
 	buildAndRunTool := mcp.NewTool("build_and_run_go",
@@ -40,7 +91,7 @@ func main() {
 			mcp.Description("Timeout in seconds (default: 30)"),
 		),
 	)
-	mcpServer.AddTool(buildAndRunTool, buildAndRunHandler)
+	mcpServer.AddTool(declareTool(buildAndRunTool), buildAndRunHandler)
 
 	// Define the find_symbols tool
 	findSymbolsTool := mcp.NewTool("find_symbols",
@@ -52,7 +103,7 @@ func main() {
 			mcp.Description("Symbol name pattern to search for (case-insensitive substring match)"),
 		),
 	)
-	mcpServer.AddTool(findSymbolsTool, findSymbolsHandler)
+	mcpServer.AddTool(declareTool(findSymbolsTool), findSymbolsHandler)
 
 	// Define the get_type_info tool
 	getTypeInfoTool := mcp.NewTool("get_type_info",
@@ -62,10 +113,10 @@ func main() {
 		),
 		mcp.WithString("type",
 			mcp.Required(),
-			mcp.Description("Type name to get information for"),
+			mcp.Description("Type name to get information for, optionally qualified by package (e.g. 'Server', 'http.Server')"),
 		),
 	)
-	mcpServer.AddTool(getTypeInfoTool, getTypeInfoHandler)
+	mcpServer.AddTool(declareTool(getTypeInfoTool), getTypeInfoHandler)
 
 	// Define the find_references tool
 	findReferencesTool := mcp.NewTool("find_references",
@@ -75,10 +126,10 @@ func main() {
 		),
 		mcp.WithString("symbol",
 			mcp.Required(),
-			mcp.Description("Symbol name to find references for"),
+			mcp.Description("Symbol name to find references for, optionally qualified by package and/or receiver type (e.g. 'Get', 'http.Get', 'Client.Do')"),
 		),
 	)
-	mcpServer.AddTool(findReferencesTool, findReferencesHandler)
+	mcpServer.AddTool(declareTool(findReferencesTool), findReferencesHandler)
 
 	// Define the list_packages tool
 	listPackagesTool := mcp.NewTool("list_packages",
@@ -90,7 +141,7 @@ func main() {
 			mcp.Description("Include test files in package listings (default: false)"),
 		),
 	)
-	mcpServer.AddTool(listPackagesTool, listPackagesHandler)
+	mcpServer.AddTool(declareTool(listPackagesTool), listPackagesHandler)
 
 	// Define the find_imports tool
 	findImportsTool := mcp.NewTool("find_imports",
@@ -99,7 +150,7 @@ func main() {
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 	)
-	mcpServer.AddTool(findImportsTool, findImportsHandler)
+	mcpServer.AddTool(declareTool(findImportsTool), findImportsHandler)
 
 	// Define the find_function_calls tool
 	findFunctionCallsTool := mcp.NewTool("find_function_calls",
@@ -109,10 +160,10 @@ func main() {
 		),
 		mcp.WithString("function",
 			mcp.Required(),
-			mcp.Description("Function name to find calls for"),
+			mcp.Description("Function name to find calls for, optionally qualified by package and/or receiver type (e.g. 'Println', 'fmt.Println', 'Client.Do')"),
 		),
 	)
-	mcpServer.AddTool(findFunctionCallsTool, findFunctionCallsHandler)
+	mcpServer.AddTool(declareTool(findFunctionCallsTool), findFunctionCallsHandler)
 
 	// Define the find_struct_usage tool
 	findStructUsageTool := mcp.NewTool("find_struct_usage",
@@ -125,28 +176,37 @@ func main() {
 			mcp.Description("Struct name to analyze usage for"),
 		),
 	)
-	mcpServer.AddTool(findStructUsageTool, findStructUsageHandler)
+	mcpServer.AddTool(declareTool(findStructUsageTool), findStructUsageHandler)
 
 	// Define the extract_interfaces tool
 	extractInterfacesTool := mcp.NewTool("extract_interfaces",
-		mcp.WithDescription("Find types implementing an interface or suggest interfaces"),
+		mcp.WithDescription("Find the types implementing an interface, or the interfaces a type satisfies, using type information"),
 		mcp.WithString("dir",
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 		mcp.WithString("interface",
-			mcp.Description("Interface name to find implementations for (if empty, lists all interfaces)"),
+			mcp.Description("Interface to find implementations for, optionally qualified (e.g. 'io.Writer'); if empty, lists all interfaces"),
+		),
+		mcp.WithString("type",
+			mcp.Description("Concrete type to list the satisfied interfaces of instead (e.g. 'pkg.Type')"),
+		),
+		mcp.WithBoolean("include_dependencies",
+			mcp.Description("Also consider types and interfaces declared in dependencies (default: false)"),
 		),
 	)
-	mcpServer.AddTool(extractInterfacesTool, extractInterfacesHandler)
+	mcpServer.AddTool(declareTool(extractInterfacesTool), extractInterfacesHandler)
 
 	// Define the find_errors tool
 	findErrorsTool := mcp.NewTool("find_errors",
-		mcp.WithDescription("Find error handling patterns and unhandled errors"),
+		mcp.WithDescription("Find calls discarding an error result (as a statement, assigned to _, deferred or in go), plus error checks and returns, using type information"),
 		mcp.WithString("dir",
 			mcp.Description("Directory to search (default: current directory)"),
 		),
+		mcp.WithString("ignore",
+			mcp.Description("Comma-separated calls whose errors may be discarded, added to .gocp.yaml errors.ignore (e.g. 'os.Remove,(*os.File).Close,fmt.Fprintf(*bytes.Buffer)'; * matches any characters)"),
+		),
 	)
-	mcpServer.AddTool(findErrorsTool, findErrorsHandler)
+	mcpServer.AddTool(declareTool(findErrorsTool), findErrorsHandler)
 
 	// Define the analyze_tests tool
 	analyzeTestsTool := mcp.NewTool("analyze_tests",
@@ -154,8 +214,11 @@ func main() {
 		mcp.WithString("dir",
 			mcp.Description("Directory to search (default: current directory)"),
 		),
+		mcp.WithBoolean("coverage",
+			mcp.Description("Run go test -coverprofile and report statement coverage per function (default: false)"),
+		),
 	)
-	mcpServer.AddTool(analyzeTestsTool, analyzeTestsHandler)
+	mcpServer.AddTool(declareTool(analyzeTestsTool), analyzeTestsHandler)
 
 	// Define the find_comments tool
 	findCommentsTool := mcp.NewTool("find_comments",
@@ -173,16 +236,19 @@ func main() {
 			mcp.Description("Include surrounding lines of code as context (default: false)"),
 		),
 	)
-	mcpServer.AddTool(findCommentsTool, findCommentsHandler)
+	mcpServer.AddTool(declareTool(findCommentsTool), findCommentsHandler)
 
 	// Define the analyze_dependencies tool
 	analyzeDependenciesTool := mcp.NewTool("analyze_dependencies",
-		mcp.WithDescription("Analyze package dependencies and find cycles"),
+		mcp.WithDescription("Analyze package imports resolved against the module path, classify them as stdlib, internal or third-party, and report import cycles"),
 		mcp.WithString("dir",
 			mcp.Description("Directory to search (default: current directory)"),
 		),
+		mcp.WithBoolean("include_tests",
+			mcp.Description("Include imports from _test.go files (default: false)"),
+		),
 	)
-	mcpServer.AddTool(analyzeDependenciesTool, analyzeDependenciesHandler)
+	mcpServer.AddTool(declareTool(analyzeDependenciesTool), analyzeDependenciesHandler)
 
 	// Define the find_generics tool
 	findGenericsTool := mcp.NewTool("find_generics",
@@ -191,28 +257,31 @@ func main() {
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 	)
-	mcpServer.AddTool(findGenericsTool, findGenericsHandler)
+	mcpServer.AddTool(declareTool(findGenericsTool), findGenericsHandler)
 
 	// Define the find_dead_code tool
 	findDeadCodeTool := mcp.NewTool("find_dead_code",
-		mcp.WithDescription("Find unreachable code, unused variables, and dead branches"),
+		mcp.WithDescription("Find unused unexported declarations, exported functions unreachable from any main or test, code after return and branches behind constant conditions"),
 		mcp.WithString("dir",
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 	)
-	mcpServer.AddTool(findDeadCodeTool, findDeadCodeHandler)
+	mcpServer.AddTool(declareTool(findDeadCodeTool), findDeadCodeHandler)
 
 	// Define the find_duplicates tool
 	findDuplicatesTool := mcp.NewTool("find_duplicates",
-		mcp.WithDescription("Detect code duplication and similar function patterns"),
+		mcp.WithDescription("Detect duplicated code: similar functions and repeated statement sequences, comparing ASTs with identifiers and literals abstracted"),
 		mcp.WithString("dir",
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 		mcp.WithNumber("threshold",
-			mcp.Description("Similarity threshold (0.0-1.0, default: 0.8)"),
+			mcp.Description("Minimum similarity of whole functions (0.0-1.0, default: 0.8)"),
+		),
+		mcp.WithNumber("min_statements",
+			mcp.Description("Minimum length of duplicated statement sequences (default: 3)"),
 		),
 	)
-	mcpServer.AddTool(findDuplicatesTool, findDuplicatesHandler)
+	mcpServer.AddTool(declareTool(findDuplicatesTool), findDuplicatesHandler)
 
 	// Define the find_inefficiencies tool
 	findInefficienciesTool := mcp.NewTool("find_inefficiencies",
@@ -221,7 +290,7 @@ func main() {
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 	)
-	mcpServer.AddTool(findInefficienciesTool, findInefficienciesHandler)
+	mcpServer.AddTool(declareTool(findInefficienciesTool), findInefficienciesHandler)
 
 	// Define the extract_api tool
 	extractApiTool := mcp.NewTool("extract_api",
@@ -230,7 +299,7 @@ func main() {
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 	)
-	mcpServer.AddTool(extractApiTool, extractApiHandler)
+	mcpServer.AddTool(declareTool(extractApiTool), extractApiHandler)
 
 	// Define the generate_docs tool
 	generateDocsTool := mcp.NewTool("generate_docs",
@@ -242,7 +311,7 @@ func main() {
 			mcp.Description("Output format: 'markdown' or 'json' (default: 'markdown')"),
 		),
 	)
-	mcpServer.AddTool(generateDocsTool, generateDocsHandler)
+	mcpServer.AddTool(declareTool(generateDocsTool), generateDocsHandler)
 
 	// Define the find_deprecated tool
 	findDeprecatedTool := mcp.NewTool("find_deprecated",
@@ -251,16 +320,16 @@ func main() {
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 	)
-	mcpServer.AddTool(findDeprecatedTool, findDeprecatedHandler)
+	mcpServer.AddTool(declareTool(findDeprecatedTool), findDeprecatedHandler)
 
 	// Define the analyze_coupling tool
 	analyzeCouplingTool := mcp.NewTool("analyze_coupling",
-		mcp.WithDescription("Analyze package/module coupling and suggest refactoring"),
+		mcp.WithDescription("Compute afferent/efferent coupling, instability, abstractness and distance from the main sequence for module packages, ranking those in the zones of pain and uselessness with suggestions"),
 		mcp.WithString("dir",
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 	)
-	mcpServer.AddTool(analyzeCouplingTool, analyzeCouplingHandler)
+	mcpServer.AddTool(declareTool(analyzeCouplingTool), analyzeCouplingHandler)
 
 	// Define the find_patterns tool
 	findPatternsTool := mcp.NewTool("find_patterns",
@@ -269,16 +338,22 @@ func main() {
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 	)
-	mcpServer.AddTool(findPatternsTool, findPatternsHandler)
+	mcpServer.AddTool(declareTool(findPatternsTool), findPatternsHandler)
 
 	// Define the analyze_architecture tool
 	analyzeArchitectureTool := mcp.NewTool("analyze_architecture",
-		mcp.WithDescription("Analyze layer violations and dependency direction"),
+		mcp.WithDescription("Check imports against the layers and import rules in the architecture section of .gocp.yaml and report each violation"),
 		mcp.WithString("dir",
 			mcp.Description("Directory to search (default: current directory)"),
 		),
+		mcp.WithString("config",
+			mcp.Description("Path to the config file (default: .gocp.yaml or .gocp.yml at the module root)"),
+		),
+		mcp.WithBoolean("include_tests",
+			mcp.Description("Also check imports from _test.go files (default: false)"),
+		),
 	)
-	mcpServer.AddTool(analyzeArchitectureTool, analyzeArchitectureHandler)
+	mcpServer.AddTool(declareTool(analyzeArchitectureTool), analyzeArchitectureHandler)
 
 	// Define the analyze_go_idioms tool
 	analyzeGoIdiomsTool := mcp.NewTool("analyze_go_idioms",
@@ -287,7 +362,7 @@ func main() {
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 	)
-	mcpServer.AddTool(analyzeGoIdiomsTool, analyzeGoIdiomsHandler)
+	mcpServer.AddTool(declareTool(analyzeGoIdiomsTool), analyzeGoIdiomsHandler)
 
 	// Define the find_context_usage tool
 	findContextUsageTool := mcp.NewTool("find_context_usage",
@@ -296,7 +371,7 @@ func main() {
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 	)
-	mcpServer.AddTool(findContextUsageTool, findContextUsageHandler)
+	mcpServer.AddTool(declareTool(findContextUsageTool), findContextUsageHandler)
 
 	// Define the analyze_embedding tool
 	analyzeEmbeddingTool := mcp.NewTool("analyze_embedding",
@@ -305,7 +380,7 @@ func main() {
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 	)
-	mcpServer.AddTool(analyzeEmbeddingTool, analyzeEmbeddingHandler)
+	mcpServer.AddTool(declareTool(analyzeEmbeddingTool), analyzeEmbeddingHandler)
 
 	// Define the analyze_test_quality tool
 	analyzeTestQualityTool := mcp.NewTool("analyze_test_quality",
@@ -314,7 +389,7 @@ func main() {
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 	)
-	mcpServer.AddTool(analyzeTestQualityTool, analyzeTestQualityHandler)
+	mcpServer.AddTool(declareTool(analyzeTestQualityTool), analyzeTestQualityHandler)
 
 	// Define the find_missing_tests tool
 	findMissingTestsTool := mcp.NewTool("find_missing_tests",
@@ -322,8 +397,11 @@ func main() {
 		mcp.WithString("dir",
 			mcp.Description("Directory to search (default: current directory)"),
 		),
+		mcp.WithBoolean("coverage",
+			mcp.Description("Run go test -coverprofile and report functions not fully executed by tests, with uncovered line ranges (default: false)"),
+		),
 	)
-	mcpServer.AddTool(findMissingTestsTool, findMissingTestsHandler)
+	mcpServer.AddTool(declareTool(findMissingTestsTool), findMissingTestsHandler)
 
 	// Define the read_range tool
 	readRangeTool := mcp.NewTool("read_range",
@@ -351,7 +429,7 @@ func main() {
 			mcp.Description("End byte offset (0-based, exclusive)"),
 		),
 	)
-	mcpServer.AddTool(readRangeTool, readRangeHandler)
+	mcpServer.AddTool(declareTool(readRangeTool), readRangeHandler)
 
 	// Define the write_range tool
 	writeRangeTool := mcp.NewTool("write_range",
@@ -385,8 +463,11 @@ func main() {
 		mcp.WithString("confirm_old",
 			mcp.Description("Expected old content for confirmation before replacing"),
 		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Return the unified diff without writing (default: false)"),
+		),
 	)
-	mcpServer.AddTool(writeRangeTool, writeRangeHandler)
+	mcpServer.AddTool(declareTool(writeRangeTool), writeRangeHandler)
 
 	// Define the search_replace tool
 	searchReplaceTool := mcp.NewTool("search_replace",
@@ -420,8 +501,11 @@ func main() {
 		mcp.WithBoolean("replace_all",
 			mcp.Description("Replace all occurrences (default: true). If false, only replace first occurrence in each file"),
 		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Return per-file unified diffs of replacements without writing (default: false)"),
+		),
 	)
-	mcpServer.AddTool(searchReplaceTool, searchReplaceHandler)
+	mcpServer.AddTool(declareTool(searchReplaceTool), searchReplaceHandler)
 
 	// Define the find_method_receivers tool
 	findMethodReceiversTool := mcp.NewTool("find_method_receivers",
@@ -430,7 +514,7 @@ func main() {
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 	)
-	mcpServer.AddTool(findMethodReceiversTool, findMethodReceiversHandler)
+	mcpServer.AddTool(declareTool(findMethodReceiversTool), findMethodReceiversHandler)
 
 	// Define the analyze_goroutines tool
 	analyzeGoroutinesTool := mcp.NewTool("analyze_goroutines",
@@ -439,7 +523,7 @@ func main() {
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 	)
-	mcpServer.AddTool(analyzeGoroutinesTool, analyzeGoroutinesHandler)
+	mcpServer.AddTool(declareTool(analyzeGoroutinesTool), analyzeGoroutinesHandler)
 
 	// Define the find_panic_recover tool
 	findPanicRecoverTool := mcp.NewTool("find_panic_recover",
@@ -448,7 +532,7 @@ func main() {
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 	)
-	mcpServer.AddTool(findPanicRecoverTool, findPanicRecoverHandler)
+	mcpServer.AddTool(declareTool(findPanicRecoverTool), findPanicRecoverHandler)
 
 	// Define the analyze_channels tool
 	analyzeChannelsTool := mcp.NewTool("analyze_channels",
@@ -457,7 +541,7 @@ func main() {
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 	)
-	mcpServer.AddTool(analyzeChannelsTool, analyzeChannelsHandler)
+	mcpServer.AddTool(declareTool(analyzeChannelsTool), analyzeChannelsHandler)
 
 	// Define the find_type_assertions tool
 	findTypeAssertionsTool := mcp.NewTool("find_type_assertions",
@@ -466,7 +550,7 @@ func main() {
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 	)
-	mcpServer.AddTool(findTypeAssertionsTool, findTypeAssertionsHandler)
+	mcpServer.AddTool(declareTool(findTypeAssertionsTool), findTypeAssertionsHandler)
 
 	// Define the analyze_memory_allocations tool
 	analyzeMemoryAllocationsTool := mcp.NewTool("analyze_memory_allocations",
@@ -475,7 +559,7 @@ func main() {
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 	)
-	mcpServer.AddTool(analyzeMemoryAllocationsTool, analyzeMemoryAllocationsHandler)
+	mcpServer.AddTool(declareTool(analyzeMemoryAllocationsTool), analyzeMemoryAllocationsHandler)
 
 	// Define the find_reflection_usage tool
 	findReflectionUsageTool := mcp.NewTool("find_reflection_usage",
@@ -484,7 +568,7 @@ func main() {
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 	)
-	mcpServer.AddTool(findReflectionUsageTool, findReflectionUsageHandler)
+	mcpServer.AddTool(declareTool(findReflectionUsageTool), findReflectionUsageHandler)
 
 	// Define the find_init_functions tool
 	findInitFunctionsTool := mcp.NewTool("find_init_functions",
@@ -493,7 +577,7 @@ func main() {
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 	)
-	mcpServer.AddTool(findInitFunctionsTool, findInitFunctionsHandler)
+	mcpServer.AddTool(declareTool(findInitFunctionsTool), findInitFunctionsHandler)
 
 	// Define the analyze_defer_patterns tool
 	analyzeDeferPatternsTool := mcp.NewTool("analyze_defer_patterns",
@@ -502,7 +586,7 @@ func main() {
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 	)
-	mcpServer.AddTool(analyzeDeferPatternsTool, analyzeDeferPatternsHandler)
+	mcpServer.AddTool(declareTool(analyzeDeferPatternsTool), analyzeDeferPatternsHandler)
 
 	// Define the find_empty_blocks tool
 	findEmptyBlocksTool := mcp.NewTool("find_empty_blocks",
@@ -511,7 +595,7 @@ func main() {
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 	)
-	mcpServer.AddTool(findEmptyBlocksTool, findEmptyBlocksHandler)
+	mcpServer.AddTool(declareTool(findEmptyBlocksTool), findEmptyBlocksHandler)
 
 	// Define the analyze_naming_conventions tool
 	analyzeNamingConventionsTool := mcp.NewTool("analyze_naming_conventions",
@@ -520,7 +604,7 @@ func main() {
 			mcp.Description("Directory to search (default: current directory)"),
 		),
 	)
-	mcpServer.AddTool(analyzeNamingConventionsTool, analyzeNamingConventionsHandler)
+	mcpServer.AddTool(declareTool(analyzeNamingConventionsTool), analyzeNamingConventionsHandler)
 
 	// Define the go_run tool
 	goRunTool := mcp.NewTool("go_run",
@@ -536,15 +620,18 @@ func main() {
 			mcp.Description("Timeout in seconds (default: 30)"),
 		),
 	)
-	mcpServer.AddTool(goRunTool, goRunHandler)
+	mcpServer.AddTool(declareTool(goRunTool), goRunHandler)
 
 	// Define the go_test tool
 	goTestTool := mcp.NewTool("go_test",
-		mcp.WithDescription("Execute go test command with specified path and optional flags"),
+		mcp.WithDescription("Execute go test with specified path and optional flags, returning structured per-package and per-test results"),
 		mcp.WithString("path",
 			mcp.Required(),
 			mcp.Description("Path to Go package or directory to test"),
 		),
+		mcp.WithString("packages",
+			mcp.Description("Package patterns relative to path (space-separated, e.g., './...' or './internal/...'; default: '.')"),
+		),
 		mcp.WithString("flags",
 			mcp.Description("Optional flags for go test (space-separated, e.g., '-v -cover -race')"),
 		),
@@ -552,10 +639,257 @@ func main() {
 			mcp.Description("Timeout in seconds (default: 60)"),
 		),
 	)
-	mcpServer.AddTool(goTestTool, goTestHandler)
+	mcpServer.AddTool(declareTool(goTestTool), goTestHandler)
+
+	// Define the rename_symbol tool
+	renameSymbolTool := mcp.NewTool("rename_symbol",
+		mcp.WithDescription("Rename a symbol and every use of it across the module using type information, keeping interface method sets and embedded fields consistent"),
+		mcp.WithString("dir",
+			mcp.Description("Directory within the module (default: current directory)"),
+		),
+		mcp.WithString("file",
+			mcp.Description("File containing the identifier to rename (use with line and column)"),
+		),
+		mcp.WithNumber("line",
+			mcp.Description("Line of the identifier (1-based)"),
+		),
+		mcp.WithNumber("column",
+			mcp.Description("Column of the identifier (1-based, in bytes)"),
+		),
+		mcp.WithString("symbol",
+			mcp.Description("Package-qualified symbol to rename instead of a position (e.g. 'pkg.Type.Method')"),
+		),
+		mcp.WithString("new_name",
+			mcp.Required(),
+			mcp.Description("New name for the symbol"),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Return per-file diffs without writing (default: false)"),
+		),
+	)
+	mcpServer.AddTool(declareTool(renameSymbolTool), renameSymbolHandler)
+
+	// Define the goto_definition tool
+	gotoDefinitionTool := mcp.NewTool("goto_definition",
+		mcp.WithDescription("Resolve the identifier at a position to its definition, including standard library and module cache dependencies"),
+		mcp.WithString("file",
+			mcp.Required(),
+			mcp.Description("File containing the identifier"),
+		),
+		mcp.WithNumber("line",
+			mcp.Required(),
+			mcp.Description("Line of the identifier (1-based)"),
+		),
+		mcp.WithNumber("column",
+			mcp.Required(),
+			mcp.Description("Column of the identifier (1-based, in bytes)"),
+		),
+	)
+	mcpServer.AddTool(declareTool(gotoDefinitionTool), gotoDefinitionHandler)
+
+	// Define the hover tool
+	hoverTool := mcp.NewTool("hover",
+		mcp.WithDescription("Show the type, signature, doc comment and package of the identifier at a position"),
+		mcp.WithString("file",
+			mcp.Required(),
+			mcp.Description("File containing the identifier"),
+		),
+		mcp.WithNumber("line",
+			mcp.Required(),
+			mcp.Description("Line of the identifier (1-based)"),
+		),
+		mcp.WithNumber("column",
+			mcp.Required(),
+			mcp.Description("Column of the identifier (1-based, in bytes)"),
+		),
+	)
+	mcpServer.AddTool(declareTool(hoverTool), hoverHandler)
+
+	// Define the index_status tool
+	indexStatusTool := mcp.NewTool("index_status",
+		mcp.WithDescription("Show what the in-memory workspace index has cached and when it was last refreshed"),
+		mcp.WithString("dir",
+			mcp.Description("Directory whose workspace to report (default: all indexed workspaces)"),
+		),
+	)
+	mcpServer.AddTool(declareTool(indexStatusTool), indexStatusHandler)
+
+	// Define the call_hierarchy tool
+	callHierarchyTool := mcp.NewTool("call_hierarchy",
+		mcp.WithDescription("Find the transitive callers and callees of a function or method using the module's call graph"),
+		mcp.WithString("dir",
+			mcp.Description("Directory within the module (default: current directory)"),
+		),
+		mcp.WithString("file",
+			mcp.Description("File containing the function name (use with line and column)"),
+		),
+		mcp.WithNumber("line",
+			mcp.Description("Line of the function name (1-based)"),
+		),
+		mcp.WithNumber("column",
+			mcp.Description("Column of the function name (1-based, in bytes)"),
+		),
+		mcp.WithString("symbol",
+			mcp.Description("Package-qualified function or method instead of a position (e.g. 'pkg.Type.Method')"),
+		),
+		mcp.WithString("direction",
+			mcp.Description("incoming, outgoing or both (default: both)"),
+		),
+		mcp.WithNumber("depth",
+			mcp.Description("Maximum number of calls away from the function (default: 3)"),
+		),
+		mcp.WithString("algorithm",
+			mcp.Description("Call graph algorithm: static (direct calls only), cha (class hierarchy analysis of interface calls) or vta (variable type analysis) (default: static)"),
+		),
+		mcp.WithBoolean("include_external",
+			mcp.Description("Include functions declared outside the module, such as the standard library (default: false)"),
+		),
+	)
+	mcpServer.AddTool(declareTool(callHierarchyTool), callHierarchyHandler)
+
+	// Define the analyze_complexity tool
+	analyzeComplexityTool := mcp.NewTool("analyze_complexity",
+		mcp.WithDescription("Measure cyclomatic and cognitive complexity, nesting depth, parameter count and length of every function, with thresholds and per-package aggregates"),
+		mcp.WithString("dir",
+			mcp.Description("Directory to search (default: current directory)"),
+		),
+		mcp.WithString("sort_by",
+			mcp.Description("cyclomatic, cognitive, nesting, params, length, name or position (default: cyclomatic)"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of functions to return (default: all)"),
+		),
+		mcp.WithBoolean("only_exceeding",
+			mcp.Description("Only return functions exceeding a threshold (default: false)"),
+		),
+		mcp.WithBoolean("include_tests",
+			mcp.Description("Include _test.go files (default: false)"),
+		),
+		mcp.WithNumber("max_cyclomatic",
+			mcp.Description("Cyclomatic complexity threshold, 0 to disable (default: 10)"),
+		),
+		mcp.WithNumber("max_cognitive",
+			mcp.Description("Cognitive complexity threshold, 0 to disable (default: 15)"),
+		),
+		mcp.WithNumber("max_nesting",
+			mcp.Description("Nesting depth threshold, 0 to disable (default: 4)"),
+		),
+		mcp.WithNumber("max_params",
+			mcp.Description("Parameter count threshold, 0 to disable (default: 5)"),
+		),
+		mcp.WithNumber("max_length",
+			mcp.Description("Function length threshold in lines, 0 to disable (default: 60)"),
+		),
+	)
+	mcpServer.AddTool(declareTool(analyzeComplexityTool), analyzeComplexityHandler)
+
+	// Define the dependency_graph tool
+	dependencyGraphTool := mcp.NewTool("dependency_graph",
+		mcp.WithDescription("Render the package import graph or type reference graph as Graphviz DOT, Mermaid or nodes/edges JSON"),
+		mcp.WithString("dir",
+			mcp.Description("Directory to search (default: current directory)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: dot, mermaid or json (default: dot)"),
+		),
+		mcp.WithString("level",
+			mcp.Description("Graph of package imports or of named types referencing each other: package or type (default: package)"),
+		),
+		mcp.WithString("focus",
+			mcp.Description("Only show the graph around this package (import path or path relative to the module)"),
+		),
+		mcp.WithNumber("depth",
+			mcp.Description("Maximum edges from the focus package, or from the top-level packages without one; 0 for unlimited (default: 0)"),
+		),
+		mcp.WithBoolean("exclude_stdlib",
+			mcp.Description("Omit standard library packages (default: false)"),
+		),
+		mcp.WithString("collapse",
+			mcp.Description("Comma-separated package path prefixes to collapse into a single node each"),
+		),
+	)
+	mcpServer.AddTool(declareTool(dependencyGraphTool), dependencyGraphHandler)
+
+	// Define the analyze_error_flow tool
+	analyzeErrorFlowTool := mcp.NewTool("analyze_error_flow",
+		mcp.WithDescription("Report errors returned across package boundaries without context, fmt.Errorf without %w, sentinel comparisons and type assertions that miss wrapped errors, and catalog exported sentinel errors and error types per package"),
+		mcp.WithString("dir",
+			mcp.Description("Directory to search (default: current directory)"),
+		),
+		mcp.WithBoolean("include_tests",
+			mcp.Description("Also check _test.go files (default: false)"),
+		),
+	)
+	mcpServer.AddTool(declareTool(analyzeErrorFlowTool), analyzeErrorFlowHandler)
+
+	// Define the structural_replace tool
+	structuralReplaceTool := mcp.NewTool("structural_replace",
+		mcp.WithDescription("Find Go code matching a syntax pattern with $name metavariables (e.g. '$x.Lock(); defer $x.Unlock()') and optionally rewrite each match from a template, returning per-file diffs"),
+		mcp.WithString("dir",
+			mcp.Description("Directory to search (default: current directory)"),
+		),
+		mcp.WithString("pattern",
+			mcp.Required(),
+			mcp.Description("Go expression or statements; $name matches any expression or statement (repeats must match the same code), $*name any number of list elements, $_ anything"),
+		),
+		mcp.WithString("replacement",
+			mcp.Description("Rewrite template using the pattern's metavariables (omit to only search)"),
+		),
+		mcp.WithString("constraints",
+			mcp.Description("Comma-separated name:type entries; the metavariable's type must be identical to type or implement it if an interface (e.g. 'x:*sync.Mutex,err:error')"),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Return per-file diffs without writing (default: false)"),
+		),
+	)
+	mcpServer.AddTool(declareTool(structuralReplaceTool), structuralReplaceHandler)
+
+	// Define the apply_patch tool
+	applyPatchTool := mcp.NewTool("apply_patch",
+		mcp.WithDescription("Apply a unified diff, such as one returned by a dry run, after checking every hunk still applies cleanly"),
+		mcp.WithString("patch",
+			mcp.Required(),
+			mcp.Description("Unified diff (diff -u or git diff format); files may be created or deleted via /dev/null"),
+		),
+		mcp.WithString("dir",
+			mcp.Description("Directory relative paths in the patch are resolved against (default: current directory)"),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Only check that the patch applies (default: false)"),
+		),
+	)
+	mcpServer.AddTool(declareTool(applyPatchTool), applyPatchHandler)
+
+	// Define the apply_edits tool
+	applyEditsTool := mcp.NewTool("apply_edits",
+		mcp.WithDescription("Apply several write_range style edits across files as one transaction: all are validated first, files are replaced via temp file and rename, and everything is rolled back if any step fails"),
+		mcp.WithArray("edits",
+			mcp.Required(),
+			mcp.Description("Edits to apply; positions refer to the current contents, so edits to the same file must not overlap"),
+			mcp.Items(map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"file":        map[string]any{"type": "string", "description": "File path to write to"},
+					"content":     map[string]any{"type": "string", "description": "Content to write"},
+					"start_line":  map[string]any{"type": "number", "description": "Start line (1-based, use with end_line)"},
+					"end_line":    map[string]any{"type": "number", "description": "End line (1-based, inclusive)"},
+					"start_col":   map[string]any{"type": "number", "description": "Start column (1-based, optional)"},
+					"end_col":     map[string]any{"type": "number", "description": "End column (1-based, optional)"},
+					"start_byte":  map[string]any{"type": "number", "description": "Start byte offset (0-based, use with end_byte)"},
+					"end_byte":    map[string]any{"type": "number", "description": "End byte offset (0-based, exclusive)"},
+					"confirm_old": map[string]any{"type": "string", "description": "Expected old content for confirmation before replacing"},
+				},
+				"required": []string{"file", "content"},
+			}),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Validate and return per-file diffs without writing (default: false)"),
+		),
+	)
+	mcpServer.AddTool(declareTool(applyEditsTool), applyEditsHandler)
 
 	// Start the server
-	if err := server.ServeStdio(mcpServer); err != nil {
+	if err := serve(mcpServer, opts); err != nil {
 		fmt.Fprintf(os.Stderr, "Server error: %v\n", err)
 		os.Exit(1)
 	}
@@ -569,7 +903,7 @@ func buildAndRunHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.
 
 	timeout := request.GetFloat("timeout", 30.0)
 
-	stdout, stderr, exitCode, runErr := buildAndRunGo(code, time.Duration(timeout)*time.Second)
+	stdout, stderr, exitCode, runErr := buildAndRunGo(ctx, code, time.Duration(timeout)*time.Second)
 	
 	result := RunResult{
 		Stdout:   stdout,
@@ -589,7 +923,7 @@ func buildAndRunHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.
 	return mcp.NewToolResultText(string(jsonData)), nil
 }
 
-func buildAndRunGo(code string, timeout time.Duration) (stdout, stderr string, exitCode int, err error) {
+func buildAndRunGo(ctx context.Context, code string, timeout time.Duration) (stdout, stderr string, exitCode int, err error) {
 	tmpDir, err := os.MkdirTemp("", "gocp-*")
 	if err != nil {
 		return "", "", -1, fmt.Errorf("failed to create temp dir: %w", err)
@@ -601,17 +935,15 @@ func buildAndRunGo(code string, timeout time.Duration) (stdout, stderr string, e
 		return "", "", -1, fmt.Errorf("failed to write code: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	modCmd := exec.CommandContext(ctx, "go", "mod", "init", "temp")
-	modCmd.Dir = tmpDir
+	modCmd := goCommand(ctx, tmpDir, "mod", "init", "temp")
 	if err := modCmd.Run(); err != nil {
 		return "", "", -1, fmt.Errorf("failed to initialize go.mod: %w", err)
 	}
 
-	runCmd := exec.CommandContext(ctx, "go", "run", tmpFile)
-	runCmd.Dir = tmpDir
+	runCmd := goCommand(ctx, tmpDir, "run", tmpFile)
 	
 	var stdoutBuf, stderrBuf bytes.Buffer
 	runCmd.Stdout = &stdoutBuf
@@ -621,11 +953,11 @@ func buildAndRunGo(code string, timeout time.Duration) (stdout, stderr string, e
 	
 	exitCode = 0
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
+		if reason := interruption(ctx); reason != "" {
+			return stdoutBuf.String(), stderrBuf.String(), -1, errors.New(reason)
+		} else if exitErr, ok := err.(*exec.ExitError); ok {
 			exitCode = exitErr.ExitCode()
 			err = nil
-		} else if ctx.Err() == context.DeadlineExceeded {
-			return stdoutBuf.String(), stderrBuf.String(), -1, fmt.Errorf("execution timeout exceeded")
 		} else {
 			return stdoutBuf.String(), stderrBuf.String(), -1, err
 		}
@@ -638,7 +970,7 @@ func findSymbolsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.
 	dir := request.GetString("dir", "./")
 	pattern := request.GetString("pattern", "")
 
-	symbols, err := findSymbols(dir, pattern)
+	symbols, err := findSymbols(ctx, dir, pattern)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to find symbols: %v", err)), nil
 	}
@@ -659,7 +991,7 @@ func getTypeInfoHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	info, err := getTypeInfo(dir, typeName)
+	info, err := getTypeInfo(ctx, dir, typeName)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to get type info: %v", err)), nil
 	}
@@ -680,7 +1012,7 @@ func findReferencesHandler(ctx context.Context, request mcp.CallToolRequest) (*m
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	refs, err := findReferences(dir, symbol)
+	refs, err := findReferences(ctx, dir, symbol)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to find references: %v", err)), nil
 	}
@@ -697,7 +1029,7 @@ func listPackagesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp
 	dir := request.GetString("dir", "./")
 	includeTests := request.GetBool("include_tests", false)
 
-	packages, err := listPackages(dir, includeTests)
+	packages, err := listPackages(ctx, dir, includeTests)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to list packages: %v", err)), nil
 	}
@@ -713,7 +1045,7 @@ func listPackagesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp
 func findImportsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	imports, err := findImports(dir)
+	imports, err := findImports(ctx, dir)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to analyze imports: %v", err)), nil
 	}
@@ -733,7 +1065,7 @@ func findFunctionCallsHandler(ctx context.Context, request mcp.CallToolRequest)
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	calls, err := findFunctionCalls(dir, function)
+	calls, err := findFunctionCalls(ctx, dir, function)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to find function calls: %v", err)), nil
 	}
@@ -753,7 +1085,7 @@ func findStructUsageHandler(ctx context.Context, request mcp.CallToolRequest) (*
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	usage, err := findStructUsage(dir, structName)
+	usage, err := findStructUsage(ctx, dir, structName)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to find struct usage: %v", err)), nil
 	}
@@ -769,8 +1101,24 @@ func findStructUsageHandler(ctx context.Context, request mcp.CallToolRequest) (*
 func extractInterfacesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 	interfaceName := request.GetString("interface", "")
+	typeName := request.GetString("type", "")
+	includeDeps := request.GetBool("include_dependencies", false)
+
+	if typeName != "" {
+		satisfied, err := satisfiedInterfaces(ctx, dir, typeName, includeDeps)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to find satisfied interfaces: %v", err)), nil
+		}
 
-	interfaces, err := extractInterfaces(dir, interfaceName)
+		jsonData, err := json.Marshal(satisfied)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to marshal interfaces: %v", err)), nil
+		}
+
+		return mcp.NewToolResultText(string(jsonData)), nil
+	}
+
+	interfaces, err := extractInterfaces(ctx, dir, interfaceName, includeDeps)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to extract interfaces: %v", err)), nil
 	}
@@ -786,12 +1134,17 @@ func extractInterfacesHandler(ctx context.Context, request mcp.CallToolRequest)
 func findErrorsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	errors, err := findErrors(dir)
+	var ignore []string
+	if list := request.GetString("ignore", ""); list != "" {
+		ignore = strings.Split(list, ",")
+	}
+
+	found, err := findErrors(ctx, dir, ignore)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to find errors: %v", err)), nil
 	}
 
-	jsonData, err := json.Marshal(errors)
+	jsonData, err := json.Marshal(found)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal errors: %v", err)), nil
 	}
@@ -802,7 +1155,9 @@ func findErrorsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.C
 func analyzeTestsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	analysis, err := analyzeTests(dir)
+	withCoverage := request.GetBool("coverage", false)
+
+	analysis, err := analyzeTests(ctx, dir, withCoverage)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to analyze tests: %v", err)), nil
 	}
@@ -821,7 +1176,7 @@ func findCommentsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp
 	filter := request.GetString("filter", "")
 	includeContext := request.GetBool("include_context", false)
 
-	comments, err := findComments(dir, commentType, filter, includeContext)
+	comments, err := findComments(ctx, dir, commentType, filter, includeContext)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to find comments: %v", err)), nil
 	}
@@ -837,7 +1192,9 @@ func findCommentsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp
 func analyzeDependenciesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	deps, err := analyzeDependencies(dir)
+	includeTests := request.GetBool("include_tests", false)
+
+	deps, err := analyzeDependencies(ctx, dir, includeTests)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to analyze dependencies: %v", err)), nil
 	}
@@ -853,7 +1210,7 @@ func analyzeDependenciesHandler(ctx context.Context, request mcp.CallToolRequest
 func findGenericsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	generics, err := findGenerics(dir)
+	generics, err := findGenerics(ctx, dir)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to find generics: %v", err)), nil
 	}
@@ -869,7 +1226,7 @@ func findGenericsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp
 func findDeadCodeHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	deadCode, err := findDeadCode(dir)
+	deadCode, err := findDeadCode(ctx, dir)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to find dead code: %v", err)), nil
 	}
@@ -885,8 +1242,9 @@ func findDeadCodeHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp
 func findDuplicatesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 	threshold := request.GetFloat("threshold", 0.8)
+	minStatements := int(request.GetFloat("min_statements", defaultCloneStatements))
 
-	duplicates, err := findDuplicates(dir, threshold)
+	duplicates, err := findDuplicates(ctx, dir, threshold, minStatements)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to find duplicates: %v", err)), nil
 	}
@@ -902,7 +1260,7 @@ func findDuplicatesHandler(ctx context.Context, request mcp.CallToolRequest) (*m
 func findInefficienciesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	inefficiencies, err := findInefficiencies(dir)
+	inefficiencies, err := findInefficiencies(ctx, dir)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to find inefficiencies: %v", err)), nil
 	}
@@ -918,7 +1276,7 @@ func findInefficienciesHandler(ctx context.Context, request mcp.CallToolRequest)
 func extractApiHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	api, err := extractApi(dir)
+	api, err := extractApi(ctx, dir)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to extract API: %v", err)), nil
 	}
@@ -935,7 +1293,7 @@ func generateDocsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp
 	dir := request.GetString("dir", "./")
 	format := request.GetString("format", "markdown")
 
-	docs, err := generateDocs(dir, format)
+	docs, err := generateDocs(ctx, dir, format)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to generate docs: %v", err)), nil
 	}
@@ -955,7 +1313,7 @@ func generateDocsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp
 func findDeprecatedHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	deprecated, err := findDeprecated(dir)
+	deprecated, err := findDeprecated(ctx, dir)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to find deprecated: %v", err)), nil
 	}
@@ -971,7 +1329,7 @@ func findDeprecatedHandler(ctx context.Context, request mcp.CallToolRequest) (*m
 func analyzeCouplingHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	coupling, err := analyzeCoupling(dir)
+	coupling, err := analyzeCoupling(ctx, dir)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to analyze coupling: %v", err)), nil
 	}
@@ -987,7 +1345,7 @@ func analyzeCouplingHandler(ctx context.Context, request mcp.CallToolRequest) (*
 func findPatternsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	patterns, err := findPatterns(dir)
+	patterns, err := findPatterns(ctx, dir)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to find patterns: %v", err)), nil
 	}
@@ -1003,7 +1361,10 @@ func findPatternsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp
 func analyzeArchitectureHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	architecture, err := analyzeArchitecture(dir)
+	configPath := request.GetString("config", "")
+	includeTests := request.GetBool("include_tests", false)
+
+	architecture, err := analyzeArchitecture(ctx, dir, configPath, includeTests)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to analyze architecture: %v", err)), nil
 	}
@@ -1019,7 +1380,7 @@ func analyzeArchitectureHandler(ctx context.Context, request mcp.CallToolRequest
 func analyzeGoIdiomsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	idioms, err := analyzeGoIdioms(dir)
+	idioms, err := analyzeGoIdioms(ctx, dir)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to analyze Go idioms: %v", err)), nil
 	}
@@ -1035,7 +1396,7 @@ func analyzeGoIdiomsHandler(ctx context.Context, request mcp.CallToolRequest) (*
 func findContextUsageHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	contextUsage, err := findContextUsage(dir)
+	contextUsage, err := findContextUsage(ctx, dir)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to find context usage: %v", err)), nil
 	}
@@ -1051,7 +1412,7 @@ func findContextUsageHandler(ctx context.Context, request mcp.CallToolRequest) (
 func analyzeEmbeddingHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	embedding, err := analyzeEmbedding(dir)
+	embedding, err := analyzeEmbedding(ctx, dir)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to analyze embedding: %v", err)), nil
 	}
@@ -1067,7 +1428,7 @@ func analyzeEmbeddingHandler(ctx context.Context, request mcp.CallToolRequest) (
 func analyzeTestQualityHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	testQuality, err := analyzeTestQuality(dir)
+	testQuality, err := analyzeTestQuality(ctx, dir)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to analyze test quality: %v", err)), nil
 	}
@@ -1083,7 +1444,9 @@ func analyzeTestQualityHandler(ctx context.Context, request mcp.CallToolRequest)
 func findMissingTestsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	missingTests, err := findMissingTests(dir)
+	withCoverage := request.GetBool("coverage", false)
+
+	missingTests, err := findMissingTests(ctx, dir, withCoverage)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to find missing tests: %v", err)), nil
 	}
@@ -1140,8 +1503,9 @@ func writeRangeHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.C
 	startByte := int(request.GetFloat("start_byte", -1))
 	endByte := int(request.GetFloat("end_byte", -1))
 	confirmOld := request.GetString("confirm_old", "")
+	dryRun := request.GetBool("dry_run", false)
 
-	result, err := writeRange(file, content, startLine, endLine, startCol, endCol, startByte, endByte, confirmOld)
+	result, err := writeRange(file, content, startLine, endLine, startCol, endCol, startByte, endByte, confirmOld, dryRun)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to write range: %v", err)), nil
 	}
@@ -1186,8 +1550,9 @@ func searchReplaceHandler(ctx context.Context, request mcp.CallToolRequest) (*mc
 	beforePattern := request.GetString("before_pattern", "")
 	afterPattern := request.GetString("after_pattern", "")
 	replaceAll := request.GetBool("replace_all", true)
+	dryRun := request.GetBool("dry_run", false)
 
-	result, err := searchReplace(paths, pattern, replacement, useRegex, caseInsensitive, includeContext, beforePattern, afterPattern, replaceAll)
+	result, err := searchReplace(ctx, paths, pattern, replacement, useRegex, caseInsensitive, includeContext, beforePattern, afterPattern, replaceAll, dryRun)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("search/replace failed: %v", err)), nil
 	}
@@ -1203,7 +1568,7 @@ func searchReplaceHandler(ctx context.Context, request mcp.CallToolRequest) (*mc
 func findMethodReceiversHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	analysis, err := findMethodReceivers(dir)
+	analysis, err := findMethodReceivers(ctx, dir)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to analyze method receivers: %v", err)), nil
 	}
@@ -1219,7 +1584,7 @@ func findMethodReceiversHandler(ctx context.Context, request mcp.CallToolRequest
 func analyzeGoroutinesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	analysis, err := analyzeGoroutines(dir)
+	analysis, err := analyzeGoroutines(ctx, dir)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to analyze goroutines: %v", err)), nil
 	}
@@ -1235,7 +1600,7 @@ func analyzeGoroutinesHandler(ctx context.Context, request mcp.CallToolRequest)
 func findPanicRecoverHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	analysis, err := findPanicRecover(dir)
+	analysis, err := findPanicRecover(ctx, dir)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to find panic/recover: %v", err)), nil
 	}
@@ -1251,7 +1616,7 @@ func findPanicRecoverHandler(ctx context.Context, request mcp.CallToolRequest) (
 func analyzeChannelsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	analysis, err := analyzeChannels(dir)
+	analysis, err := analyzeChannels(ctx, dir)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to analyze channels: %v", err)), nil
 	}
@@ -1267,7 +1632,7 @@ func analyzeChannelsHandler(ctx context.Context, request mcp.CallToolRequest) (*
 func findTypeAssertionsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	analysis, err := findTypeAssertions(dir)
+	analysis, err := findTypeAssertions(ctx, dir)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to find type assertions: %v", err)), nil
 	}
@@ -1283,7 +1648,7 @@ func findTypeAssertionsHandler(ctx context.Context, request mcp.CallToolRequest)
 func analyzeMemoryAllocationsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	analysis, err := analyzeMemoryAllocations(dir)
+	analysis, err := analyzeMemoryAllocations(ctx, dir)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to analyze memory allocations: %v", err)), nil
 	}
@@ -1299,7 +1664,7 @@ func analyzeMemoryAllocationsHandler(ctx context.Context, request mcp.CallToolRe
 func findReflectionUsageHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	analysis, err := findReflectionUsage(dir)
+	analysis, err := findReflectionUsage(ctx, dir)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to find reflection usage: %v", err)), nil
 	}
@@ -1315,7 +1680,7 @@ func findReflectionUsageHandler(ctx context.Context, request mcp.CallToolRequest
 func findInitFunctionsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	analysis, err := findInitFunctions(dir)
+	analysis, err := findInitFunctions(ctx, dir)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to find init functions: %v", err)), nil
 	}
@@ -1331,7 +1696,7 @@ func findInitFunctionsHandler(ctx context.Context, request mcp.CallToolRequest)
 func analyzeDeferPatternsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	analysis, err := analyzeDeferPatterns(dir)
+	analysis, err := analyzeDeferPatterns(ctx, dir)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to analyze defer patterns: %v", err)), nil
 	}
@@ -1347,7 +1712,7 @@ func analyzeDeferPatternsHandler(ctx context.Context, request mcp.CallToolReques
 func findEmptyBlocksHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	analysis, err := findEmptyBlocks(dir)
+	analysis, err := findEmptyBlocks(ctx, dir)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to find empty blocks: %v", err)), nil
 	}
@@ -1363,7 +1728,7 @@ func findEmptyBlocksHandler(ctx context.Context, request mcp.CallToolRequest) (*
 func analyzeNamingConventionsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	dir := request.GetString("dir", "./")
 
-	analysis, err := analyzeNamingConventions(dir)
+	analysis, err := analyzeNamingConventions(ctx, dir)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to analyze naming conventions: %v", err)), nil
 	}
@@ -1391,7 +1756,7 @@ func goRunHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallTo
 		flags = strings.Fields(flagsStr)
 	}
 
-	result, err := goRun(path, flags, time.Duration(timeout)*time.Second)
+	result, err := goRun(ctx, path, flags, time.Duration(timeout)*time.Second)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to run go run: %v", err)), nil
 	}
@@ -1410,6 +1775,7 @@ func goTestHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallT
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 
+	patterns := strings.Fields(request.GetString("packages", ""))
 	flagsStr := request.GetString("flags", "")
 	timeout := request.GetFloat("timeout", 60.0)
 
@@ -1419,7 +1785,7 @@ func goTestHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallT
 		flags = strings.Fields(flagsStr)
 	}
 
-	result, err := goTest(path, flags, time.Duration(timeout)*time.Second)
+	result, err := goTest(ctx, path, patterns, flags, time.Duration(timeout)*time.Second)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to run go test: %v", err)), nil
 	}
@@ -1430,4 +1796,274 @@ func goTestHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallT
 	}
 
 	return mcp.NewToolResultText(string(jsonData)), nil
-}
\ No newline at end of file
+}
+
+func renameSymbolHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	dir := request.GetString("dir", "./")
+	file := request.GetString("file", "")
+	line := int(request.GetFloat("line", 0))
+	column := int(request.GetFloat("column", 0))
+	symbol := request.GetString("symbol", "")
+	dryRun := request.GetBool("dry_run", false)
+
+	newName, err := request.RequireString("new_name")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	result, err := renameSymbol(ctx, dir, file, line, column, symbol, newName, dryRun)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to rename symbol: %v", err)), nil
+	}
+
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
+
+func gotoDefinitionHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	file, err := request.RequireString("file")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	line, err := request.RequireFloat("line")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	column, err := request.RequireFloat("column")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	definition, err := gotoDefinition(ctx, file, int(line), int(column))
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to find definition: %v", err)), nil
+	}
+
+	jsonData, err := json.Marshal(definition)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal definition: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
+
+func hoverHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	file, err := request.RequireString("file")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	line, err := request.RequireFloat("line")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	column, err := request.RequireFloat("column")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	info, err := hover(ctx, file, int(line), int(column))
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to hover: %v", err)), nil
+	}
+
+	jsonData, err := json.Marshal(info)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal hover info: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
+
+func indexStatusHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	dir := request.GetString("dir", "")
+
+	status, err := indexStatus(dir)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to get index status: %v", err)), nil
+	}
+
+	jsonData, err := json.Marshal(status)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal index status: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
+
+func callHierarchyHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	dir := request.GetString("dir", "./")
+	file := request.GetString("file", "")
+	line := int(request.GetFloat("line", 0))
+	column := int(request.GetFloat("column", 0))
+	symbol := request.GetString("symbol", "")
+	direction := request.GetString("direction", "both")
+	depth := int(request.GetFloat("depth", 3))
+	algorithm := request.GetString("algorithm", callGraphStatic)
+	includeExternal := request.GetBool("include_external", false)
+
+	result, err := callHierarchy(ctx, dir, file, line, column, symbol, direction, algorithm, depth, includeExternal)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to build call hierarchy: %v", err)), nil
+	}
+
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
+
+func analyzeComplexityHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	dir := request.GetString("dir", "./")
+	sortBy := request.GetString("sort_by", "cyclomatic")
+	limit := int(request.GetFloat("limit", 0))
+	onlyExceeding := request.GetBool("only_exceeding", false)
+	includeTests := request.GetBool("include_tests", false)
+
+	defaults := defaultComplexityThresholds
+	thresholds := ComplexityThresholds{
+		Cyclomatic: int(request.GetFloat("max_cyclomatic", float64(defaults.Cyclomatic))),
+		Cognitive:  int(request.GetFloat("max_cognitive", float64(defaults.Cognitive))),
+		Nesting:    int(request.GetFloat("max_nesting", float64(defaults.Nesting))),
+		Params:     int(request.GetFloat("max_params", float64(defaults.Params))),
+		Length:     int(request.GetFloat("max_length", float64(defaults.Length))),
+	}
+
+	report, err := analyzeComplexity(ctx, dir, thresholds, sortBy, onlyExceeding, includeTests, limit)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to analyze complexity: %v", err)), nil
+	}
+
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal report: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
+
+func dependencyGraphHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	dir := request.GetString("dir", "./")
+	format := request.GetString("format", "dot")
+
+	opts := graphOptions{
+		level:         request.GetString("level", "package"),
+		focus:         request.GetString("focus", ""),
+		depth:         int(request.GetFloat("depth", 0)),
+		excludeStdlib: request.GetBool("exclude_stdlib", false),
+	}
+	if collapse := request.GetString("collapse", ""); collapse != "" {
+		opts.collapse = strings.Split(collapse, ",")
+	}
+
+	graph, err := dependencyGraph(ctx, dir, format, opts)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to build dependency graph: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(graph), nil
+}
+
+func analyzeErrorFlowHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	dir := request.GetString("dir", "./")
+	includeTests := request.GetBool("include_tests", false)
+
+	report, err := analyzeErrorFlow(ctx, dir, includeTests)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to analyze error flow: %v", err)), nil
+	}
+
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal report: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
+
+func structuralReplaceHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	dir := request.GetString("dir", "./")
+	dryRun := request.GetBool("dry_run", false)
+
+	pattern, err := request.RequireString("pattern")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var replacement *string
+	if val, ok := request.GetArguments()["replacement"]; ok {
+		if str, ok := val.(string); ok {
+			replacement = &str
+		}
+	}
+
+	constraints, err := parseConstraints(request.GetString("constraints", ""))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	result, err := structuralReplace(ctx, dir, pattern, replacement, constraints, dryRun)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to replace: %v", err)), nil
+	}
+
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
+
+func applyPatchHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	dir := request.GetString("dir", "./")
+	dryRun := request.GetBool("dry_run", false)
+
+	patch, err := request.RequireString("patch")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	result, err := applyPatch(dir, patch, dryRun, resolverFromContext(ctx))
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to apply patch: %v", err)), nil
+	}
+
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
+
+func applyEditsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var args struct {
+		Edits  []rangeEdit `json:"edits"`
+		DryRun bool        `json:"dry_run"`
+	}
+	if err := request.BindArguments(&args); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("invalid edits: %v", err)), nil
+	}
+
+	result, err := applyRangeEdits(args.Edits, args.DryRun)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to apply edits: %v", err)), nil
+	}
+
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
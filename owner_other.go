@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// chownLike does nothing where files have no unix owner
+func chownLike(name string, info os.FileInfo) error {
+	return nil
+}
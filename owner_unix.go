@@ -0,0 +1,25 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// chownLike gives name the owner and group of info, if they differ from
+// its own
+func chownLike(name string, info os.FileInfo) error {
+	want, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	current, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if have, ok := current.Sys().(*syscall.Stat_t); ok && have.Uid == want.Uid && have.Gid == want.Gid {
+		return nil
+	}
+	return os.Chown(name, int(want.Uid), int(want.Gid))
+}
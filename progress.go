@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// methodProgress is the notification reporting the progress of a request
+// whose caller supplied a progress token
+const methodProgress = "notifications/progress"
+
+// progressInterval limits how often progress is sent for one call; the
+// last step of a phase is always sent
+const progressInterval = 200 * time.Millisecond
+
+type progressKey struct{}
+
+// progressReporter sends the progress notifications of one tool call. A
+// call may report several phases, such as two walks of the tree; their
+// steps add up so that progress never goes backwards.
+type progressReporter struct {
+	token mcp.ProgressToken
+
+	mu       sync.Mutex
+	offset   int // steps of the phases started so far
+	unknown  bool
+	lastSent time.Time
+}
+
+// progressMiddleware gives calls whose request carries a progress token a
+// reporter for startProgress to find
+func progressMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if meta := request.Params.Meta; meta != nil && meta.ProgressToken != nil {
+			ctx = context.WithValue(ctx, progressKey{}, &progressReporter{token: meta.ProgressToken})
+		}
+		return next(ctx, request)
+	}
+}
+
+// startProgress begins a phase of total steps, 0 if not known in advance,
+// in the progress of the call in ctx and returns the function reporting
+// the steps done so far. Without a progress token it does nothing.
+func startProgress(ctx context.Context, total int, message string) func(done int) {
+	r, ok := ctx.Value(progressKey{}).(*progressReporter)
+	if !ok {
+		return func(int) {}
+	}
+
+	r.mu.Lock()
+	base := r.offset
+	r.offset += total
+	if total == 0 {
+		r.unknown = true
+	}
+	r.mu.Unlock()
+
+	return func(done int) {
+		r.send(ctx, base, done, total, message)
+	}
+}
+
+// startGrowingProgress begins a phase whose total is learned as it goes,
+// such as packages announced by an event stream, and returns the function
+// reporting the steps done of the total seen so far
+func startGrowingProgress(ctx context.Context, message string) func(done, total int) {
+	r, ok := ctx.Value(progressKey{}).(*progressReporter)
+	if !ok {
+		return func(int, int) {}
+	}
+
+	r.mu.Lock()
+	base := r.offset
+	r.mu.Unlock()
+
+	return func(done, total int) {
+		r.mu.Lock()
+		if base+total > r.offset {
+			r.offset = base + total
+		}
+		r.mu.Unlock()
+		r.send(ctx, base, done, total, message)
+	}
+}
+
+func (r *progressReporter) send(ctx context.Context, base, done, total int, message string) {
+	r.mu.Lock()
+	final := total > 0 && done >= total
+	if !final && time.Since(r.lastSent) < progressInterval {
+		r.mu.Unlock()
+		return
+	}
+	r.lastSent = time.Now()
+	if base+done > r.offset {
+		// Phases of unknown length grow as they go
+		r.offset = base + done
+	}
+	params := map[string]any{
+		"progressToken": r.token,
+		"progress":      base + done,
+		"message":       message,
+	}
+	if !r.unknown {
+		params["total"] = r.offset
+	}
+	r.mu.Unlock()
+
+	if srv := server.ServerFromContext(ctx); srv != nil {
+		// Progress is advisory; a client that can't take it loses nothing
+		_ = srv.SendNotificationToClient(ctx, methodProgress, params)
+	}
+}
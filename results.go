@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// resultOptionProperties are the arguments tools take to shape their JSON
+// result; limit and cursor are only offered by tools in paginatedLists
+var resultOptionProperties = map[string]any{
+	"limit": map[string]any{
+		"type":        "number",
+		"description": "Return at most this many items, with a next_cursor for the rest",
+	},
+	"cursor": map[string]any{
+		"type":        "string",
+		"description": "next_cursor of the previous page, to continue a paginated result",
+	},
+	"path_glob": map[string]any{
+		"type":        "string",
+		"description": "Only return items whose file matches one of these comma-separated globs ('*' within a directory, '**' across them); patterns starting with '!' exclude. Items without a file are kept. Filters the result only, not what a tool reads or writes",
+	},
+	"fields": map[string]any{
+		"type":        "string",
+		"description": "Comma-separated fields to keep in each item, e.g. 'name,position.line'",
+	},
+}
+
+// paginatedLists names the list limit and cursor page through in each
+// tool's result: "" for tools returning a list, else the field of the
+// object they return. A cursor only makes sense for one list, so the other
+// lists of an object are filtered but returned whole. Tools missing here,
+// and tools with a limit argument of their own, are not paginated; nor are
+// tools that write files or run tests, which each page would do again.
+var paginatedLists = map[string]string{
+	"analyze_architecture":       "violations",
+	"analyze_channels":           "channels",
+	"analyze_coupling":           "",
+	"analyze_defer_patterns":     "defers",
+	"analyze_dependencies":       "packages",
+	"analyze_embedding":          "",
+	"analyze_error_flow":         "issues",
+	"analyze_go_idioms":          "",
+	"analyze_goroutines":         "goroutines",
+	"analyze_memory_allocations": "allocations",
+	"analyze_naming_conventions": "violations",
+	"analyze_test_quality":       "",
+	"analyze_tests":              "test_files",
+	"extract_api":                "",
+	"extract_interfaces":         "",
+	"find_comments":              "",
+	"find_context_usage":         "",
+	"find_dead_code":             "",
+	"find_deprecated":            "",
+	"find_duplicates":            "",
+	"find_empty_blocks":          "empty_blocks",
+	"find_errors":                "",
+	"find_function_calls":        "",
+	"find_generics":              "",
+	"find_imports":               "",
+	"find_inefficiencies":        "",
+	"find_init_functions":        "init_functions",
+	"find_method_receivers":      "methods",
+	"find_missing_tests":         "",
+	"find_panic_recover":         "usages",
+	"find_patterns":              "",
+	"find_references":            "",
+	"find_reflection_usage":      "usages",
+	"find_struct_usage":          "",
+	"find_symbols":               "",
+	"find_type_assertions":       "assertions",
+	"index_status":               "",
+	"list_packages":              "",
+}
+
+// paginatedList returns the list of the named tool's result that limit and
+// cursor page through, if it has one
+func paginatedList(tool string) (string, bool) {
+	if declares(tool, "limit") {
+		return "", false
+	}
+	list, ok := paginatedLists[tool]
+	return list, ok
+}
+
+// pathKeys are the item fields holding the file an item is about; "path"
+// also names import paths, so it only counts when absolute
+var pathKeys = []string{"file", "file_path", "path"}
+
+type resultOptions struct {
+	paginate bool
+	list     string // the paginated list of an object result
+	offset   int
+	limit    int    // 0 for no limit
+	query    string // identifies the arguments a cursor was issued for
+	include  []*regexp.Regexp
+	exclude  []*regexp.Regexp
+	fields   [][]string // dotted paths, split
+}
+
+// pageInfo is appended to a paginated result as a second text content
+type pageInfo struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      int    `json:"total"` // items in the paginated list
+}
+
+// resultOptionsFilter advertises the result options in every tool's schema
+func resultOptionsFilter(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+	result := make([]mcp.Tool, len(tools))
+	for i, tool := range tools {
+		if tool.RawInputSchema == nil {
+			list, paginated := paginatedList(tool.Name)
+			properties := make(map[string]any, len(tool.InputSchema.Properties)+len(resultOptionProperties))
+			for name, schema := range resultOptionProperties {
+				if name == "limit" || name == "cursor" {
+					if !paginated {
+						continue
+					}
+					if name == "limit" && list != "" {
+						schema = map[string]any{
+							"type":        "number",
+							"description": fmt.Sprintf("Return at most this many %s, with a next_cursor for the rest", list),
+						}
+					}
+				}
+				properties[name] = schema
+			}
+			for name, schema := range tool.InputSchema.Properties {
+				properties[name] = schema
+			}
+			tool.InputSchema.Properties = properties
+		}
+		result[i] = tool
+	}
+	return result
+}
+
+// resultOptionsMiddleware applies path_glob, then limit and cursor, then
+// fields to the JSON a tool returns. Results that are not JSON, such as
+// markdown or DOT, pass through unchanged.
+func resultOptionsMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		list, paginated := paginatedList(request.Params.Name)
+		opts, err := parseResultOptions(request.GetArguments(), paginated)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if opts != nil {
+			opts.list = list
+		}
+
+		result, err := next(ctx, request)
+		if err != nil || result == nil || result.IsError || opts == nil || len(result.Content) == 0 {
+			return result, err
+		}
+
+		text, ok := result.Content[0].(mcp.TextContent)
+		if !ok {
+			return result, nil
+		}
+		decoder := json.NewDecoder(strings.NewReader(text.Text))
+		decoder.UseNumber()
+		var value any
+		if decoder.Decode(&value) != nil {
+			return result, nil
+		}
+
+		shaped, page := opts.apply(value)
+		data, err := json.Marshal(shaped)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+		}
+		result.Content[0] = mcp.NewTextContent(string(data))
+
+		if page != nil {
+			note, _ := json.Marshal(page)
+			result.Content = append(result.Content, mcp.NewTextContent(string(note)))
+			if page.NextCursor != "" {
+				if result.Meta == nil {
+					result.Meta = make(map[string]any)
+				}
+				result.Meta["next_cursor"] = page.NextCursor
+			}
+		}
+		return result, nil
+	}
+}
+
+// parseResultOptions reads the result options from args, returning nil if
+// none are given. Without paginate, limit and cursor are left to the tool.
+func parseResultOptions(args map[string]any, paginate bool) (*resultOptions, error) {
+	opts := &resultOptions{}
+	given := false
+
+	if limit, ok := args["limit"].(float64); ok && paginate {
+		if limit < 1 || limit != float64(int(limit)) {
+			return nil, fmt.Errorf("limit must be a positive integer")
+		}
+		opts.limit = int(limit)
+		opts.paginate, given = true, true
+	}
+
+	opts.query = queryKey(args)
+	if cursor, ok := args["cursor"].(string); ok && cursor != "" && paginate {
+		offset, err := decodeCursor(cursor, opts.query)
+		if err != nil {
+			return nil, err
+		}
+		opts.offset = offset
+		opts.paginate, given = true, true
+	}
+
+	if globs, ok := args["path_glob"].(string); ok && globs != "" {
+		for _, glob := range strings.Split(globs, ",") {
+			glob = strings.TrimSpace(glob)
+			exclude := strings.HasPrefix(glob, "!")
+			glob = strings.TrimPrefix(glob, "!")
+			if glob == "" {
+				continue
+			}
+			re, err := globRegexp(glob)
+			if err != nil {
+				return nil, fmt.Errorf("invalid path_glob %q: %w", glob, err)
+			}
+			if exclude {
+				opts.exclude = append(opts.exclude, re)
+			} else {
+				opts.include = append(opts.include, re)
+			}
+		}
+		given = true
+	}
+
+	if fields, ok := args["fields"].(string); ok && fields != "" {
+		for _, field := range strings.Split(fields, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				opts.fields = append(opts.fields, strings.Split(field, "."))
+			}
+		}
+		given = true
+	}
+
+	if !given {
+		return nil, nil
+	}
+	return opts, nil
+}
+
+// apply shapes a decoded result. A list result is itself the list of items;
+// in an object result every top-level list is filtered and only the
+// designated one paginated, and without lists the object is projected.
+func (o *resultOptions) apply(value any) (any, *pageInfo) {
+	switch v := value.(type) {
+	case []any:
+		paginate := o.paginate && o.list == ""
+		items, total, more := o.shapeList(v, paginate)
+		if !paginate {
+			return items, nil
+		}
+		return items, o.page(total, more)
+
+	case map[string]any:
+		var page *pageInfo
+		lists := false
+		for key, field := range v {
+			list, ok := field.([]any)
+			if !ok {
+				continue
+			}
+			paginate := o.paginate && o.list != "" && key == o.list
+			items, total, more := o.shapeList(list, paginate)
+			v[key] = items
+			lists = true
+			if paginate {
+				page = o.page(total, more)
+			}
+		}
+		if !lists {
+			return o.project(v), nil
+		}
+		return v, page
+	}
+
+	return value, nil
+}
+
+// shapeList filters and projects items, paginating them if paginate is
+// set, and returns them with the number of items that passed the filter
+// and whether any follow the page
+func (o *resultOptions) shapeList(items []any, paginate bool) ([]any, int, bool) {
+	kept := []any{}
+	for _, item := range items {
+		if o.matches(item) {
+			kept = append(kept, item)
+		}
+	}
+	total := len(kept)
+
+	start, end := 0, total
+	if paginate {
+		start = min(o.offset, total)
+		if o.limit > 0 {
+			end = min(start+o.limit, total)
+		}
+	}
+
+	page := make([]any, 0, end-start)
+	for _, item := range kept[start:end] {
+		page = append(page, o.project(item))
+	}
+	return page, total, end < total
+}
+
+func (o *resultOptions) page(total int, more bool) *pageInfo {
+	page := &pageInfo{Total: total}
+	if more {
+		page.NextCursor = o.nextCursor()
+	}
+	return page
+}
+
+func (o *resultOptions) nextCursor() string {
+	return encodeCursor(o.offset+o.limit, o.query)
+}
+
+// matches reports whether item passes path_glob
+func (o *resultOptions) matches(item any) bool {
+	if len(o.include) == 0 && len(o.exclude) == 0 {
+		return true
+	}
+	path, ok := itemPath(item)
+	if !ok {
+		return true
+	}
+	path = filepath.ToSlash(path)
+
+	for _, re := range o.exclude {
+		if re.MatchString(path) {
+			return false
+		}
+	}
+	if len(o.include) == 0 {
+		return true
+	}
+	for _, re := range o.include {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// project keeps only the requested fields of an object item
+func (o *resultOptions) project(item any) any {
+	object, ok := item.(map[string]any)
+	if !ok || len(o.fields) == 0 {
+		return item
+	}
+
+	projected := make(map[string]any)
+	for _, field := range o.fields {
+		copyField(projected, object, field)
+	}
+	return projected
+}
+
+// copyField copies the value at the dotted path field from src to dst
+func copyField(dst, src map[string]any, field []string) {
+	value, ok := src[field[0]]
+	if !ok {
+		return
+	}
+	if len(field) == 1 {
+		dst[field[0]] = value
+		return
+	}
+
+	nested, ok := value.(map[string]any)
+	if !ok {
+		return
+	}
+	child, ok := dst[field[0]].(map[string]any)
+	if !ok {
+		child = make(map[string]any)
+		dst[field[0]] = child
+	}
+	copyField(child, nested, field[1:])
+}
+
+// itemPath finds the file an item is about in its own fields or, failing
+// that, in the objects nested in it such as its position
+func itemPath(item any) (string, bool) {
+	object, ok := item.(map[string]any)
+	if !ok {
+		return "", false
+	}
+
+	for _, key := range pathKeys {
+		if path, ok := object[key].(string); ok && path != "" && (key != "path" || filepath.IsAbs(path)) {
+			return path, true
+		}
+	}
+	for _, value := range object {
+		if nested, ok := value.(map[string]any); ok {
+			if path, ok := itemPath(nested); ok {
+				return path, true
+			}
+		}
+	}
+	return "", false
+}
+
+// globRegexp compiles a path glob. Relative globs match any trailing run of
+// path elements, so "*_test.go" matches test files anywhere.
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	if strings.HasPrefix(glob, "/") {
+		b.WriteString("^")
+	} else {
+		b.WriteString("(^|/)")
+	}
+
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// Cursors are opaque to clients but only encode the offset of the next page
+// and the query it belongs to, so that a cursor is not applied to a
+// different result
+const cursorPrefix = "offset:"
+
+func encodeCursor(offset int, query string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(offset) + ":" + query))
+}
+
+// decodeCursor returns the offset of cursor, failing unless it was issued
+// for query
+func decodeCursor(cursor, query string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil && bytes.HasPrefix(data, []byte(cursorPrefix)) {
+		number, key, _ := strings.Cut(string(data[len(cursorPrefix):]), ":")
+		if offset, err := strconv.Atoi(number); err == nil && offset >= 0 {
+			if key != query {
+				return 0, fmt.Errorf("cursor %q belongs to a different query; pass the same arguments as the call that returned it", cursor)
+			}
+			return offset, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid cursor %q", cursor)
+}
+
+// queryKey hashes every argument but limit and cursor, which may change
+// from page to page. Arguments marshal with their keys sorted, so equal
+// arguments give equal keys.
+func queryKey(args map[string]any) string {
+	query := make(map[string]any, len(args))
+	for key, value := range args {
+		if key != "limit" && key != "cursor" {
+			query[key] = value
+		}
+	}
+	data, _ := json.Marshal(query)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
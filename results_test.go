@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGlobRegexp(t *testing.T) {
+	tests := []struct {
+		glob  string
+		path  string
+		match bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "/repo/pkg/main.go", true},
+		{"*.go", "/repo/main.go.orig", false},
+		{"*_test.go", "/repo/pkg/diff_test.go", true},
+		{"*_test.go", "/repo/pkg/diff.go", false},
+		{"?.go", "/repo/a.go", true},
+		{"?.go", "/repo/ab.go", false},
+		{"pkg/*.go", "/repo/pkg/a.go", true},
+		{"pkg/*.go", "/repo/pkg/sub/a.go", false},
+		{"pkg/*.go", "/repo/mypkg/a.go", false},
+		{"internal/**", "/repo/internal/a.go", true},
+		{"internal/**", "/repo/internal/x/y/a.go", true},
+		{"internal/**", "/repo/internals/a.go", false},
+		{"**/*.go", "/repo/a.go", true},
+		{"**/*.go", "a.go", true},
+		{"pkg/**/a.go", "/repo/pkg/a.go", true},
+		{"pkg/**/a.go", "/repo/pkg/x/y/a.go", true},
+		{"pkg/**/a.go", "/repo/pkg/x/b.go", false},
+		{"/repo/*.go", "/repo/a.go", true},
+		{"/repo/*.go", "/repo/pkg/a.go", false},
+		{"/repo/*.go", "/other/repo/a.go", false},
+		{"/repo/**", "/repo/pkg/a.go", true},
+		{"/repo/**/*_test.go", "/repo/a_test.go", true},
+		{"/repo/**/*_test.go", "/repo/x/y/a_test.go", true},
+		{"/repo/**/*_test.go", "/repo/x/y/a.go", false},
+		{"a+b.go", "/repo/a+b.go", true},
+		{"a+b.go", "/repo/aab.go", false},
+	}
+
+	for _, tt := range tests {
+		re, err := globRegexp(tt.glob)
+		if err != nil {
+			t.Fatalf("globRegexp(%q) error = %v", tt.glob, err)
+		}
+		if got := re.MatchString(tt.path); got != tt.match {
+			t.Errorf("globRegexp(%q) matching %q = %v, want %v", tt.glob, tt.path, got, tt.match)
+		}
+	}
+}
+
+func TestCursor(t *testing.T) {
+	query := queryKey(map[string]any{"dir": "/src", "limit": float64(2)})
+	for _, offset := range []int{0, 1, 20, 1 << 30} {
+		got, err := decodeCursor(encodeCursor(offset, query), query)
+		if err != nil || got != offset {
+			t.Errorf("decodeCursor(encodeCursor(%d)) = %d, %v", offset, got, err)
+		}
+	}
+
+	// The page size may change between pages, but not the query
+	if other := queryKey(map[string]any{"dir": "/src", "cursor": "x"}); other != query {
+		t.Errorf("queryKey() depends on limit and cursor")
+	}
+	for _, args := range []map[string]any{
+		{"dir": "/other"},
+		{"dir": "/src", "path_glob": "*.go"},
+		{},
+	} {
+		if _, err := decodeCursor(encodeCursor(2, query), queryKey(args)); err == nil || !strings.Contains(err.Error(), "different query") {
+			t.Errorf("cursor reused with %v: error = %v, want a different query", args, err)
+		}
+	}
+
+	malformed := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "not a cursor!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte("offset:5:" + query))},
+		{"missing prefix", base64.RawURLEncoding.EncodeToString([]byte("5"))},
+		{"other prefix", base64.RawURLEncoding.EncodeToString([]byte("page:5"))},
+		{"no number", base64.RawURLEncoding.EncodeToString([]byte("offset:"))},
+		{"not a number", base64.RawURLEncoding.EncodeToString([]byte("offset:five"))},
+		{"negative", base64.RawURLEncoding.EncodeToString([]byte("offset:-1"))},
+		{"trailing data", base64.RawURLEncoding.EncodeToString([]byte("offset:5;x:" + query))},
+		{"no query", base64.RawURLEncoding.EncodeToString([]byte("offset:5"))},
+	}
+	for _, tt := range malformed {
+		t.Run(tt.name, func(t *testing.T) {
+			if offset, err := decodeCursor(tt.cursor, query); err == nil {
+				t.Errorf("decodeCursor(%q) = %d, want an error", tt.cursor, offset)
+			}
+		})
+	}
+}
+
+func TestPagination(t *testing.T) {
+	items := func(n int) []any {
+		list := make([]any, n)
+		for i := range list {
+			list[i] = map[string]any{"name": string(rune('a' + i))}
+		}
+		return list
+	}
+
+	// Every case has the same query, as it excludes limit and cursor
+	query := queryKey(nil)
+
+	tests := []struct {
+		name       string
+		args       map[string]any
+		list       string
+		value      any
+		wantNames  []string
+		wantTotal  int
+		wantCursor string
+	}{
+		{
+			name:       "first page",
+			args:       map[string]any{"limit": float64(2)},
+			value:      items(5),
+			wantNames:  []string{"a", "b"},
+			wantTotal:  5,
+			wantCursor: encodeCursor(2, query),
+		},
+		{
+			name:       "middle page",
+			args:       map[string]any{"limit": float64(2), "cursor": encodeCursor(2, query)},
+			value:      items(5),
+			wantNames:  []string{"c", "d"},
+			wantTotal:  5,
+			wantCursor: encodeCursor(4, query),
+		},
+		{
+			name:      "last page",
+			args:      map[string]any{"limit": float64(2), "cursor": encodeCursor(4, query)},
+			value:     items(5),
+			wantNames: []string{"e"},
+			wantTotal: 5,
+		},
+		{
+			name:      "cursor past the end",
+			args:      map[string]any{"limit": float64(2), "cursor": encodeCursor(10, query)},
+			value:     items(5),
+			wantNames: []string{},
+			wantTotal: 5,
+		},
+		{
+			name:      "cursor without limit",
+			args:      map[string]any{"cursor": encodeCursor(3, query)},
+			value:     items(5),
+			wantNames: []string{"d", "e"},
+			wantTotal: 5,
+		},
+		{
+			name:       "designated list of an object",
+			args:       map[string]any{"limit": float64(1)},
+			list:       "issues",
+			value:      map[string]any{"issues": items(3), "usages": items(3)},
+			wantNames:  []string{"a"},
+			wantTotal:  3,
+			wantCursor: encodeCursor(1, query),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := parseResultOptions(tt.args, true)
+			if err != nil {
+				t.Fatalf("parseResultOptions() error = %v", err)
+			}
+			opts.list = tt.list
+
+			shaped, page := opts.apply(tt.value)
+			list, ok := shaped.([]any)
+			if object, isObject := shaped.(map[string]any); isObject {
+				list, ok = object[tt.list].([]any)
+				if others := object["usages"].([]any); len(others) != 3 {
+					t.Errorf("other list has %d items, want all 3", len(others))
+				}
+			}
+			if !ok {
+				t.Fatalf("apply() = %#v, want a list", shaped)
+			}
+
+			names := []string{}
+			for _, item := range list {
+				names = append(names, item.(map[string]any)["name"].(string))
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("apply() items = %v, want %v", names, tt.wantNames)
+			}
+			if page == nil {
+				t.Fatalf("apply() returned no page")
+			}
+			if page.Total != tt.wantTotal || page.NextCursor != tt.wantCursor {
+				t.Errorf("apply() page = %+v, want total %d and cursor %q", *page, tt.wantTotal, tt.wantCursor)
+			}
+		})
+	}
+}
+
+func TestParseResultOptionsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args map[string]any
+	}{
+		{"zero limit", map[string]any{"limit": float64(0)}},
+		{"fractional limit", map[string]any{"limit": 1.5}},
+		{"malformed cursor", map[string]any{"cursor": "%%%"}},
+		{"cursor of another query", map[string]any{"cursor": encodeCursor(2, queryKey(nil)), "path_glob": "*.go"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseResultOptions(tt.args, true); err == nil {
+				t.Errorf("parseResultOptions(%v) succeeded, want an error", tt.args)
+			}
+		})
+	}
+
+	// Tools that paginate themselves keep their own limit
+	opts, err := parseResultOptions(map[string]any{"limit": float64(0)}, false)
+	if err != nil || opts != nil {
+		t.Errorf("parseResultOptions() without pagination = %v, %v, want no options", opts, err)
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// sandbox confines the paths tools are given to a set of allowed roots and,
+// in read-only mode, refuses tools that write files or run code. Without
+// roots, paths are unrestricted unless the session has its own root.
+type sandbox struct {
+	roots    []string // absolute, with symlinks resolved
+	readOnly bool
+}
+
+type pathResolverKey struct{}
+
+// pathResolver maps a path argument to the absolute path a tool should use,
+// failing for paths outside the sandbox
+type pathResolver func(path string) (string, error)
+
+// pathArguments are the tool arguments holding a single file system path
+var pathArguments = []string{"dir", "file", "path", "config"}
+
+// refusedFlags are go command flags that would leave the sandbox behind:
+// they change directory or hand the build or the test binary to another
+// program
+var refusedFlags = map[string]bool{"C": true, "exec": true, "toolexec": true}
+
+// pathFlags are go build and test flags, with or without their "test."
+// prefix, naming a file or directory the go command or test binary reads
+// or writes
+var pathFlags = map[string]bool{
+	"o": true, "modfile": true, "overlay": true, "pgo": true, "pkgdir": true,
+	"coverprofile": true, "cpuprofile": true, "memprofile": true, "blockprofile": true,
+	"mutexprofile": true, "trace": true, "outputdir": true, "gocoverdir": true,
+	"fuzzcachedir": true, "testlogfile": true,
+}
+
+// rootList is a repeatable -root flag
+type rootList []string
+
+func (r *rootList) String() string {
+	return strings.Join(*r, string(filepath.ListSeparator))
+}
+
+func (r *rootList) Set(value string) error {
+	*r = append(*r, value)
+	return nil
+}
+
+func newSandbox(roots []string, readOnly bool) (*sandbox, error) {
+	s := &sandbox{readOnly: readOnly}
+	for _, root := range roots {
+		if root == "" {
+			continue
+		}
+		resolved, err := resolveRoot(root)
+		if err != nil {
+			return nil, err
+		}
+		s.roots = append(s.roots, resolved)
+	}
+	return s, nil
+}
+
+// resolveRoot returns root as an absolute directory path with symlinks
+// resolved
+func resolveRoot(root string) (string, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return "", fmt.Errorf("invalid root %s: %w", root, err)
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", fmt.Errorf("invalid root %s: %w", root, err)
+	}
+	if info, err := os.Stat(resolved); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("root %s is not a directory", root)
+	}
+	return resolved, nil
+}
+
+// middleware enforces read-only mode, then resolves every path argument
+// against the session root (or the working directory) and checks it
+// against the allowed roots. Tools get the path with its symlinks resolved,
+// so that what they open is what was checked. For tools that take a dir,
+// it defaults to the base directory.
+func (s *sandbox) middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if reason := s.denied(request); reason != "" {
+			return mcp.NewToolResultError(fmt.Sprintf("%s is disabled in read-only mode: %s", request.Params.Name, reason)), nil
+		}
+
+		root, hasSession := sessionRoot(ctx)
+		if !hasSession && len(s.roots) == 0 {
+			return next(ctx, request)
+		}
+
+		base, roots, err := s.scope(root, hasSession)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		resolve := func(path string) (string, error) {
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(base, path)
+			}
+			return checkWithin(filepath.Clean(path), roots)
+		}
+
+		args, err := rewritePathArguments(request.GetArguments(), resolve)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if _, ok := args["dir"]; !ok && declares(request.Params.Name, "dir") {
+			args["dir"] = base
+		}
+		request.Params.Arguments = args
+
+		return next(context.WithValue(ctx, pathResolverKey{}, pathResolver(resolve)), request)
+	}
+}
+
+// scope returns the directory relative paths are resolved against and the
+// roots paths must stay within. A session root must itself be inside the
+// allowed roots and confines the session to it.
+func (s *sandbox) scope(sessionRoot string, hasSession bool) (string, []string, error) {
+	if hasSession {
+		if !filepath.IsAbs(sessionRoot) {
+			return "", nil, fmt.Errorf("session root %q is not an absolute path", sessionRoot)
+		}
+		resolved, err := resolveRoot(sessionRoot)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(s.roots) > 0 {
+			if _, err := checkWithin(resolved, s.roots); err != nil {
+				return "", nil, fmt.Errorf("session root: %w", err)
+			}
+		}
+		return resolved, []string{resolved}, nil
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	if resolved, err := checkWithin(cwd, s.roots); err == nil {
+		return resolved, s.roots, nil
+	}
+	return s.roots[0], s.roots, nil
+}
+
+// denied explains why a call is refused in read-only mode, or returns ""
+func (s *sandbox) denied(request mcp.CallToolRequest) string {
+	if !s.readOnly {
+		return ""
+	}
+
+	args := request.GetArguments()
+	dryRun, _ := args["dry_run"].(bool)
+	_, replacing := args["replacement"]
+	coverage, _ := args["coverage"].(bool)
+
+	switch request.Params.Name {
+	case "go_run", "go_test", "build_and_run_go":
+		return "it runs code"
+	case "write_range", "apply_edits", "apply_patch", "rename_symbol":
+		if !dryRun {
+			return "it writes files (dry_run is allowed)"
+		}
+	case "search_replace", "structural_replace":
+		if replacing && !dryRun {
+			return "replacing writes files (searching and dry_run are allowed)"
+		}
+	case "find_missing_tests", "analyze_tests":
+		if coverage {
+			return "coverage runs the tests"
+		}
+	}
+	return ""
+}
+
+// checkWithin returns path with the symlinks of its existing prefix
+// resolved, failing unless that lies within one of roots
+func checkWithin(path string, roots []string) (string, error) {
+	resolved, err := resolveExisting(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	for _, root := range roots {
+		if isWithin(root, resolved) {
+			return resolved, nil
+		}
+	}
+	if resolved != path {
+		return "", fmt.Errorf("%s (%s) is outside the allowed roots %s", path, resolved, strings.Join(roots, ", "))
+	}
+	return "", fmt.Errorf("%s is outside the allowed roots %s", path, strings.Join(roots, ", "))
+}
+
+// resolveExisting resolves the symlinks in the longest existing prefix of
+// the absolute path, so that files yet to be created are checked by the
+// directory they would be created in
+func resolveExisting(path string) (string, error) {
+	var missing []string
+	for p := path; ; p = filepath.Dir(p) {
+		resolved, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		if filepath.Dir(p) == p {
+			return path, nil
+		}
+		missing = append([]string{filepath.Base(p)}, missing...)
+	}
+}
+
+// resolverFromContext returns the sandbox's resolver for paths that are
+// not arguments, such as the files named in a patch
+func resolverFromContext(ctx context.Context) pathResolver {
+	if resolve, ok := ctx.Value(pathResolverKey{}).(pathResolver); ok {
+		return resolve
+	}
+	return func(path string) (string, error) {
+		return path, nil
+	}
+}
+
+// sandboxFlags checks the flags of a go command run in dir against the
+// sandbox, refusing refusedFlags and returning the flags with the value of
+// every path flag resolved like a path argument. Outside a sandbox flags
+// are returned as they are.
+func sandboxFlags(ctx context.Context, dir string, flags []string) ([]string, error) {
+	resolve, ok := ctx.Value(pathResolverKey{}).(pathResolver)
+	if !ok {
+		return flags, nil
+	}
+
+	checked := make([]string, 0, len(flags))
+	for i := 0; i < len(flags); i++ {
+		flag := flags[i]
+		if !strings.HasPrefix(flag, "-") {
+			checked = append(checked, flag)
+			continue
+		}
+		trimmed := strings.TrimLeft(flag, "-")
+		dashes := flag[:len(flag)-len(trimmed)]
+		name, value, hasValue := strings.Cut(trimmed, "=")
+		bare := strings.TrimPrefix(name, "test.")
+
+		if refusedFlags[bare] {
+			return nil, fmt.Errorf("flag %s%s is not allowed in the sandbox", dashes, name)
+		}
+		if !pathFlags[bare] {
+			checked = append(checked, flag)
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(flags) {
+				return nil, fmt.Errorf("flag %s%s needs a value", dashes, name)
+			}
+			i++
+			value = flags[i]
+		}
+		if bare == "pgo" && (value == "auto" || value == "off") {
+			checked = append(checked, dashes+name+"="+value)
+			continue
+		}
+
+		path := value
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		resolved, err := resolve(path)
+		if err != nil {
+			return nil, fmt.Errorf("flag %s%s: %w", dashes, name, err)
+		}
+		checked = append(checked, dashes+name+"="+resolved)
+	}
+	return checked, nil
+}
+
+// rewritePathArguments returns a copy of args with every path argument
+// passed through fn: the single paths, the comma-separated paths of
+// search_replace and the files of apply_edits
+func rewritePathArguments(args map[string]any, fn pathResolver) (map[string]any, error) {
+	rewritten := make(map[string]any, len(args)+1)
+	for key, value := range args {
+		rewritten[key] = value
+	}
+
+	for _, key := range pathArguments {
+		if path, ok := rewritten[key].(string); ok && path != "" {
+			resolved, err := fn(path)
+			if err != nil {
+				return nil, err
+			}
+			rewritten[key] = resolved
+		}
+	}
+
+	if list, ok := rewritten["paths"].(string); ok && list != "" {
+		paths := strings.Split(list, ",")
+		for i, path := range paths {
+			resolved, err := fn(strings.TrimSpace(path))
+			if err != nil {
+				return nil, err
+			}
+			paths[i] = resolved
+		}
+		rewritten["paths"] = strings.Join(paths, ",")
+	}
+
+	if edits, ok := rewritten["edits"].([]any); ok {
+		resolvedEdits := make([]any, len(edits))
+		for i, edit := range edits {
+			resolvedEdits[i] = edit
+			fields, ok := edit.(map[string]any)
+			if !ok {
+				continue
+			}
+			copied := make(map[string]any, len(fields))
+			for key, value := range fields {
+				copied[key] = value
+			}
+			if path, ok := copied["file"].(string); ok && path != "" {
+				resolved, err := fn(path)
+				if err != nil {
+					return nil, err
+				}
+				copied["file"] = resolved
+			}
+			resolvedEdits[i] = copied
+		}
+		rewritten["edits"] = resolvedEdits
+	}
+
+	return rewritten, nil
+}
@@ -0,0 +1,271 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// sandboxDirs makes a root holding a file and a link pointing out of it,
+// next to a directory outside it whose name shares the root's prefix
+func sandboxDirs(t *testing.T) (root, outside string) {
+	t.Helper()
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root = filepath.Join(dir, "root")
+	outside = filepath.Join(dir, "rootx")
+	for _, d := range []string{root, outside, filepath.Join(root, "sub")} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	touch(t, filepath.Join(root, "a.go"), "package a\n")
+	touch(t, filepath.Join(outside, "secret"), "secret\n")
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "sub"), filepath.Join(outside, "back")); err != nil {
+		t.Fatal(err)
+	}
+	return root, outside
+}
+
+func TestCheckWithin(t *testing.T) {
+	root, outside := sandboxDirs(t)
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{path: root, want: root},
+		{path: filepath.Join(root, "a.go"), want: filepath.Join(root, "a.go")},
+		// Files yet to be created are checked by their directory
+		{path: filepath.Join(root, "sub", "new", "b.go"), want: filepath.Join(root, "sub", "new", "b.go")},
+		{path: filepath.Join(outside, "back", "c.go"), want: filepath.Join(root, "sub", "c.go")},
+		{path: filepath.Join(outside, "secret"), wantErr: true},
+		{path: filepath.Join(root, "escape", "secret"), wantErr: true},
+		{path: filepath.Join(root, "escape", "missing"), wantErr: true},
+		{path: filepath.Dir(root), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := checkWithin(tt.path, []string{root})
+		if tt.wantErr {
+			if err == nil || !strings.Contains(err.Error(), "outside the allowed roots") {
+				t.Errorf("checkWithin(%s) = %s, %v; want it outside the roots", tt.path, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("checkWithin(%s) = %s, %v; want %s", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+func TestSandboxMiddleware(t *testing.T) {
+	root, outside := sandboxDirs(t)
+	toolArguments["sandbox_test"] = map[string]bool{"dir": true}
+	t.Cleanup(func() { delete(toolArguments, "sandbox_test") })
+
+	s, err := newSandbox([]string{root}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		session string // session root, if any
+		args    map[string]any
+		want    map[string]any
+		wantErr string
+	}{
+		{
+			name: "dir defaults to the base directory",
+			args: map[string]any{},
+			want: map[string]any{"dir": root},
+		},
+		{
+			name: "relative paths are resolved against the base directory",
+			args: map[string]any{"file": "a.go", "paths": "sub, a.go"},
+			want: map[string]any{
+				"dir":   root,
+				"file":  filepath.Join(root, "a.go"),
+				"paths": filepath.Join(root, "sub") + "," + filepath.Join(root, "a.go"),
+			},
+		},
+		{
+			name: "files of edits",
+			args: map[string]any{"dir": "sub", "edits": []any{map[string]any{"file": "a.go", "content": "x"}}},
+			want: map[string]any{
+				"dir":   filepath.Join(root, "sub"),
+				"edits": []any{map[string]any{"file": filepath.Join(root, "a.go"), "content": "x"}},
+			},
+		},
+		{
+			name:    "path outside the roots",
+			args:    map[string]any{"path": filepath.Join(outside, "secret")},
+			wantErr: "outside the allowed roots",
+		},
+		{
+			name:    "symlink out of the roots",
+			args:    map[string]any{"file": "escape/secret"},
+			wantErr: "outside the allowed roots",
+		},
+		{
+			name:    "edit outside the roots",
+			args:    map[string]any{"edits": []any{map[string]any{"file": "../rootx/secret"}}},
+			wantErr: "outside the allowed roots",
+		},
+		{
+			name:    "session root confines the session",
+			session: filepath.Join(root, "sub"),
+			args:    map[string]any{"file": "../a.go"},
+			wantErr: "outside the allowed roots",
+		},
+		{
+			name:    "session root within the roots",
+			session: filepath.Join(root, "sub"),
+			args:    map[string]any{"file": "b.go"},
+			want:    map[string]any{"dir": filepath.Join(root, "sub"), "file": filepath.Join(root, "sub", "b.go")},
+		},
+		{
+			name:    "session root outside the roots",
+			session: outside,
+			args:    map[string]any{},
+			wantErr: "session root",
+		},
+		{
+			name:    "relative session root",
+			session: "sub",
+			args:    map[string]any{},
+			wantErr: "not an absolute path",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got map[string]any
+			next := func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				got = request.GetArguments()
+				return mcp.NewToolResultText("ok"), nil
+			}
+			ctx := context.Background()
+			if tt.session != "" {
+				ctx = context.WithValue(ctx, sessionRootKey{}, tt.session)
+			}
+			var request mcp.CallToolRequest
+			request.Params.Name = "sandbox_test"
+			request.Params.Arguments = tt.args
+
+			result, err := s.middleware(next)(ctx, request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" {
+				if !result.IsError || !strings.Contains(resultText(result), tt.wantErr) {
+					t.Errorf("result = %q, want an error containing %q", resultText(result), tt.wantErr)
+				}
+				return
+			}
+			if result.IsError {
+				t.Fatalf("result = %q", resultText(result))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("arguments = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSandboxDenied(t *testing.T) {
+	s := &sandbox{readOnly: true}
+	tests := []struct {
+		tool   string
+		args   map[string]any
+		denied bool
+	}{
+		{"go_test", map[string]any{}, true},
+		{"write_range", map[string]any{}, true},
+		{"write_range", map[string]any{"dry_run": true}, false},
+		{"search_replace", map[string]any{"pattern": "x"}, false},
+		{"search_replace", map[string]any{"pattern": "x", "replacement": "y"}, true},
+		{"analyze_tests", map[string]any{"coverage": true}, true},
+		{"find_symbols", map[string]any{}, false},
+	}
+
+	for _, tt := range tests {
+		var request mcp.CallToolRequest
+		request.Params.Name = tt.tool
+		request.Params.Arguments = tt.args
+		if got := s.denied(request) != ""; got != tt.denied {
+			t.Errorf("denied(%s %v) = %v, want %v", tt.tool, tt.args, got, tt.denied)
+		}
+	}
+}
+
+func TestSandboxFlags(t *testing.T) {
+	root, outside := sandboxDirs(t)
+	resolve := pathResolver(func(path string) (string, error) {
+		return checkWithin(filepath.Clean(path), []string{root})
+	})
+	ctx := context.WithValue(context.Background(), pathResolverKey{}, resolve)
+	dir := filepath.Join(root, "sub")
+
+	tests := []struct {
+		flags   string
+		want    string
+		wantErr string
+	}{
+		{flags: "-v -race -run TestX -count=1", want: "-v -race -run TestX -count=1"},
+		{flags: "-coverprofile=c.out", want: "-coverprofile=" + filepath.Join(dir, "c.out")},
+		{flags: "-o ../bin/t -v", want: "-o=" + filepath.Join(root, "bin", "t") + " -v"},
+		{flags: "--test.cpuprofile=" + filepath.Join(root, "cpu"), want: "--test.cpuprofile=" + filepath.Join(root, "cpu")},
+		{flags: "-pgo=auto", want: "-pgo=auto"},
+		{flags: "-coverprofile=" + filepath.Join(outside, "c.out"), wantErr: "outside the allowed roots"},
+		{flags: "-trace ../../rootx/t", wantErr: "outside the allowed roots"},
+		{flags: "-modfile=../escape/go.mod", wantErr: "outside the allowed roots"},
+		{flags: "-o", wantErr: "needs a value"},
+		{flags: "-C " + outside, wantErr: "not allowed"},
+		{flags: "-exec=/bin/sh", wantErr: "not allowed"},
+		{flags: "-toolexec env", wantErr: "not allowed"},
+	}
+
+	for _, tt := range tests {
+		got, err := sandboxFlags(ctx, dir, strings.Fields(tt.flags))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("sandboxFlags(%q) = %q, %v; want an error containing %q", tt.flags, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || strings.Join(got, " ") != tt.want {
+			t.Errorf("sandboxFlags(%q) = %q, %v; want %q", tt.flags, got, err, tt.want)
+		}
+	}
+
+	// Outside a sandbox flags are left alone
+	flags := []string{"-C", outside, "-o", "/tmp/t"}
+	if got, err := sandboxFlags(context.Background(), dir, flags); err != nil || !reflect.DeepEqual(got, flags) {
+		t.Errorf("sandboxFlags() without a sandbox = %q, %v; want %q", got, err, flags)
+	}
+}
+
+func resultText(result *mcp.CallToolResult) string {
+	var text []string
+	for _, content := range result.Content {
+		if c, ok := content.(mcp.TextContent); ok {
+			text = append(text, c.Text)
+		}
+	}
+	return strings.Join(text, "\n")
+}
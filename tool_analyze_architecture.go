@@ -1,10 +1,18 @@
 package main
 
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
 // Architecture analysis types
 type ArchitectureInfo struct {
-	Layers       []LayerInfo       `json:"layers"`
-	Violations   []LayerViolation  `json:"violations,omitempty"`
-	Suggestions  []string          `json:"suggestions,omitempty"`
+	Config      string           `json:"config,omitempty"`
+	Layers      []LayerInfo      `json:"layers"`
+	Violations  []LayerViolation `json:"violations,omitempty"`
+	Suggestions []string         `json:"suggestions,omitempty"`
 }
 
 type LayerInfo struct {
@@ -14,32 +22,160 @@ type LayerInfo struct {
 }
 
 type LayerViolation struct {
-	From        string   `json:"from"`
-	To          string   `json:"to"`
-	Violation   string   `json:"violation"`
-	Position    Position `json:"position"`
+	From      string   `json:"from"`
+	To        string   `json:"to"`
+	Rule      string   `json:"rule"`
+	Violation string   `json:"violation"`
+	Position  Position `json:"position"`
 }
 
-func analyzeArchitecture(dir string) (*ArchitectureInfo, error) {
-	// Simplified architecture analysis
-	packages, err := listPackages(dir, false)
+// analyzeArchitecture checks every import under dir against the layers and
+// import rules in the architecture section of the repository config. Without
+// layers each package is reported as a layer of its own.
+func analyzeArchitecture(ctx context.Context, dir, configPath string, includeTests bool) (*ArchitectureInfo, error) {
+	config, path, err := loadConfig(dir, configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	graph, err := buildImportGraph(ctx, dir, includeTests)
 	if err != nil {
 		return nil, err
 	}
 
 	arch := &ArchitectureInfo{
+		Config: path,
 		Layers: []LayerInfo{},
 	}
+	rules := config.Architecture
+
+	if len(rules.Layers) == 0 {
+		for _, pkgPath := range graph.sortedPackages() {
+			layer := LayerInfo{
+				Name:         graph.packages[pkgPath].name,
+				Packages:     []string{pkgPath},
+				Dependencies: []string{},
+			}
+			for _, edge := range graph.packages[pkgPath].sortedImports() {
+				layer.Dependencies = append(layer.Dependencies, edge.to)
+			}
+			arch.Layers = append(arch.Layers, layer)
+		}
+		if path == "" {
+			arch.Suggestions = append(arch.Suggestions, "Add an architecture section with layers and rules to .gocp.yaml to check dependency directions")
+		}
+	}
+
+	// Layers only ever hold packages of the module itself
+	layerOf := func(pkg string) *layerConfig {
+		if classifyImport(pkg, graph.module) != importInternal {
+			return nil
+		}
+		for i := range rules.Layers {
+			if matchAnyPattern(rules.Layers[i].Packages, strings.TrimSuffix(pkg, "_test"), graph.module) {
+				return &rules.Layers[i]
+			}
+		}
+		return nil
+	}
+
+	layerPackages := make(map[string][]string)
+	layerDeps := make(map[string]map[string]bool)
+	var unassigned []string
+
+	for _, pkgPath := range graph.sortedPackages() {
+		node := graph.packages[pkgPath]
+		from := layerOf(pkgPath)
+		if from != nil {
+			layerPackages[from.Name] = append(layerPackages[from.Name], pkgPath)
+		} else if len(rules.Layers) > 0 {
+			unassigned = append(unassigned, pkgPath)
+		}
+
+		for _, edge := range node.sortedImports() {
+			violation := func(rule, message string) {
+				arch.Violations = append(arch.Violations, LayerViolation{
+					From:      pkgPath,
+					To:        edge.to,
+					Rule:      rule,
+					Violation: message,
+					Position:  newPosition(edge.pos),
+				})
+			}
+
+			if to := layerOf(edge.to); from != nil && to != nil && to != from {
+				if layerDeps[from.Name] == nil {
+					layerDeps[from.Name] = make(map[string]bool)
+				}
+				layerDeps[from.Name][to.Name] = true
+
+				switch {
+				case contains(from.MayNotImport, to.Name):
+					violation("layer "+from.Name, fmt.Sprintf("layer %q may not import layer %q", from.Name, to.Name))
+				case from.MayImport != nil && !contains(from.MayImport, to.Name):
+					violation("layer "+from.Name, fmt.Sprintf("layer %q may only import %s, not layer %q", from.Name, layerList(from.MayImport), to.Name))
+				}
+			}
+
+			for i, rule := range rules.Rules {
+				name := rule.Description
+				if name == "" {
+					name = fmt.Sprintf("rule %d", i+1)
+				}
+
+				if len(rule.Deny) > 0 {
+					if (len(rule.From) == 0 || matchAnyPattern(rule.From, pkgPath, graph.module)) && matchAnyPattern(rule.Deny, edge.to, graph.module) {
+						violation(name, fmt.Sprintf("%s may not import %s", pkgPath, edge.to))
+					}
+					continue
+				}
+
+				// Packages inside the restricted set may import each other
+				if matchAnyPattern(rule.Imports, edge.to, graph.module) &&
+					!matchAnyPattern(rule.Only, pkgPath, graph.module) &&
+					!matchAnyPattern(rule.Imports, pkgPath, graph.module) {
+					violation(name, fmt.Sprintf("only %s may import %s", strings.Join(rule.Only, ", "), edge.to))
+				}
+			}
+		}
+	}
 
-	// Detect common Go project structure
-	for _, pkg := range packages {
-		layer := LayerInfo{
-			Name:         pkg.Name,
-			Packages:     []string{pkg.ImportPath},
-			Dependencies: pkg.Imports,
+	for _, layer := range rules.Layers {
+		info := LayerInfo{
+			Name:         layer.Name,
+			Packages:     layerPackages[layer.Name],
+			Dependencies: []string{},
+		}
+		if info.Packages == nil {
+			info.Packages = []string{}
+			arch.Suggestions = append(arch.Suggestions, fmt.Sprintf("Layer %q matches no packages", layer.Name))
+		}
+		for dep := range layerDeps[layer.Name] {
+			info.Dependencies = append(info.Dependencies, dep)
 		}
-		arch.Layers = append(arch.Layers, layer)
+		sort.Strings(info.Dependencies)
+		for _, dep := range info.Dependencies {
+			if layer.Name < dep && layerDeps[dep][layer.Name] {
+				arch.Suggestions = append(arch.Suggestions, fmt.Sprintf("Layers %q and %q import each other; one direction should be forbidden", layer.Name, dep))
+			}
+		}
+		arch.Layers = append(arch.Layers, info)
+	}
+
+	if len(unassigned) > 0 {
+		arch.Suggestions = append(arch.Suggestions, fmt.Sprintf("%d packages belong to no layer: %s", len(unassigned), strings.Join(unassigned, ", ")))
 	}
 
 	return arch, nil
-}
\ No newline at end of file
+}
+
+func layerList(names []string) string {
+	if len(names) == 0 {
+		return "no other layer"
+	}
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = fmt.Sprintf("%q", name)
+	}
+	return "layers " + strings.Join(quoted, ", ")
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
 )
@@ -25,13 +26,13 @@ type ChannelIssue struct {
 	Position    Position `json:"position"`
 }
 
-func analyzeChannels(dir string) (*ChannelAnalysis, error) {
+func analyzeChannels(ctx context.Context, dir string) (*ChannelAnalysis, error) {
 	analysis := &ChannelAnalysis{
 		Channels: []ChannelUsage{},
 		Issues:   []ChannelIssue{},
 	}
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		// Track channel variables
 		channelVars := make(map[string]*ChannelInfo)
 		
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Complexity analysis types
+type ComplexityReport struct {
+	Functions  []FunctionComplexity `json:"functions"`
+	Packages   []PackageComplexity  `json:"packages"`
+	Thresholds ComplexityThresholds `json:"thresholds"`
+}
+
+type FunctionComplexity struct {
+	Function   string   `json:"function"`
+	Package    string   `json:"package"`
+	Cyclomatic int      `json:"cyclomatic"`
+	Cognitive  int      `json:"cognitive"`
+	Nesting    int      `json:"nesting"`
+	Params     int      `json:"params"`
+	Length     int      `json:"length"`
+	Exceeds    []string `json:"exceeds,omitempty"`
+	Position   Position `json:"position"`
+}
+
+type PackageComplexity struct {
+	Package       string  `json:"package"`
+	Dir           string  `json:"dir"`
+	Functions     int     `json:"functions"`
+	AvgCyclomatic float64 `json:"avg_cyclomatic"`
+	MaxCyclomatic int     `json:"max_cyclomatic"`
+	AvgCognitive  float64 `json:"avg_cognitive"`
+	MaxCognitive  int     `json:"max_cognitive"`
+	TotalLength   int     `json:"total_length"`
+	Exceeding     int     `json:"exceeding"`
+}
+
+// ComplexityThresholds are the maximum acceptable values; zero disables a
+// threshold
+type ComplexityThresholds struct {
+	Cyclomatic int `json:"cyclomatic"`
+	Cognitive  int `json:"cognitive"`
+	Nesting    int `json:"nesting"`
+	Params     int `json:"params"`
+	Length     int `json:"length"`
+}
+
+var defaultComplexityThresholds = ComplexityThresholds{
+	Cyclomatic: 10,
+	Cognitive:  15,
+	Nesting:    4,
+	Params:     5,
+	Length:     60,
+}
+
+func analyzeComplexity(ctx context.Context, dir string, thresholds ComplexityThresholds, sortBy string, onlyExceeding, includeTests bool, limit int) (*ComplexityReport, error) {
+	less, err := complexityOrder(sortBy)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ComplexityReport{
+		Functions:  []FunctionComplexity{},
+		Packages:   []PackageComplexity{},
+		Thresholds: thresholds,
+	}
+
+	packages := make(map[string]*PackageComplexity)
+	var all []FunctionComplexity
+
+	err = walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+		if !includeTests && strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+
+		pkgKey := filepath.Dir(path) + ":" + file.Name.Name
+		pkg := packages[pkgKey]
+		if pkg == nil {
+			pkg = &PackageComplexity{Package: file.Name.Name, Dir: filepath.Dir(path)}
+			packages[pkgKey] = pkg
+		}
+
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+
+			metrics := measureFunction(fn, fset)
+			metrics.Package = file.Name.Name
+			metrics.Exceeds = thresholds.exceeded(metrics)
+
+			pkg.Functions++
+			pkg.AvgCyclomatic += float64(metrics.Cyclomatic)
+			pkg.MaxCyclomatic = max(pkg.MaxCyclomatic, metrics.Cyclomatic)
+			pkg.AvgCognitive += float64(metrics.Cognitive)
+			pkg.MaxCognitive = max(pkg.MaxCognitive, metrics.Cognitive)
+			pkg.TotalLength += metrics.Length
+			if len(metrics.Exceeds) > 0 {
+				pkg.Exceeding++
+			}
+
+			all = append(all, metrics)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pkg := range packages {
+		if pkg.Functions == 0 {
+			continue
+		}
+		pkg.AvgCyclomatic /= float64(pkg.Functions)
+		pkg.AvgCognitive /= float64(pkg.Functions)
+		report.Packages = append(report.Packages, *pkg)
+	}
+	sort.Slice(report.Packages, func(i, j int) bool {
+		if report.Packages[i].Dir != report.Packages[j].Dir {
+			return report.Packages[i].Dir < report.Packages[j].Dir
+		}
+		return report.Packages[i].Package < report.Packages[j].Package
+	})
+
+	for _, metrics := range all {
+		if !onlyExceeding || len(metrics.Exceeds) > 0 {
+			report.Functions = append(report.Functions, metrics)
+		}
+	}
+	sort.SliceStable(report.Functions, func(i, j int) bool {
+		return less(report.Functions[i], report.Functions[j])
+	})
+	if limit > 0 && len(report.Functions) > limit {
+		report.Functions = report.Functions[:limit]
+	}
+
+	return report, nil
+}
+
+func complexityOrder(sortBy string) (func(a, b FunctionComplexity) bool, error) {
+	metric := map[string]func(FunctionComplexity) int{
+		"cyclomatic": func(f FunctionComplexity) int { return f.Cyclomatic },
+		"cognitive":  func(f FunctionComplexity) int { return f.Cognitive },
+		"nesting":    func(f FunctionComplexity) int { return f.Nesting },
+		"params":     func(f FunctionComplexity) int { return f.Params },
+		"length":     func(f FunctionComplexity) int { return f.Length },
+	}
+
+	switch sortBy {
+	case "name":
+		return func(a, b FunctionComplexity) bool {
+			return a.Package+"."+a.Function < b.Package+"."+b.Function
+		}, nil
+	case "position":
+		return func(a, b FunctionComplexity) bool {
+			if a.Position.File != b.Position.File {
+				return a.Position.File < b.Position.File
+			}
+			return a.Position.Offset < b.Position.Offset
+		}, nil
+	}
+
+	value, ok := metric[sortBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort %q (want cyclomatic, cognitive, nesting, params, length, name or position)", sortBy)
+	}
+	return func(a, b FunctionComplexity) bool {
+		return value(a) > value(b)
+	}, nil
+}
+
+func (t ComplexityThresholds) exceeded(f FunctionComplexity) []string {
+	var exceeded []string
+	check := func(name string, value, limit int) {
+		if limit > 0 && value > limit {
+			exceeded = append(exceeded, name)
+		}
+	}
+	check("cyclomatic", f.Cyclomatic, t.Cyclomatic)
+	check("cognitive", f.Cognitive, t.Cognitive)
+	check("nesting", f.Nesting, t.Nesting)
+	check("params", f.Params, t.Params)
+	check("length", f.Length, t.Length)
+	return exceeded
+}
+
+// measureFunction computes the complexity metrics of fn; function literals
+// count towards the function declaring them
+func measureFunction(fn *ast.FuncDecl, fset *token.FileSet) FunctionComplexity {
+	metrics := FunctionComplexity{
+		Function:   funcDeclName(fn),
+		Cyclomatic: cyclomaticComplexity(fn),
+		Length:     fset.Position(fn.End()).Line - fset.Position(fn.Pos()).Line + 1,
+		Position:   newPosition(fset.Position(fn.Pos())),
+	}
+
+	for _, field := range fn.Type.Params.List {
+		metrics.Params += max(len(field.Names), 1)
+	}
+
+	walker := &cognitiveWalker{name: fn.Name.Name}
+	if fn.Recv != nil && len(fn.Recv.List) > 0 && len(fn.Recv.List[0].Names) > 0 {
+		walker.receiver = fn.Recv.List[0].Names[0].Name
+	}
+	if fn.Body != nil {
+		walker.visit(fn.Body, 0)
+	}
+	metrics.Cognitive = walker.score
+	metrics.Nesting = walker.maxNesting
+
+	return metrics
+}
+
+// cyclomaticComplexity counts the independent paths through fn: one plus
+// each branch point and short-circuit operator
+func cyclomaticComplexity(fn *ast.FuncDecl) int {
+	complexity := 1
+	if fn.Body == nil {
+		return complexity
+	}
+
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt:
+			complexity++
+		case *ast.CaseClause:
+			if node.List != nil {
+				complexity++
+			}
+		case *ast.CommClause:
+			if node.Comm != nil {
+				complexity++
+			}
+		case *ast.BinaryExpr:
+			if node.Op == token.LAND || node.Op == token.LOR {
+				complexity++
+			}
+		}
+		return true
+	})
+
+	return complexity
+}
+
+// cognitiveWalker scores cognitive complexity as specified by SonarSource:
+// each break in linear flow costs one, plus its nesting level for
+// structures that nest; each run of like boolean operators costs one
+type cognitiveWalker struct {
+	name       string
+	receiver   string
+	score      int
+	maxNesting int
+}
+
+func (w *cognitiveWalker) visit(node ast.Node, nesting int) {
+	switch n := node.(type) {
+	case *ast.IfStmt:
+		w.score += 1 + nesting
+		w.ifStmt(n, nesting)
+		return
+
+	case *ast.ForStmt:
+		w.score += 1 + nesting
+		w.visitAll(nesting, n.Init, n.Cond, n.Post)
+		w.nested(n.Body, nesting)
+		return
+
+	case *ast.RangeStmt:
+		w.score += 1 + nesting
+		w.visitAll(nesting, n.X)
+		w.nested(n.Body, nesting)
+		return
+
+	case *ast.SwitchStmt:
+		w.score += 1 + nesting
+		w.visitAll(nesting, n.Init, n.Tag)
+		w.nested(n.Body, nesting)
+		return
+
+	case *ast.TypeSwitchStmt:
+		w.score += 1 + nesting
+		w.visitAll(nesting, n.Init, n.Assign)
+		w.nested(n.Body, nesting)
+		return
+
+	case *ast.SelectStmt:
+		w.score += 1 + nesting
+		w.nested(n.Body, nesting)
+		return
+
+	case *ast.FuncLit:
+		w.nested(n.Body, nesting)
+		return
+
+	case *ast.BranchStmt:
+		if n.Tok == token.GOTO || n.Label != nil {
+			w.score++
+		}
+
+	case *ast.BinaryExpr:
+		if n.Op == token.LAND || n.Op == token.LOR {
+			w.logical(n, nesting)
+			return
+		}
+
+	case *ast.CallExpr:
+		if w.isRecursive(n) {
+			w.score++
+		}
+	}
+
+	w.children(node, nesting)
+}
+
+func (w *cognitiveWalker) ifStmt(n *ast.IfStmt, nesting int) {
+	w.visitAll(nesting, n.Init, n.Cond)
+	w.nested(n.Body, nesting)
+
+	switch els := n.Else.(type) {
+	case *ast.IfStmt:
+		// else if costs one but no nesting increment
+		w.score++
+		w.ifStmt(els, nesting)
+	case *ast.BlockStmt:
+		w.score++
+		w.nested(els, nesting)
+	}
+}
+
+// nested visits the body of a structure one level deeper
+func (w *cognitiveWalker) nested(body ast.Node, nesting int) {
+	w.maxNesting = max(w.maxNesting, nesting+1)
+	w.visit(body, nesting+1)
+}
+
+func (w *cognitiveWalker) visitAll(nesting int, nodes ...ast.Node) {
+	for _, node := range nodes {
+		if node != nil {
+			w.visit(node, nesting)
+		}
+	}
+}
+
+// children visits the direct children of node at the same nesting level
+func (w *cognitiveWalker) children(node ast.Node, nesting int) {
+	ast.Inspect(node, func(child ast.Node) bool {
+		if child == node {
+			return true
+		}
+		if child != nil {
+			w.visit(child, nesting)
+		}
+		return false
+	})
+}
+
+// logical scores a tree of && and || operators by the number of runs of the
+// same operator in source order, so a && b && c costs one and a && b || c two
+func (w *cognitiveWalker) logical(expr ast.Expr, nesting int) {
+	var ops []token.Token
+	var flatten func(e ast.Expr)
+	flatten = func(e ast.Expr) {
+		inner := e
+		for {
+			paren, ok := inner.(*ast.ParenExpr)
+			if !ok {
+				break
+			}
+			inner = paren.X
+		}
+		if bin, ok := inner.(*ast.BinaryExpr); ok && (bin.Op == token.LAND || bin.Op == token.LOR) {
+			flatten(bin.X)
+			ops = append(ops, bin.Op)
+			flatten(bin.Y)
+			return
+		}
+		w.visit(e, nesting)
+	}
+	flatten(expr)
+
+	for i, op := range ops {
+		if i == 0 || op != ops[i-1] {
+			w.score++
+		}
+	}
+}
+
+func (w *cognitiveWalker) isRecursive(call *ast.CallExpr) bool {
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		return w.receiver == "" && fun.Name == w.name
+	case *ast.SelectorExpr:
+		recv, ok := fun.X.(*ast.Ident)
+		return ok && w.receiver != "" && recv.Name == w.receiver && fun.Sel.Name == w.name
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestMeasureFunction(t *testing.T) {
+	tests := []struct {
+		name       string
+		src        string
+		cyclomatic int
+		cognitive  int
+		nesting    int
+		params     int
+	}{
+		{
+			name:       "straight line",
+			src:        "func f(a, b int, c string) int { return a + b }",
+			cyclomatic: 1,
+			params:     3,
+		},
+		{
+			name:       "if else chain",
+			src:        "func f(x int) int {\n\tif x > 0 {\n\t\treturn 1\n\t} else if x < 0 {\n\t\treturn -1\n\t} else {\n\t\treturn 0\n\t}\n}",
+			cyclomatic: 3,
+			cognitive:  3,
+			nesting:    1,
+			params:     1,
+		},
+		{
+			name:       "nesting costs more",
+			src:        "func f(xs []int) {\n\tfor _, x := range xs {\n\t\tif x > 0 {\n\t\t\tfor {\n\t\t\t}\n\t\t}\n\t}\n}",
+			cyclomatic: 4,
+			cognitive:  6, // 1 + 2 + 3
+			nesting:    3,
+			params:     1,
+		},
+		{
+			name:       "runs of boolean operators",
+			src:        "func f(a, b, c, d bool) bool { return a && b && c || d }",
+			cyclomatic: 4,
+			cognitive:  2,
+			params:     4,
+		},
+		{
+			name:       "switch cases and default",
+			src:        "func f(x int) {\n\tswitch x {\n\tcase 1:\n\tcase 2, 3:\n\tdefault:\n\t}\n}",
+			cyclomatic: 3,
+			cognitive:  1,
+			nesting:    1,
+			params:     1,
+		},
+		{
+			name:       "select",
+			src:        "func f(c chan int) {\n\tselect {\n\tcase <-c:\n\tdefault:\n\t}\n}",
+			cyclomatic: 2,
+			cognitive:  1,
+			nesting:    1,
+			params:     1,
+		},
+		{
+			name:       "recursion and labelled break",
+			src:        "func f(n int) int {\nouter:\n\tfor {\n\t\tbreak outer\n\t}\n\treturn f(n - 1)\n}",
+			cyclomatic: 2,
+			cognitive:  3,
+			nesting:    1,
+			params:     1,
+		},
+		{
+			name:       "function literals nest",
+			src:        "func f() {\n\tgo func() {\n\t\tif true {\n\t\t}\n\t}()\n}",
+			cyclomatic: 2,
+			cognitive:  2,
+			nesting:    2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, "a.go", "package a\n\n"+tt.src+"\n", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := measureFunction(file.Decls[0].(*ast.FuncDecl), fset)
+
+			if got.Cyclomatic != tt.cyclomatic || got.Cognitive != tt.cognitive || got.Nesting != tt.nesting || got.Params != tt.params {
+				t.Errorf("measureFunction() cyclomatic %d, cognitive %d, nesting %d, params %d; want %d, %d, %d, %d",
+					got.Cyclomatic, got.Cognitive, got.Nesting, got.Params, tt.cyclomatic, tt.cognitive, tt.nesting, tt.params)
+			}
+		})
+	}
+}
+
+func TestComplexityThresholdsExceeded(t *testing.T) {
+	thresholds := ComplexityThresholds{Cyclomatic: 10, Nesting: 4}
+	f := FunctionComplexity{Cyclomatic: 11, Cognitive: 100, Nesting: 4, Params: 9, Length: 500}
+
+	got := thresholds.exceeded(f)
+	if len(got) != 1 || got[0] != "cyclomatic" {
+		t.Errorf("exceeded() = %v, want [cyclomatic]", got)
+	}
+}
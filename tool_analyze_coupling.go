@@ -1,39 +1,220 @@
 package main
 
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
 // Coupling analysis types
 type CouplingInfo struct {
-	Package        string            `json:"package"`
-	Afferent       int               `json:"afferent"`
-	Efferent       int               `json:"efferent"`
-	Instability    float64           `json:"instability"`
-	Dependencies   []string          `json:"dependencies"`
-	Dependents     []string          `json:"dependents"`
-	Suggestions    []string          `json:"suggestions,omitempty"`
+	Package       string   `json:"package"`
+	Name          string   `json:"name"`
+	Afferent      int      `json:"afferent"`
+	Efferent      int      `json:"efferent"`
+	Instability   float64  `json:"instability"`
+	Interfaces    int      `json:"interfaces"`
+	ConcreteTypes int      `json:"concrete_types"`
+	Abstractness  float64  `json:"abstractness"`
+	Distance      float64  `json:"distance"`
+	Zone          string   `json:"zone"`
+	Dependencies  []string `json:"dependencies"`
+	Dependents    []string `json:"dependents"`
+	Suggestions   []string `json:"suggestions,omitempty"`
 }
 
-func analyzeCoupling(dir string) ([]CouplingInfo, error) {
-	var coupling []CouplingInfo
+// Packages further than this from the main sequence (A + I = 1) are in the
+// zone of pain (stable and concrete) or of uselessness (abstract and unstable)
+const (
+	zoneDistance      = 0.5
+	highEfferent      = 10
+	maxSuggestedTypes = 3
+)
+
+// analyzeCoupling computes Robert Martin's package metrics over the import
+// graph of the module packages under dir, most distant from the main
+// sequence first
+func analyzeCoupling(ctx context.Context, dir string) ([]CouplingInfo, error) {
+	graph, err := buildImportGraph(ctx, dir, false)
+	if err != nil {
+		return nil, err
+	}
 
-	// This is a simplified implementation
-	packages, err := listPackages(dir, false)
+	// Count declared types per package, remembering exported names for
+	// suggestions
+	type typeCounts struct {
+		interfaces, concrete          []string
+		interfaceCount, concreteCount int
+	}
+	counts := make(map[string]*typeCounts)
+	byDir := make(map[string]string)
+	for path, node := range graph.packages {
+		byDir[node.dir] = path
+		counts[path] = &typeCounts{}
+	}
+
+	err = walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+		pkgPath, ok := byDir[filepath.Dir(path)]
+		if !ok || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		c := counts[pkgPath]
+
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if ts.Assign.IsValid() {
+					continue
+				}
+				if _, ok := ts.Type.(*ast.InterfaceType); ok {
+					c.interfaceCount++
+					if ts.Name.IsExported() {
+						c.interfaces = append(c.interfaces, ts.Name.Name)
+					}
+				} else {
+					c.concreteCount++
+					if ts.Name.IsExported() {
+						c.concrete = append(c.concrete, ts.Name.Name)
+					}
+				}
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	for _, pkg := range packages {
+	cycles := make(map[string][]string)
+	for _, component := range graph.components() {
+		if len(component) > 1 {
+			for _, path := range component {
+				cycles[path] = component
+			}
+		}
+	}
+
+	dependents := make(map[string][]string)
+	for _, path := range graph.sortedPackages() {
+		for _, edge := range graph.packages[path].sortedImports() {
+			if _, ok := graph.packages[edge.to]; ok {
+				dependents[edge.to] = append(dependents[edge.to], path)
+			}
+		}
+	}
+
+	coupling := []CouplingInfo{}
+	for _, path := range graph.sortedPackages() {
+		node := graph.packages[path]
+		c := counts[path]
+
 		info := CouplingInfo{
-			Package:      pkg.Name,
-			Dependencies: pkg.Imports,
-			Efferent:     len(pkg.Imports),
+			Package:       path,
+			Name:          node.name,
+			Interfaces:    c.interfaceCount,
+			ConcreteTypes: c.concreteCount,
+			Dependencies:  []string{},
+			Dependents:    dependents[path],
+		}
+		if info.Dependents == nil {
+			info.Dependents = []string{}
+		}
+		for _, edge := range node.sortedImports() {
+			if _, ok := graph.packages[edge.to]; ok {
+				info.Dependencies = append(info.Dependencies, edge.to)
+			}
 		}
 
-		// Calculate instability (Ce / (Ca + Ce))
+		info.Afferent = len(info.Dependents)
+		info.Efferent = len(info.Dependencies)
+
+		// Instability = Ce / (Ca + Ce)
 		if info.Afferent+info.Efferent > 0 {
 			info.Instability = float64(info.Efferent) / float64(info.Afferent+info.Efferent)
 		}
+		// Abstractness = interfaces / all declared types
+		if total := c.interfaceCount + c.concreteCount; total > 0 {
+			info.Abstractness = float64(c.interfaceCount) / float64(total)
+		}
+		// Distance from the main sequence D = |A + I - 1|
+		info.Distance = info.Abstractness + info.Instability - 1
+		if info.Distance < 0 {
+			info.Distance = -info.Distance
+		}
+
+		switch {
+		case info.Afferent+info.Efferent == 0:
+			info.Zone = "isolated"
+		case info.Distance <= zoneDistance:
+			info.Zone = "main_sequence"
+		case info.Abstractness+info.Instability < 1:
+			info.Zone = "pain"
+			info.Suggestions = append(info.Suggestions, fmt.Sprintf("Stable (%d dependents) but concrete (abstractness %.2f): changes ripple to every dependent; %s", info.Afferent, info.Abstractness, painRemedy(c.concrete)))
+		default:
+			info.Zone = "uselessness"
+			info.Suggestions = append(info.Suggestions, fmt.Sprintf("Abstract (abstractness %.2f) but unstable with %d dependents: %s", info.Abstractness, info.Afferent, uselessnessRemedy(c.interfaces)))
+		}
+
+		if info.Efferent > highEfferent {
+			info.Suggestions = append(info.Suggestions, fmt.Sprintf("Imports %d module packages; split it along the groups of dependencies its files use", info.Efferent))
+		}
+		if cycle := cycles[path]; cycle != nil {
+			info.Suggestions = append(info.Suggestions, fmt.Sprintf("Part of an import cycle with %s; move the shared types into a package both can import", strings.Join(otherPackages(cycle, path), ", ")))
+		}
 
+		info.Instability = roundRatio(info.Instability)
+		info.Abstractness = roundRatio(info.Abstractness)
+		info.Distance = roundRatio(info.Distance)
 		coupling = append(coupling, info)
 	}
 
+	// Isolated packages have no meaningful distance; list them last
+	sort.SliceStable(coupling, func(i, j int) bool {
+		if isolated := coupling[i].Zone == "isolated"; isolated != (coupling[j].Zone == "isolated") {
+			return !isolated
+		}
+		return coupling[i].Distance > coupling[j].Distance
+	})
+
 	return coupling, nil
-}
\ No newline at end of file
+}
+
+func painRemedy(concrete []string) string {
+	if len(concrete) == 0 {
+		return "depend on it through interfaces declared by its consumers, or keep it free of volatile logic"
+	}
+	return fmt.Sprintf("let dependents use interfaces they declare instead of %s, or move volatile logic out", firstNames(concrete))
+}
+
+func uselessnessRemedy(interfaces []string) string {
+	if len(interfaces) == 0 {
+		return "its abstractions are unused; inline them into their callers"
+	}
+	return fmt.Sprintf("move %s next to the packages that consume them, or remove them if nothing does", firstNames(interfaces))
+}
+
+func firstNames(names []string) string {
+	sort.Strings(names)
+	if len(names) > maxSuggestedTypes {
+		return strings.Join(names[:maxSuggestedTypes], ", ") + fmt.Sprintf(" and %d more", len(names)-maxSuggestedTypes)
+	}
+	return strings.Join(names, ", ")
+}
+
+func otherPackages(component []string, path string) []string {
+	var others []string
+	for _, p := range component {
+		if p != path {
+			others = append(others, p)
+		}
+	}
+	return others
+}
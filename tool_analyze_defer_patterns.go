@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
 	"strings"
@@ -25,13 +26,13 @@ type DeferIssue struct {
 	Position    Position `json:"position"`
 }
 
-func analyzeDeferPatterns(dir string) (*DeferAnalysis, error) {
+func analyzeDeferPatterns(ctx context.Context, dir string) (*DeferAnalysis, error) {
 	analysis := &DeferAnalysis{
 		Defers: []DeferUsage{},
 		Issues: []DeferIssue{},
 	}
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		var currentFunc string
 
 		ast.Inspect(file, func(n ast.Node) bool {
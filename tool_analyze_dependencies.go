@@ -1,40 +1,177 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"go/ast"
 	"go/token"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// Import edge kinds
+const (
+	importStdlib     = "stdlib"
+	importInternal   = "internal"
+	importThirdParty = "third_party"
 )
 
 // Dependency analysis types
+type DependencyReport struct {
+	Module   string           `json:"module"`
+	Packages []DependencyInfo `json:"packages"`
+	Cycles   []ImportCycle    `json:"cycles,omitempty"`
+}
+
 type DependencyInfo struct {
-	Package      string         `json:"package"`
-	Dir          string         `json:"dir"`
-	Dependencies []string       `json:"dependencies"`
-	Dependents   []string       `json:"dependents,omitempty"`
-	Cycles       [][]string     `json:"cycles,omitempty"`
+	Package      string           `json:"package"`
+	Name         string           `json:"name"`
+	Dir          string           `json:"dir"`
+	Dependencies []DependencyEdge `json:"dependencies"`
+	Dependents   []string         `json:"dependents,omitempty"`
+}
+
+type DependencyEdge struct {
+	From     string   `json:"from,omitempty"`
+	Path     string   `json:"path"`
+	Kind     string   `json:"kind"`
+	Position Position `json:"position"`
+}
+
+// ImportCycle is a strongly connected component of the package graph
+type ImportCycle struct {
+	Packages []string         `json:"packages"`
+	Path     []string         `json:"path"`
+	Edges    []DependencyEdge `json:"edges"`
+}
+
+// importGraph is the package import graph of the workspace packages under a
+// directory, keyed by import path
+type importGraph struct {
+	module   string
+	packages map[string]*importNode
+}
+
+type importNode struct {
+	path    string
+	name    string
+	dir     string
+	module  string
+	imports map[string]*importEdge
+}
+
+type importEdge struct {
+	from string
+	to   string
+	kind string
+	pos  token.Position
+}
+
+func analyzeDependencies(ctx context.Context, dir string, includeTests bool) (*DependencyReport, error) {
+	graph, err := buildImportGraph(ctx, dir, includeTests)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DependencyReport{
+		Module:   graph.module,
+		Packages: []DependencyInfo{},
+	}
+
+	dependents := make(map[string][]string)
+	for _, path := range graph.sortedPackages() {
+		for _, edge := range graph.packages[path].sortedImports() {
+			if _, ok := graph.packages[edge.to]; ok {
+				dependents[edge.to] = append(dependents[edge.to], path)
+			}
+		}
+	}
+
+	for _, path := range graph.sortedPackages() {
+		node := graph.packages[path]
+		info := DependencyInfo{
+			Package:      node.path,
+			Name:         node.name,
+			Dir:          node.dir,
+			Dependencies: []DependencyEdge{},
+			Dependents:   dependents[path],
+		}
+		for _, edge := range node.sortedImports() {
+			info.Dependencies = append(info.Dependencies, DependencyEdge{
+				Path:     edge.to,
+				Kind:     edge.kind,
+				Position: newPosition(edge.pos),
+			})
+		}
+		report.Packages = append(report.Packages, info)
+	}
+
+	report.Cycles = graph.cycles()
+
+	return report, nil
 }
 
-func analyzeDependencies(dir string) ([]DependencyInfo, error) {
-	depMap := make(map[string]*DependencyInfo)
+// buildImportGraph parses the packages under dir and resolves each import
+// against the module path of the go.mod owning the importing package. With
+// includeTests, in-package test imports count towards their package and
+// external test packages become nodes of their own.
+func buildImportGraph(ctx context.Context, dir string, includeTests bool) (*importGraph, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+
+	graph := &importGraph{
+		module:   modulePath(findModuleRoot(absDir)),
+		packages: make(map[string]*importNode),
+	}
+	modules := make(map[string]string)
 
-	// First pass: collect all packages and their imports
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err = walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		pkgDir := filepath.Dir(path)
-		if _, exists := depMap[pkgDir]; !exists {
-			depMap[pkgDir] = &DependencyInfo{
-				Package:      file.Name.Name,
-				Dir:          pkgDir,
-				Dependencies: []string{},
+		isTest := strings.HasSuffix(path, "_test.go")
+		if isTest && !includeTests || isIgnoredFile(file) || hasPathElement(pkgDir, "testdata") {
+			return nil
+		}
+
+		root := findModuleRoot(pkgDir)
+		module, ok := modules[root]
+		if !ok {
+			module = modulePath(root)
+			modules[root] = module
+		}
+
+		importPath := packageImportPath(module, root, pkgDir)
+		if isTest && strings.HasSuffix(file.Name.Name, "_test") {
+			importPath += "_test"
+		}
+
+		node, ok := graph.packages[importPath]
+		if !ok {
+			node = &importNode{
+				path:    importPath,
+				name:    file.Name.Name,
+				dir:     pkgDir,
+				module:  module,
+				imports: make(map[string]*importEdge),
 			}
+			graph.packages[importPath] = node
 		}
 
-		// Add imports
 		for _, imp := range file.Imports {
-			importPath := strings.Trim(imp.Path.Value, `"`)
-			if !contains(depMap[pkgDir].Dependencies, importPath) {
-				depMap[pkgDir].Dependencies = append(depMap[pkgDir].Dependencies, importPath)
+			target := strings.Trim(imp.Path.Value, `"`)
+			if _, exists := node.imports[target]; exists {
+				continue
+			}
+			node.imports[target] = &importEdge{
+				from: importPath,
+				to:   target,
+				kind: classifyImport(target, module),
+				pos:  fset.Position(imp.Pos()),
 			}
 		}
 
@@ -45,88 +182,224 @@ func analyzeDependencies(dir string) ([]DependencyInfo, error) {
 		return nil, err
 	}
 
-	// Build dependency graph and find cycles
-	var deps []DependencyInfo
-	for _, dep := range depMap {
-		// Find internal dependencies
-		for _, imp := range dep.Dependencies {
-			// Check if this is an internal package
-			for otherDir, otherDep := range depMap {
-				if strings.HasSuffix(imp, otherDep.Package) && otherDir != dep.Dir {
-					otherDep.Dependents = append(otherDep.Dependents, dep.Package)
-				}
-			}
-		}
-		deps = append(deps, *dep)
+	return graph, nil
+}
+
+// modulePath returns the module path declared by root/go.mod, or "" when
+// there is none
+func modulePath(root string) string {
+	data, err := os.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return ""
 	}
+	return modfile.ModulePath(data)
+}
 
-	// Simple cycle detection (could be enhanced)
-	for i := range deps {
-		deps[i].Cycles = findCycles(&deps[i], depMap)
+// packageImportPath derives the import path of the package in pkgDir from
+// the module rooted at root
+func packageImportPath(module, root, pkgDir string) string {
+	rel, err := filepath.Rel(root, pkgDir)
+	if err != nil || module == "" {
+		return filepath.ToSlash(pkgDir)
+	}
+	if rel == "." {
+		return module
 	}
+	return module + "/" + filepath.ToSlash(rel)
+}
 
-	return deps, nil
+// classifyImport reports whether path belongs to module, the standard
+// library (no dot in the first element) or a third-party module
+func classifyImport(path, module string) string {
+	if module != "" && (path == module || strings.HasPrefix(path, module+"/")) {
+		return importInternal
+	}
+	first, _, _ := strings.Cut(path, "/")
+	if !strings.Contains(first, ".") {
+		return importStdlib
+	}
+	return importThirdParty
 }
 
-func contains(slice []string, str string) bool {
-	for _, s := range slice {
-		if s == str {
+// isIgnoredFile reports files excluded from every build with //go:build ignore
+func isIgnoredFile(file *ast.File) bool {
+	for _, group := range file.Comments {
+		if group.Pos() > file.Package {
+			break
+		}
+		for _, c := range group.List {
+			if strings.TrimSpace(c.Text) == "//go:build ignore" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasPathElement(path, element string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		if part == element {
 			return true
 		}
 	}
 	return false
 }
 
-func findCycles(dep *DependencyInfo, depMap map[string]*DependencyInfo) [][]string {
-	// Simple DFS-based cycle detection
-	var cycles [][]string
-	visited := make(map[string]bool)
-	recStack := make(map[string]bool)
-	path := []string{}
-
-	var dfs func(pkg string) bool
-	dfs = func(pkg string) bool {
-		visited[pkg] = true
-		recStack[pkg] = true
-		path = append(path, pkg)
-
-		// Find dependencies for this package
-		for _, d := range depMap {
-			if d.Package == pkg {
-				for _, imp := range d.Dependencies {
-					for _, otherDep := range depMap {
-						if strings.HasSuffix(imp, otherDep.Package) {
-							if !visited[otherDep.Package] {
-								if dfs(otherDep.Package) {
-									return true
-								}
-							} else if recStack[otherDep.Package] {
-								// Found a cycle
-								cycleStart := -1
-								for i, p := range path {
-									if p == otherDep.Package {
-										cycleStart = i
-										break
-									}
-								}
-								if cycleStart >= 0 {
-									cycle := append([]string{}, path[cycleStart:]...)
-									cycles = append(cycles, cycle)
-								}
-								return true
-							}
-						}
-					}
+func (g *importGraph) sortedPackages() []string {
+	paths := make([]string, 0, len(g.packages))
+	for path := range g.packages {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (n *importNode) sortedImports() []*importEdge {
+	edges := make([]*importEdge, 0, len(n.imports))
+	for _, edge := range n.imports {
+		edges = append(edges, edge)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		return edges[i].to < edges[j].to
+	})
+	return edges
+}
+
+// components returns the strongly connected components of the graph of
+// workspace packages using Tarjan's algorithm, in reverse topological order
+func (g *importGraph) components() [][]string {
+	index := make(map[string]int)
+	lowlink := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var components [][]string
+
+	var strongConnect func(path string)
+	strongConnect = func(path string) {
+		index[path] = len(index)
+		lowlink[path] = index[path]
+		stack = append(stack, path)
+		onStack[path] = true
+
+		for _, edge := range g.packages[path].sortedImports() {
+			if _, ok := g.packages[edge.to]; !ok {
+				continue
+			}
+			if _, visited := index[edge.to]; !visited {
+				strongConnect(edge.to)
+				lowlink[path] = min(lowlink[path], lowlink[edge.to])
+			} else if onStack[edge.to] {
+				lowlink[path] = min(lowlink[path], index[edge.to])
+			}
+		}
+
+		if lowlink[path] == index[path] {
+			var component []string
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				component = append(component, top)
+				if top == path {
+					break
 				}
-				break
 			}
+			sort.Strings(component)
+			components = append(components, component)
+		}
+	}
+
+	for _, path := range g.sortedPackages() {
+		if _, visited := index[path]; !visited {
+			strongConnect(path)
+		}
+	}
+
+	return components
+}
+
+// cycles reports every component of more than one package with one shortest
+// cycle through it and the position of each import between its members
+func (g *importGraph) cycles() []ImportCycle {
+	var cycles []ImportCycle
+
+	for _, component := range g.components() {
+		if len(component) < 2 {
+			continue
+		}
+
+		members := make(map[string]bool)
+		for _, path := range component {
+			members[path] = true
 		}
 
-		path = path[:len(path)-1]
-		recStack[pkg] = false
-		return false
+		cycle := ImportCycle{
+			Packages: component,
+			Path:     g.shortestCycle(component[0], members),
+		}
+		for _, path := range component {
+			for _, edge := range g.packages[path].sortedImports() {
+				if members[edge.to] {
+					cycle.Edges = append(cycle.Edges, DependencyEdge{
+						From:     edge.from,
+						Path:     edge.to,
+						Kind:     edge.kind,
+						Position: newPosition(edge.pos),
+					})
+				}
+			}
+		}
+		cycles = append(cycles, cycle)
 	}
 
-	dfs(dep.Package)
+	sort.Slice(cycles, func(i, j int) bool {
+		return cycles[i].Packages[0] < cycles[j].Packages[0]
+	})
+
 	return cycles
-}
\ No newline at end of file
+}
+
+// shortestCycle finds the shortest import chain from start back to itself
+// through members, breadth first
+func (g *importGraph) shortestCycle(start string, members map[string]bool) []string {
+	prev := make(map[string]string)
+	queue := []string{start}
+
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+
+		for _, edge := range g.packages[path].sortedImports() {
+			if !members[edge.to] {
+				continue
+			}
+			if edge.to == start {
+				cycle := []string{start}
+				for p := path; p != start; p = prev[p] {
+					cycle = append(cycle, p)
+				}
+				cycle = append(cycle, start)
+				// Built backwards from the closing edge
+				for i, j := 1, len(cycle)-2; i < j; i, j = i+1, j-1 {
+					cycle[i], cycle[j] = cycle[j], cycle[i]
+				}
+				return cycle
+			}
+			if _, seen := prev[edge.to]; !seen && edge.to != start {
+				prev[edge.to] = path
+				queue = append(queue, edge.to)
+			}
+		}
+	}
+
+	return nil
+}
+
+func contains(slice []string, str string) bool {
+	for _, s := range slice {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
 )
@@ -26,10 +27,10 @@ type InterfaceEmbedding struct {
 	Position    Position `json:"position"`
 }
 
-func analyzeEmbedding(dir string) ([]EmbeddingInfo, error) {
+func analyzeEmbedding(ctx context.Context, dir string) ([]EmbeddingInfo, error) {
 	var embedding []EmbeddingInfo
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		info := EmbeddingInfo{
 			File: path,
 		}
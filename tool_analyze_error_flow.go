@@ -0,0 +1,415 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// Error flow issue kinds
+const (
+	issueUnwrappedReturn    = "unwrapped_return"
+	issueErrorfWithoutWrap  = "errorf_without_w"
+	issueSentinelComparison = "sentinel_comparison"
+	issueErrorTypeAssertion = "error_type_assertion"
+)
+
+// Error flow analysis types
+type ErrorFlowReport struct {
+	Issues   []ErrorFlowIssue    `json:"issues"`
+	Packages []PackageErrorTypes `json:"packages"`
+}
+
+type ErrorFlowIssue struct {
+	Kind       string   `json:"kind"`
+	Function   string   `json:"function,omitempty"`
+	Message    string   `json:"message"`
+	Suggestion string   `json:"suggestion"`
+	Position   Position `json:"position"`
+}
+
+// PackageErrorTypes catalogs the errors a package exports for callers to
+// match on
+type PackageErrorTypes struct {
+	Package    string            `json:"package"`
+	Sentinels  []SentinelError   `json:"sentinels,omitempty"`
+	ErrorTypes []CustomErrorType `json:"error_types,omitempty"`
+}
+
+type SentinelError struct {
+	Name     string   `json:"name"`
+	Message  string   `json:"message,omitempty"`
+	Position Position `json:"position"`
+}
+
+type CustomErrorType struct {
+	Name     string   `json:"name"`
+	Pointer  bool     `json:"pointer_receiver"`
+	Unwrap   bool     `json:"unwrap"`
+	Is       bool     `json:"is"`
+	As       bool     `json:"as"`
+	Position Position `json:"position"`
+}
+
+// analyzeErrorFlow reports error handling that defeats errors.Is/As or
+// loses context, and catalogs the exported sentinel errors and error types
+// of each package under dir
+func analyzeErrorFlow(ctx context.Context, dir string, includeTests bool) (*ErrorFlowReport, error) {
+	pkgs, err := loadPackages(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ErrorFlowReport{
+		Issues:   []ErrorFlowIssue{},
+		Packages: []PackageErrorTypes{},
+	}
+	seenFiles := make(map[string]bool)
+	catalogs := make(map[string]*PackageErrorTypes)
+
+	for _, pkg := range analysisPackages(pkgs) {
+		for _, file := range pkg.Syntax {
+			filename := pkg.Fset.File(file.Pos()).Name()
+			isTest := strings.HasSuffix(filename, "_test.go")
+			if seenFiles[filename] {
+				continue
+			}
+			seenFiles[filename] = true
+
+			if !isTest {
+				catalog := catalogs[pkg.PkgPath]
+				if catalog == nil {
+					catalog = &PackageErrorTypes{Package: pkg.PkgPath}
+					catalogs[pkg.PkgPath] = catalog
+				}
+				catalogErrors(pkg, file, catalog)
+			}
+
+			if isTest && !includeTests {
+				continue
+			}
+			for _, decl := range file.Decls {
+				if fn, ok := decl.(*ast.FuncDecl); ok && fn.Body != nil {
+					report.Issues = append(report.Issues, errorFlowIssues(pkg, fn)...)
+				}
+			}
+		}
+	}
+
+	for _, catalog := range catalogs {
+		if len(catalog.Sentinels) > 0 || len(catalog.ErrorTypes) > 0 {
+			report.Packages = append(report.Packages, *catalog)
+		}
+	}
+	sort.Slice(report.Packages, func(i, j int) bool {
+		return report.Packages[i].Package < report.Packages[j].Package
+	})
+	sort.SliceStable(report.Issues, func(i, j int) bool {
+		a, b := report.Issues[i].Position, report.Issues[j].Position
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Offset < b.Offset
+	})
+
+	return report, nil
+}
+
+// errorFlowIssues checks one function. Methods implementing Is, As or Unwrap
+// are exempt from the comparison and assertion checks, since they are what
+// errors.Is and errors.As call.
+func errorFlowIssues(pkg *packages.Package, fn *ast.FuncDecl) []ErrorFlowIssue {
+	var issues []ErrorFlowIssue
+	info := pkg.TypesInfo
+	name := funcDeclName(fn)
+	matcher := fn.Recv != nil && (fn.Name.Name == "Is" || fn.Name.Name == "As" || fn.Name.Name == "Unwrap")
+
+	add := func(kind string, node ast.Node, message, suggestion string) {
+		issues = append(issues, ErrorFlowIssue{
+			Kind:       kind,
+			Function:   name,
+			Message:    message,
+			Suggestion: suggestion,
+			Position:   newPosition(pkg.Fset.Position(node.Pos())),
+		})
+	}
+
+	// Error variables whose latest assignment came straight from a call
+	// into another package
+	origins := make(map[types.Object]string)
+	foreignCall := func(expr ast.Expr) string {
+		call, ok := ast.Unparen(expr).(*ast.CallExpr)
+		if !ok {
+			return ""
+		}
+		callee, ok := typeutil.Callee(info, call).(*types.Func)
+		if !ok || callee.Pkg() == nil || callee.Pkg().Path() == pkg.PkgPath || errorResult(info, call) < 0 {
+			return ""
+		}
+		// Constructors and wrappers create new errors rather than pass one on
+		switch callee.Pkg().Path() + "." + callee.Name() {
+		case "errors.New", "errors.Join", "fmt.Errorf":
+			return ""
+		}
+		return qualifiedName(callee)
+	}
+
+	literalReturns := make(map[*ast.ReturnStmt]bool)
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.AssignStmt:
+			for i, lhs := range x.Lhs {
+				ident, ok := lhs.(*ast.Ident)
+				if !ok {
+					continue
+				}
+				obj := info.ObjectOf(ident)
+				if obj == nil || !isErrorType(obj.Type()) {
+					continue
+				}
+				origin := ""
+				if len(x.Rhs) == 1 && i == len(x.Lhs)-1 {
+					origin = foreignCall(x.Rhs[0])
+				} else if len(x.Rhs) == len(x.Lhs) {
+					origin = foreignCall(x.Rhs[i])
+				}
+				origins[obj] = origin
+			}
+
+		case *ast.FuncLit:
+			// Returns inside a literal belong to the literal, not to fn;
+			// everything else in it is checked as part of fn
+			ast.Inspect(x.Body, func(n ast.Node) bool {
+				if ret, ok := n.(*ast.ReturnStmt); ok {
+					literalReturns[ret] = true
+				}
+				return true
+			})
+
+		case *ast.ReturnStmt:
+			if len(x.Results) == 0 || literalReturns[x] {
+				break
+			}
+			last := ast.Unparen(x.Results[len(x.Results)-1])
+			origin := foreignCall(last)
+			if ident, ok := last.(*ast.Ident); ok {
+				origin = origins[info.ObjectOf(ident)]
+			}
+			if origin != "" {
+				add(issueUnwrappedReturn, x, fmt.Sprintf("Error from %s is returned without context", origin),
+					fmt.Sprintf("return fmt.Errorf(\"...: %%w\", err) so callers see what %s was doing", name))
+			}
+
+		case *ast.CallExpr:
+			if callee, ok := typeutil.Callee(info, x).(*types.Func); ok && callee.Pkg() != nil && callee.Pkg().Path() == "fmt" && callee.Name() == "Errorf" {
+				for _, arg := range errorfUnwrappedArgs(info, x) {
+					add(issueErrorfWithoutWrap, arg, fmt.Sprintf("fmt.Errorf formats error %s with %%v or %%s, breaking errors.Is and errors.As", exprToString(arg)),
+						"use %w for the error operand")
+				}
+			}
+
+		case *ast.BinaryExpr:
+			if matcher || x.Op != token.EQL && x.Op != token.NEQ {
+				break
+			}
+			for _, pair := range [][2]ast.Expr{{x.X, x.Y}, {x.Y, x.X}} {
+				if sentinel := sentinelRef(info, pair[1]); sentinel != "" && isErrorType(info.TypeOf(pair[0])) {
+					negate := ""
+					if x.Op == token.NEQ {
+						negate = "!"
+					}
+					add(issueSentinelComparison, x, fmt.Sprintf("Comparison with %s misses wrapped errors", sentinel),
+						fmt.Sprintf("use %serrors.Is(%s, %s)", negate, exprToString(pair[0]), sentinel))
+					break
+				}
+			}
+
+		case *ast.SwitchStmt:
+			if matcher || x.Tag == nil || !isErrorType(info.TypeOf(x.Tag)) {
+				break
+			}
+			for _, stmt := range x.Body.List {
+				for _, expr := range stmt.(*ast.CaseClause).List {
+					if sentinel := sentinelRef(info, expr); sentinel != "" {
+						add(issueSentinelComparison, expr, fmt.Sprintf("switch case %s misses wrapped errors", sentinel),
+							fmt.Sprintf("use case errors.Is(%s, %s) in a tagless switch", exprToString(x.Tag), sentinel))
+					}
+				}
+			}
+
+		case *ast.TypeAssertExpr:
+			if matcher || !isErrorType(info.TypeOf(x.X)) {
+				break
+			}
+			if x.Type == nil {
+				// err.(type) in a type switch
+				add(issueErrorTypeAssertion, x, fmt.Sprintf("Type switch on %s misses wrapped errors", exprToString(x.X)),
+					"use errors.As for each case")
+				break
+			}
+			target := types.TypeString(info.TypeOf(x.Type), func(p *types.Package) string {
+				if p == pkg.Types {
+					return ""
+				}
+				return p.Name()
+			})
+			add(issueErrorTypeAssertion, x, fmt.Sprintf("Type assertion of %s to %s misses wrapped errors", exprToString(x.X), target),
+				fmt.Sprintf("var target %s; errors.As(%s, &target)", target, exprToString(x.X)))
+		}
+		return true
+	})
+
+	return issues
+}
+
+// sentinelRef returns the name of the package-level error variable expr
+// refers to, or ""
+func sentinelRef(info *types.Info, expr ast.Expr) string {
+	var ident *ast.Ident
+	switch e := ast.Unparen(expr).(type) {
+	case *ast.Ident:
+		ident = e
+	case *ast.SelectorExpr:
+		ident = e.Sel
+	default:
+		return ""
+	}
+
+	v, ok := info.Uses[ident].(*types.Var)
+	if !ok || v.Pkg() == nil || v.Parent() != v.Pkg().Scope() || !isErrorType(v.Type()) {
+		return ""
+	}
+	return exprToString(expr)
+}
+
+// errorfUnwrappedArgs returns the error operands of a fmt.Errorf call that
+// are formatted with %v or %s
+func errorfUnwrappedArgs(info *types.Info, call *ast.CallExpr) []ast.Expr {
+	if len(call.Args) == 0 {
+		return nil
+	}
+	tv, ok := info.Types[call.Args[0]]
+	if !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+		return nil
+	}
+	format := constant.StringVal(tv.Value)
+	args := call.Args[1:]
+
+	var result []ast.Expr
+	argIndex := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		// Flags, width and precision; * consumes an argument
+		for i < len(format) && strings.IndexByte("+-# 0123456789.*[]", format[i]) >= 0 {
+			if format[i] == '*' {
+				argIndex++
+			}
+			if format[i] == '[' {
+				// Explicit argument indexes are too rare to model
+				return result
+			}
+			i++
+		}
+		if i >= len(format) {
+			break
+		}
+		verb := format[i]
+		if verb == '%' {
+			continue
+		}
+		if argIndex < len(args) && (verb == 'v' || verb == 's') && isErrorType(info.TypeOf(args[argIndex])) {
+			result = append(result, args[argIndex])
+		}
+		argIndex++
+	}
+	return result
+}
+
+// catalogErrors records the exported sentinel errors and error types
+// declared in file
+func catalogErrors(pkg *packages.Package, file *ast.File, catalog *PackageErrorTypes) {
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			switch spec := spec.(type) {
+			case *ast.ValueSpec:
+				if gen.Tok != token.VAR {
+					continue
+				}
+				for i, name := range spec.Names {
+					obj := pkg.TypesInfo.Defs[name]
+					if obj == nil || !name.IsExported() || !isErrorType(obj.Type()) {
+						continue
+					}
+					sentinel := SentinelError{
+						Name:     name.Name,
+						Position: newPosition(pkg.Fset.Position(name.Pos())),
+					}
+					if i < len(spec.Values) {
+						sentinel.Message = errorMessage(pkg.TypesInfo, spec.Values[i])
+					}
+					catalog.Sentinels = append(catalog.Sentinels, sentinel)
+				}
+
+			case *ast.TypeSpec:
+				obj, ok := pkg.TypesInfo.Defs[spec.Name].(*types.TypeName)
+				if !ok || !spec.Name.IsExported() || types.IsInterface(obj.Type()) {
+					continue
+				}
+				pointer := false
+				if !types.Implements(obj.Type(), errorInterface) {
+					if !types.Implements(types.NewPointer(obj.Type()), errorInterface) {
+						continue
+					}
+					pointer = true
+				}
+
+				methods := types.NewMethodSet(types.NewPointer(obj.Type()))
+				has := func(name string) bool {
+					return methods.Lookup(obj.Pkg(), name) != nil
+				}
+				catalog.ErrorTypes = append(catalog.ErrorTypes, CustomErrorType{
+					Name:     spec.Name.Name,
+					Pointer:  pointer,
+					Unwrap:   has("Unwrap"),
+					Is:       has("Is"),
+					As:       has("As"),
+					Position: newPosition(pkg.Fset.Position(spec.Name.Pos())),
+				})
+			}
+		}
+	}
+}
+
+// errorMessage returns the text of errors.New("...") or a constant
+// fmt.Errorf format
+func errorMessage(info *types.Info, expr ast.Expr) string {
+	call, ok := ast.Unparen(expr).(*ast.CallExpr)
+	if !ok || len(call.Args) == 0 {
+		return ""
+	}
+	if tv, ok := info.Types[call.Args[0]]; ok && tv.Value != nil && tv.Value.Kind() == constant.String {
+		return constant.StringVal(tv.Value)
+	}
+	if lit, ok := call.Args[0].(*ast.BasicLit); ok {
+		if s, err := strconv.Unquote(lit.Value); err == nil {
+			return s
+		}
+	}
+	return ""
+}
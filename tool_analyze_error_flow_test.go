@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestAnalyzeErrorFlow(t *testing.T) {
+	root := writeModule(t, map[string]string{
+		"a.go": `package a
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var ErrNotFound = errors.New("not found")
+
+type PathError struct{ Path string }
+
+func (e *PathError) Error() string { return e.Path }
+
+func (e *PathError) Unwrap() error { return nil }
+
+func Open(name string) error {
+	_, err := os.Open(name)
+	return err
+}
+
+func Read(r io.Reader) error {
+	_, err := r.Read(nil)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading: %v", err)
+	}
+	return nil
+}
+
+func Kind(err error) string {
+	switch err {
+	case ErrNotFound:
+		return "missing"
+	}
+	if _, ok := err.(*PathError); ok {
+		return "path"
+	}
+	return ""
+}
+
+func Wrapped(name string) error {
+	if _, err := os.Stat(name); err != nil {
+		return fmt.Errorf("stat %s: %w", name, err)
+	}
+	return errors.New("fresh")
+}
+
+func Closures(name string) {
+	go func() {
+		_, err := os.Open(name)
+		if err == io.EOF {
+			return
+		}
+		_ = fmt.Errorf("open: %v", err)
+	}()
+	defer func() error {
+		_, err := os.Open(name)
+		if _, ok := err.(*PathError); ok {
+			return nil
+		}
+		return err
+	}()
+}
+`,
+	})
+
+	report, err := analyzeErrorFlow(context.Background(), root, false)
+	if err != nil {
+		t.Fatalf("analyzeErrorFlow() error = %v", err)
+	}
+
+	type issue struct {
+		Kind     string
+		Function string
+		Line     int
+	}
+	var got []issue
+	for _, i := range report.Issues {
+		got = append(got, issue{i.Kind, i.Function, i.Position.Line})
+	}
+	want := []issue{
+		{issueUnwrappedReturn, "Open", 20},
+		{issueSentinelComparison, "Read", 25},
+		{issueErrorfWithoutWrap, "Read", 29},
+		{issueSentinelComparison, "Kind", 36},
+		{issueErrorTypeAssertion, "Kind", 39},
+		// Inside function literals, without their returns
+		{issueSentinelComparison, "Closures", 55},
+		{issueErrorfWithoutWrap, "Closures", 58},
+		{issueErrorTypeAssertion, "Closures", 62},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("issues = %+v, want %+v", got, want)
+	}
+
+	if len(report.Packages) != 1 {
+		t.Fatalf("packages = %+v, want one catalog", report.Packages)
+	}
+	catalog := report.Packages[0]
+	if len(catalog.Sentinels) != 1 || catalog.Sentinels[0].Name != "ErrNotFound" || catalog.Sentinels[0].Message != "not found" {
+		t.Errorf("sentinels = %+v, want ErrNotFound", catalog.Sentinels)
+	}
+	wantType := CustomErrorType{Name: "PathError", Pointer: true, Unwrap: true}
+	if len(catalog.ErrorTypes) != 1 {
+		t.Fatalf("error types = %+v, want PathError", catalog.ErrorTypes)
+	}
+	gotType := catalog.ErrorTypes[0]
+	gotType.Position = Position{}
+	if gotType != wantType {
+		t.Errorf("error type = %+v, want %+v", gotType, wantType)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
 	"strings"
@@ -20,10 +21,10 @@ type IdiomItem struct {
 	Position    Position `json:"position"`
 }
 
-func analyzeGoIdioms(dir string) ([]IdiomsInfo, error) {
+func analyzeGoIdioms(ctx context.Context, dir string) ([]IdiomsInfo, error) {
 	var idioms []IdiomsInfo
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		info := IdiomsInfo{
 			File: path,
 		}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
 	"strings"
@@ -25,13 +26,13 @@ type GoroutineIssue struct {
 	Position    Position `json:"position"`
 }
 
-func analyzeGoroutines(dir string) (*GoroutineAnalysis, error) {
+func analyzeGoroutines(ctx context.Context, dir string) (*GoroutineAnalysis, error) {
 	analysis := &GoroutineAnalysis{
 		Goroutines: []GoroutineUsage{},
 		Issues:     []GoroutineIssue{},
 	}
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		// Track WaitGroup usage
 		waitGroupVars := make(map[string]bool)
 		hasWaitGroupImport := false
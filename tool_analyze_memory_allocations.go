@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
 	"strings"
@@ -25,13 +26,13 @@ type AllocationIssue struct {
 	Position    Position `json:"position"`
 }
 
-func analyzeMemoryAllocations(dir string) (*AllocationAnalysis, error) {
+func analyzeMemoryAllocations(ctx context.Context, dir string) (*AllocationAnalysis, error) {
 	analysis := &AllocationAnalysis{
 		Allocations: []MemoryAllocation{},
 		Issues:      []AllocationIssue{},
 	}
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		// Analyze allocations
 		ast.Inspect(file, func(n ast.Node) bool {
 			switch node := n.(type) {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
 	"strings"
@@ -27,13 +28,13 @@ type NamingStats struct {
 	ViolationCount     int `json:"violation_count"`
 }
 
-func analyzeNamingConventions(dir string) (*NamingAnalysis, error) {
+func analyzeNamingConventions(ctx context.Context, dir string) (*NamingAnalysis, error) {
 	analysis := &NamingAnalysis{
 		Violations: []NamingViolation{},
 		Statistics: NamingStats{},
 	}
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		// Check package name
 		checkPackageName(file, fset, analysis)
 
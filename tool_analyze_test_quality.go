@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
 	"strings"
@@ -29,10 +30,10 @@ type TestIssue struct {
 	Position    Position `json:"position"`
 }
 
-func analyzeTestQuality(dir string) ([]TestQualityInfo, error) {
+func analyzeTestQuality(ctx context.Context, dir string) ([]TestQualityInfo, error) {
 	var testQuality []TestQualityInfo
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		if !strings.HasSuffix(path, "_test.go") {
 			return nil
 		}
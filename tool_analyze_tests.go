@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
+	"sort"
 	"strings"
 )
 
@@ -22,28 +24,47 @@ type TestFile struct {
 }
 
 type ExportedFunc struct {
-	Name     string   `json:"name"`
-	Package  string   `json:"package"`
-	Tested   bool     `json:"tested"`
-	Position Position `json:"position"`
+	Name       string            `json:"name"`
+	Package    string            `json:"package"`
+	Tested     bool              `json:"tested"`
+	Complexity int               `json:"complexity"`
+	Coverage   *FunctionCoverage `json:"coverage,omitempty"`
+	Position   Position          `json:"position"`
 }
 
 type TestCoverage struct {
 	TotalExported int     `json:"total_exported"`
 	TotalTested   int     `json:"total_tested"`
 	Percentage    float64 `json:"percentage"`
+
+	// Statement coverage of the exported functions, with coverage enabled
+	Statements          int     `json:"statements,omitempty"`
+	StatementsCovered   int     `json:"statements_covered,omitempty"`
+	StatementPercentage float64 `json:"statement_percentage,omitempty"`
+	TestsFailed         bool    `json:"tests_failed,omitempty"`
 }
 
-func analyzeTests(dir string) (*TestAnalysis, error) {
+// analyzeTests pairs tests with the exported functions they exercise, by
+// Test<Name> convention or, with coverage, by whether they actually run them
+func analyzeTests(ctx context.Context, dir string, withCoverage bool) (*TestAnalysis, error) {
 	analysis := &TestAnalysis{
 		TestFiles:         []TestFile{},
 		ExportedFunctions: []ExportedFunc{},
 	}
 
+	var profile *coverageProfile
+	if withCoverage {
+		var err error
+		profile, err = collectCoverage(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Collect all exported functions
 	exportedFuncs := make(map[string]*ExportedFunc)
 	
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		if strings.HasSuffix(path, "_test.go") {
 			// Process test files
 			testFile := TestFile{
@@ -73,12 +94,17 @@ func analyzeTests(dir string) (*TestAnalysis, error) {
 				if fn, ok := decl.(*ast.FuncDecl); ok && ast.IsExported(fn.Name.Name) {
 					key := file.Name.Name + "." + fn.Name.Name
 					pos := fset.Position(fn.Pos())
-					exportedFuncs[key] = &ExportedFunc{
-						Name:     fn.Name.Name,
-						Package:  file.Name.Name,
-						Tested:   false,
-						Position: newPosition(pos),
+					exported := &ExportedFunc{
+						Name:       fn.Name.Name,
+						Package:    file.Name.Name,
+						Tested:     false,
+						Complexity: measureFunction(fn, fset).Cyclomatic,
+						Position:   newPosition(pos),
 					}
+					if profile != nil {
+						exported.Coverage = profile.function(fset, fn)
+					}
+					exportedFuncs[key] = exported
 				}
 			}
 		}
@@ -94,13 +120,29 @@ func analyzeTests(dir string) (*TestAnalysis, error) {
 		for _, testName := range testFile.Tests {
 			// Simple heuristic: TestFunctionName tests FunctionName
 			funcName := strings.TrimPrefix(testName, "Test")
-			key := testFile.Package + "." + funcName
-			if fn, exists := exportedFuncs[key]; exists {
+			key := strings.TrimSuffix(testFile.Package, "_test") + "." + funcName
+			if fn, exists := exportedFuncs[key]; exists && profile == nil {
 				fn.Tested = true
 			}
 		}
 	}
 
+	// With a profile, a function is tested when its statements run
+	if profile != nil {
+		for _, fn := range exportedFuncs {
+			if fn.Coverage == nil {
+				continue
+			}
+			fn.Tested = fn.Coverage.Covered > 0
+			analysis.TestCoverage.Statements += fn.Coverage.Statements
+			analysis.TestCoverage.StatementsCovered += fn.Coverage.Covered
+		}
+		if analysis.TestCoverage.Statements > 0 {
+			analysis.TestCoverage.StatementPercentage = float64(analysis.TestCoverage.StatementsCovered) / float64(analysis.TestCoverage.Statements) * 100
+		}
+		analysis.TestCoverage.TestsFailed = profile.testsFailed
+	}
+
 	// Convert map to slice and calculate coverage
 	tested := 0
 	for _, fn := range exportedFuncs {
@@ -110,10 +152,16 @@ func analyzeTests(dir string) (*TestAnalysis, error) {
 		}
 	}
 
-	analysis.TestCoverage = TestCoverage{
-		TotalExported: len(exportedFuncs),
-		TotalTested:   tested,
-	}
+	sort.Slice(analysis.ExportedFunctions, func(i, j int) bool {
+		a, b := analysis.ExportedFunctions[i].Position, analysis.ExportedFunctions[j].Position
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Offset < b.Offset
+	})
+
+	analysis.TestCoverage.TotalExported = len(exportedFuncs)
+	analysis.TestCoverage.TotalTested = tested
 	if len(exportedFuncs) > 0 {
 		analysis.TestCoverage.Percentage = float64(tested) / float64(len(exportedFuncs)) * 100
 	}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// rangeEdit is one apply_edits entry, addressed like write_range: by lines
+// and optional columns, or by byte offsets
+type rangeEdit struct {
+	File       string `json:"file"`
+	Content    string `json:"content"`
+	StartLine  *int   `json:"start_line,omitempty"`
+	EndLine    *int   `json:"end_line,omitempty"`
+	StartCol   *int   `json:"start_col,omitempty"`
+	EndCol     *int   `json:"end_col,omitempty"`
+	StartByte  *int   `json:"start_byte,omitempty"`
+	EndByte    *int   `json:"end_byte,omitempty"`
+	ConfirmOld string `json:"confirm_old,omitempty"`
+}
+
+type ApplyEditsResult struct {
+	TransactionID string       `json:"transaction_id"`
+	Success       bool         `json:"success"`
+	DryRun        bool         `json:"dry_run,omitempty"`
+	Files         []EditedFile `json:"files"`
+	Message       string       `json:"message,omitempty"`
+}
+
+type EditedFile struct {
+	File  string `json:"file"`
+	Edits int    `json:"edits"`
+	Diff  string `json:"diff"`
+}
+
+// applyRangeEdits validates every edit against the current file contents,
+// then writes all files in one transaction. Positions refer to the contents
+// before any edit, so edits to the same file must not overlap. Nothing is
+// written if any edit fails to validate or any write fails.
+func applyRangeEdits(edits []rangeEdit, dryRun bool) (*ApplyEditsResult, error) {
+	if len(edits) == 0 {
+		return nil, fmt.Errorf("no edits given")
+	}
+
+	tx, err := newFileTransaction()
+	if err != nil {
+		return nil, err
+	}
+	result := &ApplyEditsResult{
+		TransactionID: tx.id,
+		DryRun:        dryRun,
+		Files:         []EditedFile{},
+	}
+	fail := func(format string, args ...any) (*ApplyEditsResult, error) {
+		result.Message = fmt.Sprintf(format, args...)
+		return result, nil
+	}
+
+	originals := make(map[string][]byte)
+	perFile := make(map[string][]textEdit)
+	for i, edit := range edits {
+		if edit.File == "" {
+			return fail("edit %d: no file given", i+1)
+		}
+		path, err := filepath.Abs(edit.File)
+		if err != nil {
+			return fail("edit %d: %v", i+1, err)
+		}
+
+		data, ok := originals[path]
+		if !ok {
+			if data, err = os.ReadFile(path); err != nil {
+				return fail("edit %d: failed to read %s: %v", i+1, edit.File, err)
+			}
+			originals[path] = data
+		}
+
+		start, end, err := resolveRange(data, intOr(edit.StartLine), intOr(edit.EndLine), intOr(edit.StartCol), intOr(edit.EndCol), intOr(edit.StartByte), intOr(edit.EndByte))
+		if err != nil {
+			return fail("edit %d (%s): %v", i+1, edit.File, err)
+		}
+		if old := string(data[start:end]); edit.ConfirmOld != "" && old != edit.ConfirmOld {
+			return fail("edit %d (%s): content mismatch: expected %q but found %q", i+1, edit.File, edit.ConfirmOld, old)
+		}
+		perFile[path] = append(perFile[path], textEdit{start: start, end: end, text: edit.Content})
+	}
+
+	var paths []string
+	for path := range perFile {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		updated, err := applyEdits(originals[path], perFile[path])
+		if err != nil {
+			return fail("%s: %v", path, err)
+		}
+		result.Files = append(result.Files, EditedFile{
+			File:  path,
+			Edits: len(perFile[path]),
+			Diff:  unifiedDiff(path, string(originals[path]), string(updated)),
+		})
+		if err := tx.write(path, updated, originals[path]); err != nil {
+			return fail("%v", err)
+		}
+	}
+
+	if !dryRun {
+		if err := tx.commit(); err != nil {
+			return fail("%v", err)
+		}
+	}
+
+	result.Success = true
+	return result, nil
+}
+
+// intOr dereferences an optional position, -1 meaning unspecified
+func intOr(p *int) int {
+	if p == nil {
+		return -1
+	}
+	return *p
+}
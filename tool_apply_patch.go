@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type ApplyPatchResult struct {
+	DryRun bool              `json:"dry_run"`
+	Files  []PatchFileResult `json:"files"`
+}
+
+type PatchFileResult struct {
+	File    string `json:"file"`
+	Status  string `json:"status"` // modified, created or deleted
+	Hunks   int    `json:"hunks"`
+	Offsets []int  `json:"offsets,omitempty"`
+}
+
+// applyPatch applies a unified diff to the files it names, resolved against
+// dir and checked by resolve. Every file is checked before any is written
+// and all are written in one transaction, so a patch that no longer applies
+// cleanly leaves the tree untouched.
+func applyPatch(dir, patch string, dryRun bool, resolve pathResolver) (*ApplyPatchResult, error) {
+	files, err := parsePatch(patch)
+	if err != nil {
+		return nil, fmt.Errorf("invalid patch: %w", err)
+	}
+
+	result := &ApplyPatchResult{
+		DryRun: dryRun,
+		Files:  []PatchFileResult{},
+	}
+
+	// Files may appear in several sections, e.g. concatenated dry run
+	// diffs; later sections apply to the result of earlier ones
+	type pendingWrite struct {
+		original []byte
+		content  string
+		exists   bool
+		created  bool
+	}
+	writes := make(map[string]*pendingWrite)
+	var order []string
+
+	for _, fp := range files {
+		oldPath, newPath := fp.oldPath, fp.newPath
+		// git prefixes the two sides with a/ and b/
+		if strings.HasPrefix(oldPath, "a/") && strings.HasPrefix(newPath, "b/") {
+			oldPath, newPath = oldPath[2:], newPath[2:]
+		} else if oldPath == devNull && strings.HasPrefix(newPath, "b/") {
+			newPath = newPath[2:]
+		} else if newPath == devNull && strings.HasPrefix(oldPath, "a/") {
+			oldPath = oldPath[2:]
+		}
+
+		path := newPath
+		if path == devNull {
+			path = oldPath
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		path, err := resolve(path)
+		if err != nil {
+			return nil, err
+		}
+
+		w, ok := writes[path]
+		if !ok {
+			w = &pendingWrite{}
+			if data, err := os.ReadFile(path); err == nil {
+				w.original, w.content, w.exists = data, string(data), true
+			} else if !os.IsNotExist(err) {
+				return nil, fmt.Errorf("failed to read %s: %w", path, err)
+			}
+			writes[path] = w
+			order = append(order, path)
+		}
+
+		fileResult := PatchFileResult{
+			File:   path,
+			Status: "modified",
+			Hunks:  len(fp.hunks),
+		}
+
+		switch {
+		case oldPath == devNull:
+			if w.exists {
+				return nil, fmt.Errorf("%s: file to create already exists", path)
+			}
+			fileResult.Status = "created"
+			w.created = true
+		case !w.exists:
+			return nil, fmt.Errorf("%s: file to patch does not exist", path)
+		}
+
+		updated, offsets, err := applyHunks(w.content, fp.hunks)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for _, offset := range offsets {
+			if offset != 0 {
+				fileResult.Offsets = offsets
+				break
+			}
+		}
+
+		w.content, w.exists = updated, true
+		if newPath == devNull {
+			if updated != "" {
+				return nil, fmt.Errorf("%s: file to delete has content the patch does not remove", path)
+			}
+			fileResult.Status = "deleted"
+			w.exists = false
+		}
+
+		result.Files = append(result.Files, fileResult)
+	}
+
+	if dryRun {
+		return result, nil
+	}
+
+	tx, err := newFileTransaction()
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range order {
+		w := writes[path]
+		var err error
+		switch {
+		case w.exists:
+			err = tx.write(path, []byte(w.content), w.original)
+		case !w.created:
+			err = tx.remove(path, w.original)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.commit(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
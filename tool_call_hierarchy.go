@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+)
+
+type CallHierarchy struct {
+	Function  string              `json:"function"`
+	Position  *Position           `json:"position,omitempty"`
+	Algorithm string              `json:"algorithm"`
+	Depth     int                 `json:"depth"`
+	Incoming  []CallHierarchyItem `json:"incoming,omitempty"`
+	Outgoing  []CallHierarchyItem `json:"outgoing,omitempty"`
+}
+
+// CallHierarchyItem is a caller or callee found Depth calls away from the
+// target, reached through From, the item one level closer to it
+type CallHierarchyItem struct {
+	Function  string     `json:"function"`
+	Package   string     `json:"package,omitempty"`
+	Position  *Position  `json:"position,omitempty"`
+	Depth     int        `json:"depth"`
+	From      string     `json:"from"`
+	Dynamic   bool       `json:"dynamic"`
+	CallSites []Position `json:"call_sites"`
+}
+
+// callWalker walks a call graph treating each source function, together
+// with the function literals nested in it, as a single node. Test and
+// non-test variants of the same function are merged by declaring position.
+type callWalker struct {
+	fset            *token.FileSet
+	root            string
+	includeExternal bool
+	nodes           map[string][]*callgraph.Node
+}
+
+type callNeighbor struct {
+	fn      *ssa.Function
+	dynamic bool
+	sites   []Position
+}
+
+func callHierarchy(ctx context.Context, dir, file string, line, column int, symbol, direction, algorithm string, depth int, includeExternal bool) (*CallHierarchy, error) {
+	switch direction {
+	case "incoming", "outgoing", "both":
+	default:
+		return nil, fmt.Errorf("unknown direction %q (want incoming, outgoing or both)", direction)
+	}
+	if depth < 1 {
+		return nil, fmt.Errorf("depth must be at least 1")
+	}
+
+	ws, _, err := workspaces.forDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var graph *callgraph.Graph
+	var pkgs []*packages.Package
+	err = await(ctx, func() (err error) {
+		graph, pkgs, err = ws.callGraph(ctx, algorithm)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) == 0 {
+		return nil, fmt.Errorf("no packages found in %s", ws.root)
+	}
+
+	target, err := resolveObject(pkgs, file, line, column, symbol)
+	if err != nil {
+		return nil, err
+	}
+	fn, ok := target.(*types.Func)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a function or method", qualifiedName(target))
+	}
+	if recv := fn.Signature().Recv(); recv != nil && types.IsInterface(recv.Type()) {
+		return nil, fmt.Errorf("%s is an interface method; query a concrete method with algorithm cha or vta instead", qualifiedName(target))
+	}
+
+	walker := &callWalker{
+		fset:            pkgs[0].Fset,
+		root:            ws.root,
+		includeExternal: includeExternal,
+		nodes:           make(map[string][]*callgraph.Node),
+	}
+	for fn, node := range graph.Nodes {
+		if fn != nil {
+			key := walker.key(enclosingFunc(fn))
+			walker.nodes[key] = append(walker.nodes[key], node)
+		}
+	}
+
+	targetKey := objectKey(walker.fset, target)
+	if len(walker.nodes[targetKey]) == 0 {
+		return nil, fmt.Errorf("%s is not in the call graph", qualifiedName(target))
+	}
+
+	result := &CallHierarchy{
+		Function:  qualifiedName(target),
+		Algorithm: algorithm,
+		Depth:     depth,
+	}
+	if target.Pos().IsValid() {
+		pos := newPosition(walker.fset.Position(target.Pos()))
+		result.Position = &pos
+	}
+
+	if direction != "outgoing" {
+		result.Incoming = walker.walk(targetKey, result.Function, depth, true)
+	}
+	if direction != "incoming" {
+		result.Outgoing = walker.walk(targetKey, result.Function, depth, false)
+	}
+
+	return result, nil
+}
+
+// walk collects the functions within depth calls of start, breadth first
+func (w *callWalker) walk(start, name string, depth int, incoming bool) []CallHierarchyItem {
+	items := []CallHierarchyItem{}
+	visited := map[string]bool{start: true}
+
+	type frontierEntry struct {
+		key  string
+		name string
+	}
+	frontier := []frontierEntry{{start, name}}
+
+	for level := 1; level <= depth && len(frontier) > 0; level++ {
+		var next []frontierEntry
+		for _, entry := range frontier {
+			neighbors := w.neighbors(entry.key, incoming)
+
+			var keys []string
+			for key := range neighbors {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			for _, key := range keys {
+				if visited[key] {
+					continue
+				}
+				visited[key] = true
+
+				neighbor := neighbors[key]
+				item := CallHierarchyItem{
+					Function:  functionName(neighbor.fn),
+					Depth:     level,
+					From:      entry.name,
+					Dynamic:   neighbor.dynamic,
+					CallSites: neighbor.sites,
+				}
+				if neighbor.fn.Pkg != nil {
+					item.Package = neighbor.fn.Pkg.Pkg.Path()
+				}
+				if neighbor.fn.Pos().IsValid() {
+					pos := newPosition(w.fset.Position(neighbor.fn.Pos()))
+					item.Position = &pos
+				}
+				items = append(items, item)
+				next = append(next, frontierEntry{key, item.Function})
+			}
+		}
+		frontier = next
+	}
+
+	return items
+}
+
+// neighbors returns the callers or callees of the node identified by key,
+// keyed the same way
+func (w *callWalker) neighbors(key string, incoming bool) map[string]*callNeighbor {
+	result := make(map[string]*callNeighbor)
+
+	for _, node := range w.nodes[key] {
+		edges := node.Out
+		if incoming {
+			edges = node.In
+		}
+
+		for _, edge := range edges {
+			other := edge.Callee
+			if incoming {
+				other = edge.Caller
+			}
+			if other.Func == nil {
+				continue
+			}
+
+			fn := enclosingFunc(other.Func)
+			otherKey := w.key(fn)
+			if otherKey == key || !w.includeExternal && !w.inWorkspace(fn) {
+				continue
+			}
+
+			neighbor, ok := result[otherKey]
+			if !ok {
+				neighbor = &callNeighbor{fn: fn, sites: []Position{}}
+				result[otherKey] = neighbor
+			}
+			if edge.Site != nil && edge.Site.Common().StaticCallee() == nil {
+				neighbor.dynamic = true
+			}
+			if pos := edge.Pos(); pos.IsValid() {
+				site := newPosition(w.fset.Position(pos))
+				if !containsPosition(neighbor.sites, site) {
+					neighbor.sites = append(neighbor.sites, site)
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// key identifies fn by its declaring position so that the copies built for
+// test variants of a package coincide
+func (w *callWalker) key(fn *ssa.Function) string {
+	if obj := fn.Object(); obj != nil {
+		if key := objectKey(w.fset, obj); key != "" {
+			return key
+		}
+	}
+	if fn.Pos().IsValid() {
+		pos := w.fset.Position(fn.Pos())
+		return fmt.Sprintf("%s:%d:%d:%s", pos.Filename, pos.Line, pos.Column, fn.Name())
+	}
+	return fn.String()
+}
+
+func (w *callWalker) inWorkspace(fn *ssa.Function) bool {
+	return fn.Pos().IsValid() && isWithin(w.root, w.fset.Position(fn.Pos()).Filename)
+}
+
+// enclosingFunc returns the outermost function lexically enclosing fn, so
+// calls made from function literals are attributed to their declaration
+func enclosingFunc(fn *ssa.Function) *ssa.Function {
+	for fn.Parent() != nil {
+		fn = fn.Parent()
+	}
+	return fn
+}
+
+func functionName(fn *ssa.Function) string {
+	if obj := fn.Object(); obj != nil {
+		if origin, ok := obj.(*types.Func); ok {
+			return qualifiedName(origin.Origin())
+		}
+		return qualifiedName(obj)
+	}
+	return fn.String()
+}
+
+func containsPosition(positions []Position, pos Position) bool {
+	for _, p := range positions {
+		if p == pos {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,547 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Dependency graph types
+type DependencyGraph struct {
+	Level string      `json:"level"`
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+type GraphNode struct {
+	ID        string `json:"id"`
+	Label     string `json:"label"`
+	Package   string `json:"package"`
+	Kind      string `json:"kind"`
+	Collapsed int    `json:"collapsed,omitempty"`
+}
+
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+type graphOptions struct {
+	level         string
+	focus         string
+	depth         int
+	excludeStdlib bool
+	collapse      []string
+}
+
+// Type-level edge kinds, strongest first
+var typeEdgeRank = map[string]int{
+	"embeds": 3,
+	"field":  2,
+	"method": 1,
+}
+
+// dependencyGraph renders the package import graph, or the graph of named
+// types referencing each other, as DOT, Mermaid or JSON
+func dependencyGraph(ctx context.Context, dir, format string, opts graphOptions) (string, error) {
+	var graph *DependencyGraph
+	var module string
+	var err error
+
+	switch opts.level {
+	case "", "package":
+		graph, module, err = packageGraph(ctx, dir)
+	case "type":
+		graph, module, err = typeGraph(ctx, dir)
+	default:
+		return "", fmt.Errorf("unknown level %q (want package or type)", opts.level)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if opts.excludeStdlib {
+		graph.filterNodes(func(node GraphNode) bool {
+			return node.Kind != importStdlib
+		})
+	}
+	if len(opts.collapse) > 0 {
+		graph.collapse(opts.collapse, module)
+	}
+	if err := graph.limit(opts.focus, opts.depth, module); err != nil {
+		return "", err
+	}
+
+	switch format {
+	case "", "dot":
+		return graph.dot(), nil
+	case "mermaid":
+		return graph.mermaid(), nil
+	case "json":
+		jsonData, err := json.Marshal(graph)
+		if err != nil {
+			return "", err
+		}
+		return string(jsonData), nil
+	default:
+		return "", fmt.Errorf("unknown format %q (want dot, mermaid or json)", format)
+	}
+}
+
+func packageGraph(ctx context.Context, dir string) (*DependencyGraph, string, error) {
+	imports, err := buildImportGraph(ctx, dir, false)
+	if err != nil {
+		return nil, "", err
+	}
+
+	graph := &DependencyGraph{Level: "package"}
+	nodes := make(map[string]bool)
+	addNode := func(path, kind string) {
+		if nodes[path] {
+			return
+		}
+		nodes[path] = true
+		graph.Nodes = append(graph.Nodes, GraphNode{
+			ID:      path,
+			Label:   packageLabel(path, imports.module),
+			Package: path,
+			Kind:    kind,
+		})
+	}
+
+	for _, path := range imports.sortedPackages() {
+		addNode(path, importInternal)
+	}
+	for _, path := range imports.sortedPackages() {
+		for _, edge := range imports.packages[path].sortedImports() {
+			addNode(edge.to, edge.kind)
+			graph.Edges = append(graph.Edges, GraphEdge{From: path, To: edge.to, Kind: "imports"})
+		}
+	}
+	graph.sort()
+
+	return graph, imports.module, nil
+}
+
+// typeGraph links each named type declared under dir to the named types its
+// fields, embedded types and method signatures refer to
+func typeGraph(ctx context.Context, dir string) (*DependencyGraph, string, error) {
+	pkgs, err := loadPackages(ctx, dir)
+	if err != nil {
+		return nil, "", err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	module := modulePath(findModuleRoot(absDir))
+
+	graph := &DependencyGraph{Level: "type"}
+	nodes := make(map[string]bool)
+	edges := make(map[[2]string]string)
+
+	addNode := func(obj *types.TypeName) string {
+		id := obj.Pkg().Path() + "." + obj.Name()
+		if !nodes[id] {
+			nodes[id] = true
+			graph.Nodes = append(graph.Nodes, GraphNode{
+				ID:      id,
+				Label:   obj.Name(),
+				Package: obj.Pkg().Path(),
+				Kind:    classifyImport(obj.Pkg().Path(), module),
+			})
+		}
+		return id
+	}
+
+	for _, pkg := range analysisPackages(pkgs) {
+		if pkg.Types == nil || strings.HasSuffix(pkg.PkgPath, "_test") {
+			continue
+		}
+		scope := pkg.Types.Scope()
+		for _, name := range scope.Names() {
+			obj, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || obj.IsAlias() {
+				continue
+			}
+			named, ok := obj.Type().(*types.Named)
+			if !ok {
+				continue
+			}
+			from := addNode(obj)
+
+			link := func(kind string) func(*types.Named) {
+				return func(target *types.Named) {
+					if target.Obj() == obj || target.Obj().Pkg() == nil {
+						return
+					}
+					key := [2]string{from, addNode(target.Obj())}
+					if typeEdgeRank[kind] > typeEdgeRank[edges[key]] {
+						edges[key] = kind
+					}
+				}
+			}
+
+			switch underlying := named.Underlying().(type) {
+			case *types.Struct:
+				for i := 0; i < underlying.NumFields(); i++ {
+					field := underlying.Field(i)
+					kind := "field"
+					if field.Embedded() {
+						kind = "embeds"
+					}
+					typeReferences(field.Type(), link(kind), nil)
+				}
+			case *types.Interface:
+				for i := 0; i < underlying.NumEmbeddeds(); i++ {
+					typeReferences(underlying.EmbeddedType(i), link("embeds"), nil)
+				}
+				for i := 0; i < underlying.NumExplicitMethods(); i++ {
+					typeReferences(underlying.ExplicitMethod(i).Type(), link("method"), nil)
+				}
+			default:
+				typeReferences(underlying, link("field"), nil)
+			}
+			for i := 0; i < named.NumMethods(); i++ {
+				typeReferences(named.Method(i).Type(), link("method"), nil)
+			}
+		}
+	}
+
+	for key, kind := range edges {
+		graph.Edges = append(graph.Edges, GraphEdge{From: key[0], To: key[1], Kind: kind})
+	}
+	graph.sort()
+
+	return graph, module, nil
+}
+
+// typeReferences calls visit for every named type appearing in t, without
+// descending into the named types themselves
+func typeReferences(t types.Type, visit func(*types.Named), seen map[types.Type]bool) {
+	if seen == nil {
+		seen = make(map[types.Type]bool)
+	}
+	if seen[t] {
+		return
+	}
+	seen[t] = true
+
+	switch t := types.Unalias(t).(type) {
+	case *types.Named:
+		visit(t.Origin())
+		for i := 0; i < t.TypeArgs().Len(); i++ {
+			typeReferences(t.TypeArgs().At(i), visit, seen)
+		}
+	case *types.Pointer:
+		typeReferences(t.Elem(), visit, seen)
+	case *types.Slice:
+		typeReferences(t.Elem(), visit, seen)
+	case *types.Array:
+		typeReferences(t.Elem(), visit, seen)
+	case *types.Chan:
+		typeReferences(t.Elem(), visit, seen)
+	case *types.Map:
+		typeReferences(t.Key(), visit, seen)
+		typeReferences(t.Elem(), visit, seen)
+	case *types.Signature:
+		for _, tuple := range []*types.Tuple{t.Params(), t.Results()} {
+			for i := 0; i < tuple.Len(); i++ {
+				typeReferences(tuple.At(i).Type(), visit, seen)
+			}
+		}
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			typeReferences(t.Field(i).Type(), visit, seen)
+		}
+	case *types.Interface:
+		for i := 0; i < t.NumEmbeddeds(); i++ {
+			typeReferences(t.EmbeddedType(i), visit, seen)
+		}
+		for i := 0; i < t.NumExplicitMethods(); i++ {
+			typeReferences(t.ExplicitMethod(i).Type(), visit, seen)
+		}
+	}
+}
+
+func packageLabel(path, module string) string {
+	if module != "" && strings.HasPrefix(path, module+"/") {
+		return strings.TrimPrefix(path, module+"/")
+	}
+	return path
+}
+
+// filterNodes keeps the nodes matching keep and the edges between them
+func (g *DependencyGraph) filterNodes(keep func(GraphNode) bool) {
+	kept := make(map[string]bool)
+	nodes := g.Nodes[:0]
+	for _, node := range g.Nodes {
+		if keep(node) {
+			kept[node.ID] = true
+			nodes = append(nodes, node)
+		}
+	}
+	g.Nodes = nodes
+
+	edges := g.Edges[:0]
+	for _, edge := range g.Edges {
+		if kept[edge.From] && kept[edge.To] {
+			edges = append(edges, edge)
+		}
+	}
+	g.Edges = edges
+}
+
+// collapse merges every node whose package lies under one of prefixes into
+// a single node for that prefix. Prefixes may be import paths or paths
+// relative to the module.
+func (g *DependencyGraph) collapse(prefixes []string, module string) {
+	groupOf := func(pkg string) string {
+		best := ""
+		for _, prefix := range prefixes {
+			prefix = strings.TrimSuffix(strings.TrimSpace(prefix), "/")
+			if prefix == "" {
+				continue
+			}
+			for _, candidate := range []string{prefix, module + "/" + prefix} {
+				if (pkg == candidate || strings.HasPrefix(pkg, candidate+"/")) && len(candidate) > len(best) {
+					best = candidate
+				}
+			}
+		}
+		return best
+	}
+
+	rename := make(map[string]string)
+	merged := make(map[string]int)
+	var nodes []GraphNode
+	for _, node := range g.Nodes {
+		group := groupOf(node.Package)
+		if group == "" {
+			rename[node.ID] = node.ID
+			nodes = append(nodes, node)
+			continue
+		}
+		rename[node.ID] = group
+		if merged[group] == 0 {
+			nodes = append(nodes, GraphNode{
+				ID:      group,
+				Label:   packageLabel(group, module) + "/...",
+				Package: group,
+				Kind:    node.Kind,
+			})
+		}
+		merged[group]++
+	}
+	for i := range nodes {
+		nodes[i].Collapsed = merged[nodes[i].ID]
+	}
+	g.Nodes = nodes
+
+	seen := make(map[[2]string]bool)
+	var edges []GraphEdge
+	for _, edge := range g.Edges {
+		edge.From, edge.To = rename[edge.From], rename[edge.To]
+		key := [2]string{edge.From, edge.To}
+		if edge.From == edge.To || seen[key] {
+			continue
+		}
+		seen[key] = true
+		edges = append(edges, edge)
+	}
+	g.Edges = edges
+	g.sort()
+}
+
+// limit restricts the graph to nodes within depth edges of focus, in either
+// direction. Without a focus, depth counts from the workspace nodes nothing
+// else depends on. A depth of 0 means unlimited.
+func (g *DependencyGraph) limit(focus string, depth int, module string) error {
+	if focus == "" && depth <= 0 {
+		return nil
+	}
+
+	outgoing := make(map[string][]string)
+	incoming := make(map[string][]string)
+	for _, edge := range g.Edges {
+		outgoing[edge.From] = append(outgoing[edge.From], edge.To)
+		incoming[edge.To] = append(incoming[edge.To], edge.From)
+	}
+
+	var start []string
+	for _, node := range g.Nodes {
+		switch {
+		case focus != "":
+			if node.ID == focus || node.Package == focus || node.Package == module+"/"+focus || focus == "." && node.Package == module {
+				start = append(start, node.ID)
+			}
+		case node.Kind == importInternal && len(incoming[node.ID]) == 0:
+			start = append(start, node.ID)
+		}
+	}
+	if focus != "" && len(start) == 0 {
+		return fmt.Errorf("focus %q matches no node in the graph", focus)
+	}
+
+	kept := make(map[string]bool)
+	reach := func(next map[string][]string) {
+		distance := make(map[string]int)
+		queue := append([]string{}, start...)
+		for _, id := range start {
+			distance[id] = 0
+			kept[id] = true
+		}
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = queue[1:]
+			if depth > 0 && distance[id] >= depth {
+				continue
+			}
+			for _, to := range next[id] {
+				if _, seen := distance[to]; seen {
+					continue
+				}
+				distance[to] = distance[id] + 1
+				kept[to] = true
+				queue = append(queue, to)
+			}
+		}
+	}
+
+	reach(outgoing)
+	if focus != "" {
+		reach(incoming)
+	}
+
+	g.filterNodes(func(node GraphNode) bool {
+		return kept[node.ID]
+	})
+	return nil
+}
+
+func (g *DependencyGraph) sort() {
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		return g.Nodes[i].ID < g.Nodes[j].ID
+	})
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+}
+
+var graphColors = map[string]string{
+	importInternal:   "#cfe2ff",
+	importStdlib:     "#e9ecef",
+	importThirdParty: "#fff3cd",
+}
+
+// packageGroups returns the nodes grouped by package for clustering type
+// graphs, in package order
+func (g *DependencyGraph) packageGroups() ([]string, map[string][]GraphNode) {
+	groups := make(map[string][]GraphNode)
+	var order []string
+	for _, node := range g.Nodes {
+		if _, ok := groups[node.Package]; !ok {
+			order = append(order, node.Package)
+		}
+		groups[node.Package] = append(groups[node.Package], node)
+	}
+	sort.Strings(order)
+	return order, groups
+}
+
+func (g *DependencyGraph) dot() string {
+	var b strings.Builder
+	b.WriteString("digraph dependencies {\n")
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tnode [shape=box, style=filled, fontname=\"Helvetica\"];\n")
+
+	writeNode := func(indent string, node GraphNode) {
+		fmt.Fprintf(&b, "%s%s [label=%s, fillcolor=%s];\n", indent, dotQuote(node.ID), dotQuote(node.Label), dotQuote(graphColors[node.Kind]))
+	}
+
+	if g.Level == "type" {
+		order, groups := g.packageGroups()
+		for i, pkg := range order {
+			fmt.Fprintf(&b, "\tsubgraph cluster_%d {\n\t\tlabel=%s;\n", i, dotQuote(pkg))
+			for _, node := range groups[pkg] {
+				writeNode("\t\t", node)
+			}
+			b.WriteString("\t}\n")
+		}
+	} else {
+		for _, node := range g.Nodes {
+			writeNode("\t", node)
+		}
+	}
+
+	for _, edge := range g.Edges {
+		if g.Level == "type" {
+			fmt.Fprintf(&b, "\t%s -> %s [label=%s];\n", dotQuote(edge.From), dotQuote(edge.To), dotQuote(edge.Kind))
+		} else {
+			fmt.Fprintf(&b, "\t%s -> %s;\n", dotQuote(edge.From), dotQuote(edge.To))
+		}
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func (g *DependencyGraph) mermaid() string {
+	// Mermaid ids must be plain identifiers
+	ids := make(map[string]string)
+	for i, node := range g.Nodes {
+		ids[node.ID] = fmt.Sprintf("n%d", i)
+	}
+
+	var b strings.Builder
+	b.WriteString("graph LR\n")
+
+	writeNode := func(indent string, node GraphNode) {
+		fmt.Fprintf(&b, "%s%s[\"%s\"]:::%s\n", indent, ids[node.ID], mermaidEscape(node.Label), node.Kind)
+	}
+
+	if g.Level == "type" {
+		order, groups := g.packageGroups()
+		for i, pkg := range order {
+			fmt.Fprintf(&b, "\tsubgraph p%d[\"%s\"]\n", i, mermaidEscape(pkg))
+			for _, node := range groups[pkg] {
+				writeNode("\t\t", node)
+			}
+			b.WriteString("\tend\n")
+		}
+	} else {
+		for _, node := range g.Nodes {
+			writeNode("\t", node)
+		}
+	}
+
+	for _, edge := range g.Edges {
+		if g.Level == "type" {
+			fmt.Fprintf(&b, "\t%s -->|%s| %s\n", ids[edge.From], edge.Kind, ids[edge.To])
+		} else {
+			fmt.Fprintf(&b, "\t%s --> %s\n", ids[edge.From], ids[edge.To])
+		}
+	}
+
+	for _, kind := range []string{importInternal, importStdlib, importThirdParty} {
+		fmt.Fprintf(&b, "\tclassDef %s fill:%s\n", kind, graphColors[kind])
+	}
+
+	return b.String()
+}
+
+func mermaidEscape(s string) string {
+	return strings.ReplaceAll(s, `"`, "#quot;")
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
 	"strings"
@@ -44,10 +45,10 @@ type ApiVariable struct {
 	Position Position `json:"position"`
 }
 
-func extractApi(dir string) ([]ApiInfo, error) {
+func extractApi(ctx context.Context, dir string) ([]ApiInfo, error) {
 	var apis []ApiInfo
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		if strings.HasSuffix(path, "_test.go") {
 			return nil
 		}
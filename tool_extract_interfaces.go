@@ -1,123 +1,323 @@
 package main
 
 import (
-	"go/ast"
+	"context"
+	"fmt"
 	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
 )
 
 // Interface analysis types
 type InterfaceInfo struct {
-	Name           string               `json:"name"`
-	Package        string               `json:"package"`
-	Position       Position             `json:"position"`
-	Methods        []MethodInfo         `json:"methods"`
+	Name            string               `json:"name"`
+	Package         string               `json:"package"`
+	PackagePath     string               `json:"package_path"`
+	Position        Position             `json:"position"`
+	Methods         []MethodInfo         `json:"methods"`
 	Implementations []ImplementationType `json:"implementations,omitempty"`
+	NearMisses      []NearMiss           `json:"near_misses,omitempty"`
 }
 
+// ImplementationType is a concrete type satisfying an interface; Pointer is
+// set when only *T has the required method set
 type ImplementationType struct {
+	Type        string   `json:"type"`
+	Package     string   `json:"package"`
+	PackagePath string   `json:"package_path"`
+	Pointer     bool     `json:"pointer"`
+	Position    Position `json:"position"`
+}
+
+// NearMiss is a type declaring a method the interface requires, but with a
+// different signature
+type NearMiss struct {
 	Type     string   `json:"type"`
 	Package  string   `json:"package"`
+	Method   string   `json:"method"`
+	Reason   string   `json:"reason"`
 	Position Position `json:"position"`
 }
 
-func extractInterfaces(dir string, interfaceName string) ([]InterfaceInfo, error) {
-	var interfaces []InterfaceInfo
-	interfaceMap := make(map[string]*InterfaceInfo)
-
-	// First pass: collect all interfaces
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
-		ast.Inspect(file, func(n ast.Node) bool {
-			if genDecl, ok := n.(*ast.GenDecl); ok {
-				for _, spec := range genDecl.Specs {
-					if typeSpec, ok := spec.(*ast.TypeSpec); ok {
-						if iface, ok := typeSpec.Type.(*ast.InterfaceType); ok {
-							name := typeSpec.Name.Name
-							if interfaceName == "" || name == interfaceName {
-								pos := fset.Position(typeSpec.Pos())
-								info := &InterfaceInfo{
-									Name:     name,
-									Package:  file.Name.Name,
-									Position: newPosition(pos),
-									Methods:  extractInterfaceMethods(iface, fset),
-								}
-								interfaceMap[name] = info
-							}
-						}
-					}
+type TypeInterfaces struct {
+	Type        string                 `json:"type"`
+	Package     string                 `json:"package"`
+	PackagePath string                 `json:"package_path"`
+	Position    Position               `json:"position"`
+	Interfaces  []ImplementedInterface `json:"interfaces"`
+}
+
+type ImplementedInterface struct {
+	Interface   string   `json:"interface"`
+	Package     string   `json:"package"`
+	PackagePath string   `json:"package_path"`
+	Pointer     bool     `json:"pointer"`
+	Position    Position `json:"position"`
+}
+
+// extractInterfaces lists the interfaces declared under dir, or with
+// interfaceName the matching interface and every concrete type in the module
+// (and optionally its dependencies) implementing it
+func extractInterfaces(ctx context.Context, dir string, interfaceName string, includeDeps bool) ([]InterfaceInfo, error) {
+	pkgs, err := loadPackages(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	interfaces := []InterfaceInfo{}
+	if len(pkgs) == 0 {
+		return interfaces, nil
+	}
+
+	var matched []*types.TypeName
+	for _, typeName := range namedTypes(pkgs, false) {
+		if !types.IsInterface(typeName.Type()) {
+			continue
+		}
+		if interfaceName == "" || objectMatches(typeName, interfaceName) {
+			matched = append(matched, typeName)
+		}
+	}
+
+	if interfaceName == "" {
+		for _, typeName := range matched {
+			interfaces = append(interfaces, newInterfaceInfo(typeName, pkgs[0].Fset))
+		}
+		return interfaces, nil
+	}
+
+	modulePkgs, root, err := loadModulePackages(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	fset := modulePkgs[0].Fset
+
+	// Allow naming dependency interfaces such as io.Writer
+	if len(matched) == 0 {
+		for _, typeName := range namedTypes(dependencyPackages(modulePkgs, root), true) {
+			if types.IsInterface(typeName.Type()) && objectMatches(typeName, interfaceName) {
+				matched = append(matched, typeName)
+			}
+		}
+	}
+
+	candidates := namedTypes(modulePkgs, false)
+	if includeDeps {
+		candidates = append(candidates, namedTypes(dependencyPackages(modulePkgs, root), true)...)
+	}
+
+	for _, typeName := range matched {
+		info := newInterfaceInfo(typeName, fset)
+		iface := typeName.Type().Underlying().(*types.Interface)
+
+		// Every type satisfies an empty interface
+		if iface.NumMethods() > 0 {
+			for _, candidate := range candidates {
+				if types.IsInterface(candidate.Type()) {
+					continue
+				}
+				if impl, ok := implementation(candidate, iface); ok {
+					info.Implementations = append(info.Implementations, ImplementationType{
+						Type:        candidate.Name(),
+						Package:     candidate.Pkg().Name(),
+						PackagePath: candidate.Pkg().Path(),
+						Pointer:     impl,
+						Position:    newPosition(fset.Position(candidate.Pos())),
+					})
+				} else if miss, ok := nearMiss(candidate, iface, fset); ok {
+					info.NearMisses = append(info.NearMisses, miss)
 				}
 			}
-			return true
-		})
-		return nil
-	})
+		}
+
+		interfaces = append(interfaces, info)
+	}
 
+	return interfaces, nil
+}
+
+// satisfiedInterfaces lists the interfaces in the module (and optionally its
+// dependencies) that typeName or a pointer to it implements
+func satisfiedInterfaces(ctx context.Context, dir string, typeName string, includeDeps bool) ([]TypeInterfaces, error) {
+	modulePkgs, root, err := loadModulePackages(ctx, dir)
 	if err != nil {
 		return nil, err
 	}
+	if len(modulePkgs) == 0 {
+		return nil, fmt.Errorf("no packages found in %s", root)
+	}
+	fset := modulePkgs[0].Fset
 
-	// Second pass: find implementations
-	if interfaceName != "" {
-		iface, exists := interfaceMap[interfaceName]
-		if exists {
-			err = walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
-				// Collect all types with methods
-				types := make(map[string][]string)
-				
-				for _, decl := range file.Decls {
-					if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv != nil {
-						for _, recv := range fn.Recv.List {
-							typeName := getTypeName(recv.Type)
-							types[typeName] = append(types[typeName], fn.Name.Name)
-						}
-					}
-				}
+	var targets []*types.TypeName
+	for _, obj := range lookupSymbol(modulePkgs, typeName) {
+		if tn, ok := obj.(*types.TypeName); ok && !types.IsInterface(tn.Type()) {
+			targets = append(targets, tn)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("concrete type %s not found", typeName)
+	}
 
-				// Check if any type implements the interface
-				for typeName, methods := range types {
-					if implementsInterface(methods, iface.Methods) {
-						// Find type declaration
-						ast.Inspect(file, func(n ast.Node) bool {
-							if genDecl, ok := n.(*ast.GenDecl); ok {
-								for _, spec := range genDecl.Specs {
-									if typeSpec, ok := spec.(*ast.TypeSpec); ok && typeSpec.Name.Name == typeName {
-										pos := fset.Position(typeSpec.Pos())
-										iface.Implementations = append(iface.Implementations, ImplementationType{
-											Type:     typeName,
-											Package:  file.Name.Name,
-											Position: newPosition(pos),
-										})
-									}
-								}
-							}
-							return true
-						})
-					}
-				}
-				return nil
-			})
+	candidates := namedTypes(modulePkgs, false)
+	if includeDeps {
+		candidates = append(candidates, namedTypes(dependencyPackages(modulePkgs, root), true)...)
+	}
+
+	var result []TypeInterfaces
+	for _, target := range targets {
+		entry := TypeInterfaces{
+			Type:        target.Name(),
+			Package:     target.Pkg().Name(),
+			PackagePath: target.Pkg().Path(),
+			Position:    newPosition(fset.Position(target.Pos())),
+			Interfaces:  []ImplementedInterface{},
+		}
+
+		for _, candidate := range candidates {
+			if !types.IsInterface(candidate.Type()) {
+				continue
+			}
+			iface := candidate.Type().Underlying().(*types.Interface)
+			if iface.NumMethods() == 0 {
+				continue
+			}
+			if pointer, ok := implementation(target, iface); ok {
+				entry.Interfaces = append(entry.Interfaces, ImplementedInterface{
+					Interface:   candidate.Name(),
+					Package:     candidate.Pkg().Name(),
+					PackagePath: candidate.Pkg().Path(),
+					Pointer:     pointer,
+					Position:    newPosition(fset.Position(candidate.Pos())),
+				})
+			}
+		}
+
+		result = append(result, entry)
+	}
+
+	return result, nil
+}
+
+func newInterfaceInfo(typeName *types.TypeName, fset *token.FileSet) InterfaceInfo {
+	qualifier := packageNameQualifier(typeName.Pkg())
+	iface := typeName.Type().Underlying().(*types.Interface)
+
+	info := InterfaceInfo{
+		Name:        typeName.Name(),
+		Package:     typeName.Pkg().Name(),
+		PackagePath: typeName.Pkg().Path(),
+		Position:    newPosition(fset.Position(typeName.Pos())),
+		Methods:     []MethodInfo{},
+	}
+
+	// The full method set, including methods of embedded interfaces
+	for i := 0; i < iface.NumMethods(); i++ {
+		method := iface.Method(i)
+		info.Methods = append(info.Methods, MethodInfo{
+			Name:      method.Name(),
+			Signature: types.TypeString(method.Type(), qualifier),
+			Exported:  method.Exported(),
+			Position:  newPosition(fset.Position(method.Pos())),
+		})
+	}
+
+	return info
+}
+
+// implementation reports whether T or *T implements iface, and whether the
+// pointer is required
+func implementation(typeName *types.TypeName, iface *types.Interface) (pointer bool, ok bool) {
+	t := typeName.Type()
+	if types.Implements(t, iface) {
+		return false, true
+	}
+	if _, isPtr := t.Underlying().(*types.Pointer); !isPtr && types.Implements(types.NewPointer(t), iface) {
+		return true, true
+	}
+	return false, false
+}
+
+// nearMiss reports a type whose method set has every method of iface by
+// name but at least one with the wrong signature
+func nearMiss(typeName *types.TypeName, iface *types.Interface, fset *token.FileSet) (NearMiss, bool) {
+	ptr := types.NewPointer(typeName.Type())
+	for i := 0; i < iface.NumMethods(); i++ {
+		if obj, _, _ := types.LookupFieldOrMethod(ptr, false, iface.Method(i).Pkg(), iface.Method(i).Name()); obj == nil {
+			return NearMiss{}, false
 		}
 	}
 
-	// Convert map to slice
-	for _, iface := range interfaceMap {
-		interfaces = append(interfaces, *iface)
+	method, wrongType := types.MissingMethod(ptr, iface, true)
+	if method == nil || !wrongType {
+		return NearMiss{}, false
+	}
+
+	qualifier := packageNameQualifier(typeName.Pkg())
+	reason := fmt.Sprintf("wants %s", types.TypeString(method.Type(), qualifier))
+	if have, _, _ := types.LookupFieldOrMethod(ptr, false, method.Pkg(), method.Name()); have != nil {
+		reason = fmt.Sprintf("has %s, %s", types.TypeString(have.Type(), qualifier), reason)
 	}
 
-	return interfaces, err
+	return NearMiss{
+		Type:     typeName.Name(),
+		Package:  typeName.Pkg().Name(),
+		Method:   method.Name(),
+		Reason:   reason,
+		Position: newPosition(fset.Position(typeName.Pos())),
+	}, true
 }
 
-func implementsInterface(methods []string, interfaceMethods []MethodInfo) bool {
-	for _, im := range interfaceMethods {
-		found := false
-		for _, m := range methods {
-			if m == im.Name {
-				found = true
-				break
+// namedTypes returns the non-generic, non-alias package-level types declared
+// in pkgs, merging test variants
+func namedTypes(pkgs []*packages.Package, exportedOnly bool) []*types.TypeName {
+	var result []*types.TypeName
+	seen := make(map[string]bool)
+
+	for _, pkg := range pkgs {
+		if pkg.Types == nil {
+			continue
+		}
+		scope := pkg.Types.Scope()
+		for _, name := range scope.Names() {
+			typeName, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || typeName.IsAlias() || exportedOnly && !typeName.Exported() {
+				continue
 			}
+			named, ok := typeName.Type().(*types.Named)
+			if !ok || named.TypeParams().Len() > 0 {
+				continue
+			}
+			key := objectKey(pkg.Fset, typeName)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			result = append(result, typeName)
 		}
-		if !found {
-			return false
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return qualifiedName(result[i]) < qualifiedName(result[j])
+	})
+	return result
+}
+
+// dependencyPackages returns the packages imported, directly or not, by the
+// module, excluding the module's own and internal standard library packages
+func dependencyPackages(pkgs []*packages.Package, root string) []*packages.Package {
+	var deps []*packages.Package
+	for _, pkg := range packageIndex(pkgs) {
+		if isWithin(root, pkg.Dir) || isInternalPath(pkg.PkgPath) {
+			continue
 		}
+		deps = append(deps, pkg)
 	}
-	return true
-}
\ No newline at end of file
+	return deps
+}
+
+func isInternalPath(path string) bool {
+	return path == "internal" || strings.HasPrefix(path, "internal/") || strings.Contains(path, "/internal/") || strings.HasSuffix(path, "/internal")
+}
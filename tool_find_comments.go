@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
 	"regexp"
@@ -41,10 +42,10 @@ func getContext(src []byte, pos token.Position, contextLines int) []string {
 	return context
 }
 
-func findComments(dir string, commentType string, filter string, includeContext bool) ([]CommentInfo, error) {
+func findComments(ctx context.Context, dir string, commentType string, filter string, includeContext bool) ([]CommentInfo, error) {
 	var comments []CommentInfo
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		info := CommentInfo{
 			File: path,
 		}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
 	"strings"
@@ -21,10 +22,10 @@ type ContextUsage struct {
 	Position    Position `json:"position"`
 }
 
-func findContextUsage(dir string) ([]ContextInfo, error) {
+func findContextUsage(ctx context.Context, dir string) ([]ContextInfo, error) {
 	var contextInfo []ContextInfo
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		info := ContextInfo{
 			File: path,
 		}
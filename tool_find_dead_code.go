@@ -1,17 +1,27 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"go/ast"
+	"go/format"
 	"go/token"
+	"go/types"
+	"sort"
 	"strings"
+
+	"golang.org/x/tools/go/callgraph/rta"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
 )
 
 // Dead code analysis types
 type DeadCodeInfo struct {
-	File           string         `json:"file"`
-	UnusedVars     []UnusedItem   `json:"unused_vars,omitempty"`
+	File            string         `json:"file"`
+	Unused          []UnusedItem   `json:"unused,omitempty"`
+	Unreachable     []UnusedItem   `json:"unreachable_exports,omitempty"`
 	UnreachableCode []CodeLocation `json:"unreachable_code,omitempty"`
-	DeadBranches   []CodeLocation `json:"dead_branches,omitempty"`
+	DeadBranches    []CodeLocation `json:"dead_branches,omitempty"`
 }
 
 type UnusedItem struct {
@@ -21,87 +31,447 @@ type UnusedItem struct {
 }
 
 type CodeLocation struct {
-	Description string   `json:"description"`
-	Position    Position `json:"position"`
+	Description    string   `json:"description"`
+	Position       Position `json:"position"`
+	BuildDependent bool     `json:"build_dependent,omitempty"` // the condition uses named constants
 }
 
-func findDeadCode(dir string) ([]DeadCodeInfo, error) {
-	var deadCode []DeadCodeInfo
+// findDeadCode reports unexported declarations nothing in their package
+// uses, exported functions and methods that rapid type analysis cannot reach
+// from any main, init or test function of the workspace, statements after a
+// return and branches behind constant conditions
+func findDeadCode(ctx context.Context, dir string) ([]DeadCodeInfo, error) {
+	ws, absDir, err := workspaces.forDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var prog *ssa.Program
+	var allPkgs []*packages.Package
+	err = await(ctx, func() (err error) {
+		prog, allPkgs, err = ws.ssaProgram(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
-		if strings.HasSuffix(path, "_test.go") {
-			return nil
+	var pkgs []*packages.Package
+	for _, pkg := range allPkgs {
+		if isWithin(absDir, pkg.Dir) {
+			pkgs = append(pkgs, pkg)
 		}
+	}
+	pkgs = analysisPackages(pkgs)
 
-		info := DeadCodeInfo{
-			File: path,
+	byFile := make(map[string]*DeadCodeInfo)
+	infoFor := func(pos token.Position) *DeadCodeInfo {
+		info, ok := byFile[pos.Filename]
+		if !ok {
+			info = &DeadCodeInfo{File: pos.Filename}
+			byFile[pos.Filename] = info
 		}
+		return info
+	}
 
-		// Track variable usage
-		declaredVars := make(map[string]*ast.ValueSpec)
-		usedVars := make(map[string]bool)
+	for _, item := range unusedDeclarations(pkgs) {
+		info := infoFor(token.Position{Filename: item.Position.File})
+		info.Unused = append(info.Unused, item)
+	}
 
-		// First pass: collect declared variables
-		ast.Inspect(file, func(n ast.Node) bool {
-			if genDecl, ok := n.(*ast.GenDecl); ok && genDecl.Tok == token.VAR {
-				for _, spec := range genDecl.Specs {
-					if valueSpec, ok := spec.(*ast.ValueSpec); ok {
-						for _, name := range valueSpec.Names {
-							if name.Name != "_" && !ast.IsExported(name.Name) {
-								declaredVars[name.Name] = valueSpec
-							}
+	for _, item := range unreachableExports(prog, allPkgs, pkgs, ws.root) {
+		info := infoFor(token.Position{Filename: item.Position.File})
+		info.Unreachable = append(info.Unreachable, item)
+	}
+
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Syntax {
+			filename := pkg.Fset.File(file.Pos()).Name()
+			if strings.HasSuffix(filename, "_test.go") {
+				continue
+			}
+
+			ast.Inspect(file, func(n ast.Node) bool {
+				switch node := n.(type) {
+				case *ast.BlockStmt:
+					for i, stmt := range node.List {
+						if _, ok := stmt.(*ast.ReturnStmt); ok && i < len(node.List)-1 {
+							pos := pkg.Fset.Position(node.List[i+1].Pos())
+							infoFor(pos).UnreachableCode = append(infoFor(pos).UnreachableCode, CodeLocation{
+								Description: "Code after return statement",
+								Position:    newPosition(pos),
+							})
 						}
 					}
+				case *ast.IfStmt:
+					if location, ok := constantBranch(pkg, node); ok {
+						info := infoFor(token.Position{Filename: location.Position.File})
+						info.DeadBranches = append(info.DeadBranches, location)
+					}
 				}
-			}
-			return true
-		})
+				return true
+			})
+		}
+	}
 
-		// Second pass: track usage
-		ast.Inspect(file, func(n ast.Node) bool {
-			if ident, ok := n.(*ast.Ident); ok {
-				usedVars[ident.Name] = true
-			}
-			return true
+	deadCode := []DeadCodeInfo{}
+	for _, info := range byFile {
+		for _, items := range [][]UnusedItem{info.Unused, info.Unreachable} {
+			sort.Slice(items, func(i, j int) bool {
+				return items[i].Position.Offset < items[j].Position.Offset
+			})
+		}
+		deadCode = append(deadCode, *info)
+	}
+	sort.Slice(deadCode, func(i, j int) bool {
+		return deadCode[i].File < deadCode[j].File
+	})
+
+	return deadCode, nil
+}
+
+// unusedDeclarations finds unexported package-level functions, types,
+// constants and variables, methods and struct fields declared outside test
+// files that no identifier in the package (tests included) refers to
+func unusedDeclarations(pkgs []*packages.Package) []UnusedItem {
+	used := make(map[string]bool)
+	usedMethods := make(map[string]bool)
+
+	type candidate struct {
+		key  string
+		pkg  string
+		name string
+		kind string
+		pos  token.Position
+	}
+	var candidates []candidate
+	add := func(pkg *packages.Package, ident *ast.Ident, name, kind string) {
+		obj := pkg.TypesInfo.Defs[ident]
+		if obj == nil || obj.Exported() || obj.Name() == "_" {
+			return
+		}
+		candidates = append(candidates, candidate{
+			key:  objectKey(pkg.Fset, obj),
+			pkg:  pkg.PkgPath,
+			name: name,
+			kind: kind,
+			pos:  pkg.Fset.Position(ident.Pos()),
 		})
+	}
 
-		// Find unused variables
-		for varName, valueSpec := range declaredVars {
-			if !usedVars[varName] {
-				for _, name := range valueSpec.Names {
-					if name.Name == varName {
-						pos := fset.Position(name.Pos())
-						info.UnusedVars = append(info.UnusedVars, UnusedItem{
-							Name:     varName,
-							Type:     "variable",
-							Position: newPosition(pos),
+	for _, pkg := range pkgs {
+		// Uses within a function's own body, or naming the receiver type
+		// of a method, do not keep a declaration alive
+		ownBody := make(map[types.Object][2]token.Pos)
+		skip := make(map[*ast.Ident]bool)
+
+		for _, file := range pkg.Syntax {
+			isTest := strings.HasSuffix(pkg.Fset.File(file.Pos()).Name(), "_test.go")
+
+			for _, decl := range file.Decls {
+				switch decl := decl.(type) {
+				case *ast.FuncDecl:
+					if obj := pkg.TypesInfo.Defs[decl.Name]; obj != nil {
+						ownBody[obj] = [2]token.Pos{decl.Pos(), decl.End()}
+					}
+					if decl.Recv != nil {
+						ast.Inspect(decl.Recv, func(n ast.Node) bool {
+							if ident, ok := n.(*ast.Ident); ok {
+								skip[ident] = true
+							}
+							return true
 						})
 					}
+					if isTest || isLinked(decl) || isEntryFunc(pkg, decl) {
+						continue
+					}
+					if decl.Recv != nil {
+						add(pkg, decl.Name, funcDeclName(decl), "method")
+					} else {
+						add(pkg, decl.Name, decl.Name.Name, "function")
+					}
+
+				case *ast.GenDecl:
+					if isTest {
+						continue
+					}
+					for _, spec := range decl.Specs {
+						switch spec := spec.(type) {
+						case *ast.TypeSpec:
+							add(pkg, spec.Name, spec.Name.Name, "type")
+							st, ok := spec.Type.(*ast.StructType)
+							if !ok {
+								continue
+							}
+							for _, field := range st.Fields.List {
+								// Tagged fields are usually read by reflection
+								if field.Tag != nil {
+									continue
+								}
+								for _, name := range field.Names {
+									add(pkg, name, spec.Name.Name+"."+name.Name, "field")
+								}
+							}
+						case *ast.ValueSpec:
+							kind := "variable"
+							if decl.Tok == token.CONST {
+								kind = "constant"
+							}
+							for _, name := range spec.Names {
+								add(pkg, name, name.Name, kind)
+							}
+						}
+					}
 				}
 			}
-		}
 
-		// Find unreachable code (simplified detection)
-		ast.Inspect(file, func(n ast.Node) bool {
-			if blockStmt, ok := n.(*ast.BlockStmt); ok {
-				for i, stmt := range blockStmt.List {
-					if _, ok := stmt.(*ast.ReturnStmt); ok && i < len(blockStmt.List)-1 {
-						pos := fset.Position(blockStmt.List[i+1].Pos())
-						info.UnreachableCode = append(info.UnreachableCode, CodeLocation{
-							Description: "Code after return statement",
-							Position:    newPosition(pos),
-						})
+			// Unkeyed struct literals set every field
+			ast.Inspect(file, func(n ast.Node) bool {
+				lit, ok := n.(*ast.CompositeLit)
+				if !ok || len(lit.Elts) == 0 {
+					return true
+				}
+				if _, keyed := lit.Elts[0].(*ast.KeyValueExpr); keyed {
+					return true
+				}
+				if st, ok := structType(pkg.TypesInfo.TypeOf(lit)); ok {
+					for i := 0; i < st.NumFields(); i++ {
+						used[objectKey(pkg.Fset, st.Field(i))] = true
 					}
 				}
+				return true
+			})
+		}
+
+		for ident, obj := range pkg.TypesInfo.Uses {
+			if skip[ident] {
+				continue
 			}
-			return true
+			switch o := obj.(type) {
+			case *types.Func:
+				obj = o.Origin()
+			case *types.Var:
+				obj = o.Origin()
+			}
+			if body, ok := ownBody[obj]; ok && body[0] <= ident.Pos() && ident.Pos() < body[1] {
+				continue
+			}
+			if fn, ok := obj.(*types.Func); ok && fn.Pkg() != nil && fn.Signature().Recv() != nil {
+				// Calls through an interface reach every method of that name
+				usedMethods[fn.Pkg().Path()+"."+fn.Name()] = true
+			}
+			used[objectKey(pkg.Fset, obj)] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	var unused []UnusedItem
+	for _, c := range candidates {
+		if used[c.key] || seen[c.key] {
+			continue
+		}
+		seen[c.key] = true
+
+		if c.kind == "method" {
+			method := c.name[strings.LastIndex(c.name, ".")+1:]
+			if usedMethods[c.pkg+"."+method] {
+				continue
+			}
+		}
+
+		unused = append(unused, UnusedItem{
+			Name:     c.name,
+			Type:     c.kind,
+			Position: newPosition(c.pos),
 		})
+	}
+
+	return unused
+}
 
-		if len(info.UnusedVars) > 0 || len(info.UnreachableCode) > 0 || len(info.DeadBranches) > 0 {
-			deadCode = append(deadCode, info)
+// unreachableExports runs RTA over the workspace program from every main,
+// init and test function and reports the exported functions and methods
+// declared outside tests in pkgs that it never reaches. Nothing is reported
+// when the workspace has no entry points.
+func unreachableExports(prog *ssa.Program, allPkgs, pkgs []*packages.Package, root string) []UnusedItem {
+	if prog == nil {
+		return nil
+	}
+
+	dirs := make(map[*types.Package]string)
+	for tp, pkg := range packageIndex(allPkgs) {
+		dirs[tp] = pkg.Dir
+	}
+
+	var roots []*ssa.Function
+	for _, ssaPkg := range prog.AllPackages() {
+		if !isWithin(root, dirs[ssaPkg.Pkg]) {
+			continue
+		}
+		for name, member := range ssaPkg.Members {
+			fn, ok := member.(*ssa.Function)
+			if !ok {
+				continue
+			}
+			switch {
+			case name == "init", name == "main" && ssaPkg.Pkg.Name() == "main":
+				roots = append(roots, fn)
+			case isTestEntry(prog.Fset, fn):
+				roots = append(roots, fn)
+			}
 		}
+	}
+	if len(roots) == 0 {
 		return nil
+	}
+
+	result := rta.Analyze(roots, false)
+	reachable := make(map[string]bool)
+	for fn := range result.Reachable {
+		if fn.Origin() != nil {
+			fn = fn.Origin()
+		}
+		if obj := fn.Object(); obj != nil {
+			reachable[objectKey(prog.Fset, obj)] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	var unreachable []UnusedItem
+	for _, pkg := range pkgs {
+		// Packages with type errors have no SSA form to analyze
+		if len(pkg.Errors) > 0 || strings.HasSuffix(pkg.PkgPath, "_test") {
+			continue
+		}
+		for _, file := range pkg.Syntax {
+			if strings.HasSuffix(pkg.Fset.File(file.Pos()).Name(), "_test.go") {
+				continue
+			}
+			for _, decl := range file.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok || !fn.Name.IsExported() || fn.Body == nil {
+					continue
+				}
+				obj := pkg.TypesInfo.Defs[fn.Name]
+				key := objectKey(pkg.Fset, obj)
+				if obj == nil || reachable[key] || seen[key] {
+					continue
+				}
+				seen[key] = true
+
+				kind := "function"
+				if fn.Recv != nil {
+					kind = "method"
+				}
+				unreachable = append(unreachable, UnusedItem{
+					Name:     funcDeclName(fn),
+					Type:     kind,
+					Position: newPosition(pkg.Fset.Position(fn.Name.Pos())),
+				})
+			}
+		}
+	}
+
+	return unreachable
+}
+
+// constantBranch reports an if statement whose condition the type checker
+// evaluates to a constant, naming the branch that can never run. Conditions
+// using named constants, such as runtime.GOOS, a const set per build tag or
+// a debug switch, are marked build-dependent: constant in this build but
+// possibly meant to vary.
+func constantBranch(pkg *packages.Package, stmt *ast.IfStmt) (CodeLocation, bool) {
+	tv, ok := pkg.TypesInfo.Types[stmt.Cond]
+	if !ok || tv.Value == nil {
+		return CodeLocation{}, false
+	}
+
+	cond := exprSource(pkg.Fset, stmt.Cond)
+	pos := pkg.Fset.Position(stmt.Cond.Pos())
+	buildDependent := usesNamedConstant(pkg.TypesInfo, stmt.Cond)
+
+	if tv.Value.String() == "false" {
+		return CodeLocation{
+			Description:    fmt.Sprintf("Condition %s is always false; the if body never runs", cond),
+			Position:       newPosition(pos),
+			BuildDependent: buildDependent,
+		}, true
+	}
+	if stmt.Else != nil {
+		return CodeLocation{
+			Description:    fmt.Sprintf("Condition %s is always true; the else branch never runs", cond),
+			Position:       newPosition(pkg.Fset.Position(stmt.Else.Pos())),
+			BuildDependent: buildDependent,
+		}, true
+	}
+	return CodeLocation{}, false
+}
+
+// usesNamedConstant reports whether expr refers to a constant other than
+// the predeclared true and false
+func usesNamedConstant(info *types.Info, expr ast.Expr) bool {
+	named := false
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok {
+			if obj, ok := info.Uses[ident].(*types.Const); ok && obj.Parent() != types.Universe {
+				named = true
+			}
+		}
+		return !named
 	})
+	return named
+}
+
+func exprSource(fset *token.FileSet, expr ast.Expr) string {
+	var b strings.Builder
+	if err := format.Node(&b, fset, expr); err != nil {
+		return exprToString(expr)
+	}
+	return b.String()
+}
 
-	return deadCode, err
-}
\ No newline at end of file
+// isLinked reports functions referenced from outside Go source through
+// //go:linkname or cgo's //export
+func isLinked(fn *ast.FuncDecl) bool {
+	if fn.Doc == nil {
+		return false
+	}
+	for _, c := range fn.Doc.List {
+		if strings.HasPrefix(c.Text, "//go:linkname") || strings.HasPrefix(c.Text, "//export ") {
+			return true
+		}
+	}
+	return false
+}
+
+func isEntryFunc(pkg *packages.Package, fn *ast.FuncDecl) bool {
+	if fn.Recv != nil {
+		return false
+	}
+	return fn.Name.Name == "init" || fn.Name.Name == "main" && pkg.Name == "main"
+}
+
+// isTestEntry reports the functions go test calls directly
+func isTestEntry(fset *token.FileSet, fn *ssa.Function) bool {
+	if fn.Signature.Recv() != nil || !strings.HasSuffix(fset.Position(fn.Pos()).Filename, "_test.go") {
+		return false
+	}
+	for _, prefix := range []string{"Test", "Benchmark", "Fuzz", "Example"} {
+		if strings.HasPrefix(fn.Name(), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// structType returns the struct a composite literal of type t builds
+func structType(t types.Type) (*types.Struct, bool) {
+	if t == nil {
+		return nil, false
+	}
+	if ptr, ok := t.Underlying().(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	st, ok := t.Underlying().(*types.Struct)
+	return st, ok
+}
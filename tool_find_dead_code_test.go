@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestFindDeadCode(t *testing.T) {
+	root := writeModule(t, map[string]string{
+		"main.go": `package main
+
+import "runtime"
+
+const debug = false
+
+const verbose = debug || false
+
+func main() {
+	if false {
+		println("never")
+	}
+	if debug {
+		println("debug")
+	}
+	if runtime.GOOS == "plan9" {
+		println("plan9")
+	} else {
+		println("elsewhere")
+	}
+	if !(true && false) {
+		println("always")
+	} else {
+		println("never")
+	}
+	if verbose {
+		println("verbose")
+	}
+	if true {
+		println("no else to report")
+	}
+	x := len(runtime.GOOS)
+	if x > 0 {
+		println("not constant")
+	}
+	Used()
+}
+
+func Used() {
+	return
+	println("after return")
+}
+
+func unused() {}
+
+func Unreachable() {}
+`,
+	})
+
+	results, err := findDeadCode(context.Background(), root)
+	if err != nil {
+		t.Fatalf("findDeadCode() error = %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("findDeadCode() = %+v, want one file", results)
+	}
+	info := results[0]
+
+	type branch struct {
+		Line           int
+		BuildDependent bool
+	}
+	var branches []branch
+	for _, loc := range info.DeadBranches {
+		branches = append(branches, branch{loc.Position.Line, loc.BuildDependent})
+	}
+	want := []branch{
+		{10, false}, // if false
+		{13, true},  // if debug, with const debug = false
+		{16, true},  // runtime.GOOS == "plan9" on other systems
+		{23, false}, // else of !(true && false)
+		{26, true},  // verbose, a constant built from debug
+	}
+	if !reflect.DeepEqual(branches, want) {
+		t.Errorf("dead branches = %+v, want %+v", branches, want)
+	}
+
+	if len(info.UnreachableCode) != 1 || info.UnreachableCode[0].Position.Line != 41 {
+		t.Errorf("unreachable code = %+v, want the statement after return on line 41", info.UnreachableCode)
+	}
+
+	var unused []string
+	for _, item := range info.Unused {
+		unused = append(unused, item.Name)
+	}
+	if !reflect.DeepEqual(unused, []string{"unused"}) {
+		t.Errorf("unused = %v, want [unused]", unused)
+	}
+
+	var unreachable []string
+	for _, item := range info.Unreachable {
+		unreachable = append(unreachable, item.Name)
+	}
+	if !reflect.DeepEqual(unreachable, []string{"Unreachable"}) {
+		t.Errorf("unreachable exports = %v, want [Unreachable]", unreachable)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
 	"strings"
@@ -19,10 +20,10 @@ type DeprecatedUsage struct {
 	Position    Position `json:"position"`
 }
 
-func findDeprecated(dir string) ([]DeprecatedInfo, error) {
+func findDeprecated(ctx context.Context, dir string) ([]DeprecatedInfo, error) {
 	var deprecated []DeprecatedInfo
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		info := DeprecatedInfo{
 			File: path,
 		}
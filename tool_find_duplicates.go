@@ -1,46 +1,125 @@
 package main
 
 import (
-	"crypto/md5"
+	"context"
 	"fmt"
 	"go/ast"
 	"go/token"
+	"hash/fnv"
+	"sort"
+	"strings"
 )
 
 // Code duplication types
 type DuplicateInfo struct {
-	Similarity float64           `json:"similarity"`
+	Kind       string              `json:"kind"` // function or sequence
+	Similarity float64             `json:"similarity"`
+	Statements int                 `json:"statements,omitempty"`
 	Locations  []DuplicateLocation `json:"locations"`
-	Content    string            `json:"content"`
+	Content    string              `json:"content"`
 }
 
 type DuplicateLocation struct {
 	File     string   `json:"file"`
 	Function string   `json:"function"`
 	Position Position `json:"position"`
+	EndLine  int      `json:"end_line"`
 }
 
-func findDuplicates(dir string, threshold float64) ([]DuplicateInfo, error) {
-	var duplicates []DuplicateInfo
-	functionBodies := make(map[string][]DuplicateLocation)
-
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
-		ast.Inspect(file, func(n ast.Node) bool {
-			if fn, ok := n.(*ast.FuncDecl); ok && fn.Body != nil {
-				body := extractFunctionBody(fn.Body, fset)
-				hash := fmt.Sprintf("%x", md5.Sum([]byte(body)))
-				
-				pos := fset.Position(fn.Pos())
-				location := DuplicateLocation{
-					File:     path,
-					Function: fn.Name.Name,
-					Position: newPosition(pos),
-				}
-				
-				functionBodies[hash] = append(functionBodies[hash], location)
+// Clones smaller than this many normalized tokens are too trivial to report,
+// such as a lone `if err != nil { return err }`
+const (
+	minCloneTokens         = 60
+	maxCloneBucket         = 64
+	defaultCloneStatements = 3
+)
+
+// cloneStmt is a statement reduced to the hash of its normalized tokens
+type cloneStmt struct {
+	node   ast.Stmt
+	hash   uint64
+	tokens int
+}
+
+// cloneBlock is a statement list inside a function, the unit within which
+// duplicated sequences are searched
+type cloneBlock struct {
+	fn    *cloneFunc
+	stmts []cloneStmt
+	body  bool // the function body itself
+}
+
+type cloneFunc struct {
+	name   string
+	file   string
+	src    []byte
+	fset   *token.FileSet
+	decl   *ast.FuncDecl
+	tokens []string
+	grams  map[uint64]int
+	size   int
+}
+
+// findDuplicates reports whole functions whose normalized token streams are
+// at least threshold similar, and runs of at least minStatements statements
+// that are identical once identifiers and literals are abstracted away
+func findDuplicates(ctx context.Context, dir string, threshold float64, minStatements int) ([]DuplicateInfo, error) {
+	if threshold <= 0 || threshold > 1 {
+		return nil, fmt.Errorf("threshold must be in (0, 1]")
+	}
+	if minStatements < 1 {
+		minStatements = defaultCloneStatements
+	}
+
+	var funcs []*cloneFunc
+	var blocks []*cloneBlock
+
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
 			}
-			return true
-		})
+
+			cf := &cloneFunc{
+				name:   funcDeclName(fn),
+				file:   path,
+				src:    src,
+				fset:   fset,
+				decl:   fn,
+				tokens: normalizeNode(fn.Body),
+			}
+			cf.grams, cf.size = tokenTrigrams(cf.tokens)
+			funcs = append(funcs, cf)
+
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				var list []ast.Stmt
+				switch node := n.(type) {
+				case *ast.BlockStmt:
+					list = node.List
+				case *ast.CaseClause:
+					list = node.Body
+				case *ast.CommClause:
+					list = node.Body
+				default:
+					return true
+				}
+
+				block := &cloneBlock{fn: cf, body: n == fn.Body}
+				for _, stmt := range list {
+					tokens := normalizeNode(stmt)
+					block.stmts = append(block.stmts, cloneStmt{
+						node:   stmt,
+						hash:   hashTokens(tokens),
+						tokens: len(tokens),
+					})
+				}
+				if len(block.stmts) >= minStatements {
+					blocks = append(blocks, block)
+				}
+				return true
+			})
+		}
 		return nil
 	})
 
@@ -48,22 +127,380 @@ func findDuplicates(dir string, threshold float64) ([]DuplicateInfo, error) {
 		return nil, err
 	}
 
-	// Find duplicates
-	for hash, locations := range functionBodies {
-		if len(locations) > 1 {
-			duplicates = append(duplicates, DuplicateInfo{
-				Similarity: 1.0,
-				Locations:  locations,
-				Content:    hash,
-			})
+	duplicates := []DuplicateInfo{}
+	functionClusters, clustered := similarFunctions(funcs, threshold)
+	duplicates = append(duplicates, functionClusters...)
+	duplicates = append(duplicates, duplicateSequences(blocks, minStatements, clustered)...)
+
+	sort.SliceStable(duplicates, func(i, j int) bool {
+		if duplicates[i].Similarity != duplicates[j].Similarity {
+			return duplicates[i].Similarity > duplicates[j].Similarity
 		}
-	}
+		return duplicatedLines(duplicates[i]) > duplicatedLines(duplicates[j])
+	})
 
 	return duplicates, nil
 }
 
-func extractFunctionBody(body *ast.BlockStmt, fset *token.FileSet) string {
-	start := fset.Position(body.Pos())
-	end := fset.Position(body.End())
-	return fmt.Sprintf("%d-%d", start.Line, end.Line)
-}
\ No newline at end of file
+// similarFunctions clusters functions whose trigram Dice similarity meets
+// threshold, returning the clusters and the set of clustered functions
+func similarFunctions(funcs []*cloneFunc, threshold float64) ([]DuplicateInfo, map[*cloneFunc]bool) {
+	var candidates []*cloneFunc
+	for _, fn := range funcs {
+		if len(fn.tokens) >= minCloneTokens {
+			candidates = append(candidates, fn)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].size < candidates[j].size
+	})
+
+	parent := make([]int, len(candidates))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+
+	minSimilarity := make(map[int]float64)
+	for i, a := range candidates {
+		for j := i + 1; j < len(candidates); j++ {
+			b := candidates[j]
+			// Dice can be at most 2*min/(min+max); sizes only grow from here
+			if 2*float64(a.size)/float64(a.size+b.size) < threshold {
+				break
+			}
+			similarity := diceSimilarity(a.grams, b.grams, a.size, b.size)
+			if similarity < threshold {
+				continue
+			}
+
+			ri, rj := find(i), find(j)
+			merged := similarity
+			for _, r := range []int{ri, rj} {
+				if s, ok := minSimilarity[r]; ok {
+					merged = min(merged, s)
+				}
+			}
+			parent[rj] = ri
+			delete(minSimilarity, rj)
+			minSimilarity[ri] = merged
+		}
+	}
+
+	members := make(map[int][]*cloneFunc)
+	for i, fn := range candidates {
+		members[find(i)] = append(members[find(i)], fn)
+	}
+
+	var clusters []DuplicateInfo
+	clustered := make(map[*cloneFunc]bool)
+	for root, fns := range members {
+		if len(fns) < 2 {
+			continue
+		}
+		sort.Slice(fns, func(i, j int) bool {
+			if fns[i].file != fns[j].file {
+				return fns[i].file < fns[j].file
+			}
+			return fns[i].decl.Pos() < fns[j].decl.Pos()
+		})
+
+		info := DuplicateInfo{
+			Kind:       "function",
+			Similarity: roundRatio(minSimilarity[root]),
+			Content:    nodeSource(fns[0], fns[0].decl.Pos(), fns[0].decl.End()),
+		}
+		for _, fn := range fns {
+			clustered[fn] = true
+			info.Locations = append(info.Locations, cloneLocation(fn, fn.decl.Pos(), fn.decl.End()))
+		}
+		clusters = append(clusters, info)
+	}
+
+	return clusters, clustered
+}
+
+// duplicateSequences finds maximal runs of identical normalized statements
+// occurring in more than one place, skipping runs that are entire bodies of
+// functions already reported as similar
+func duplicateSequences(blocks []*cloneBlock, minStatements int, clustered map[*cloneFunc]bool) []DuplicateInfo {
+	type occurrence struct {
+		block *cloneBlock
+		start int
+	}
+
+	windows := make(map[uint64][]occurrence)
+	for _, block := range blocks {
+		for i := 0; i+minStatements <= len(block.stmts); i++ {
+			h := fnv.New64a()
+			for _, stmt := range block.stmts[i : i+minStatements] {
+				fmt.Fprintf(h, "%x;", stmt.hash)
+			}
+			windows[h.Sum64()] = append(windows[h.Sum64()], occurrence{block, i})
+		}
+	}
+
+	type cluster struct {
+		statements int
+		tokens     int
+		seen       map[string]bool
+		locations  []occurrence
+	}
+	clusters := make(map[uint64]*cluster)
+
+	matches := func(a, b occurrence, offset int) bool {
+		i, j := a.start+offset, b.start+offset
+		if i < 0 || j < 0 || i >= len(a.block.stmts) || j >= len(b.block.stmts) {
+			return false
+		}
+		return a.block.stmts[i].hash == b.block.stmts[j].hash
+	}
+
+	for _, occs := range windows {
+		if len(occs) < 2 || len(occs) > maxCloneBucket {
+			continue
+		}
+		for x := 0; x < len(occs); x++ {
+			for y := x + 1; y < len(occs); y++ {
+				a, b := occs[x], occs[y]
+				// Only start at the beginning of a maximal run
+				if matches(a, b, -1) {
+					continue
+				}
+
+				length := 0
+				for matches(a, b, length) {
+					// Runs within one block must not overlap themselves
+					if a.block == b.block && a.start+length >= b.start {
+						break
+					}
+					length++
+				}
+				if length < minStatements {
+					continue
+				}
+
+				tokens := 0
+				h := fnv.New64a()
+				for _, stmt := range a.block.stmts[a.start : a.start+length] {
+					tokens += stmt.tokens
+					fmt.Fprintf(h, "%x;", stmt.hash)
+				}
+				if tokens < minCloneTokens {
+					continue
+				}
+
+				c := clusters[h.Sum64()]
+				if c == nil {
+					c = &cluster{statements: length, tokens: tokens, seen: make(map[string]bool)}
+					clusters[h.Sum64()] = c
+				}
+				for _, occ := range []occurrence{a, b} {
+					key := fmt.Sprintf("%s:%d", occ.block.fn.file, occ.block.stmts[occ.start].node.Pos())
+					if !c.seen[key] {
+						c.seen[key] = true
+						c.locations = append(c.locations, occ)
+					}
+				}
+			}
+		}
+	}
+
+	// Repetitive code yields overlapping runs of every period; report the
+	// longest and drop runs that only restate locations already covered
+	ordered := make([]*cluster, 0, len(clusters))
+	for _, c := range clusters {
+		ordered = append(ordered, c)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].tokens != ordered[j].tokens {
+			return ordered[i].tokens > ordered[j].tokens
+		}
+		return len(ordered[i].locations) > len(ordered[j].locations)
+	})
+
+	type span struct {
+		file       string
+		start, end token.Pos
+	}
+	var covered []span
+	within := func(s span) bool {
+		for _, c := range covered {
+			if c.file == s.file && c.start <= s.start && s.end <= c.end {
+				return true
+			}
+		}
+		return false
+	}
+
+	var result []DuplicateInfo
+	for _, c := range ordered {
+		spans := make([]span, len(c.locations))
+		redundant := true
+		for i, occ := range c.locations {
+			spans[i] = span{
+				file:  occ.block.fn.file,
+				start: occ.block.stmts[occ.start].node.Pos(),
+				end:   occ.block.stmts[occ.start+c.statements-1].node.End(),
+			}
+			if !within(spans[i]) {
+				redundant = false
+			}
+		}
+		if redundant {
+			continue
+		}
+		covered = append(covered, spans...)
+
+		wholeBodies := true
+		for _, occ := range c.locations {
+			if !occ.block.body || occ.start != 0 || c.statements != len(occ.block.stmts) || !clustered[occ.block.fn] {
+				wholeBodies = false
+				break
+			}
+		}
+		if wholeBodies {
+			continue
+		}
+
+		sort.Slice(c.locations, func(i, j int) bool {
+			a, b := c.locations[i], c.locations[j]
+			if a.block.fn.file != b.block.fn.file {
+				return a.block.fn.file < b.block.fn.file
+			}
+			return a.block.stmts[a.start].node.Pos() < b.block.stmts[b.start].node.Pos()
+		})
+
+		info := DuplicateInfo{
+			Kind:       "sequence",
+			Similarity: 1.0,
+			Statements: c.statements,
+		}
+		for i, occ := range c.locations {
+			start := occ.block.stmts[occ.start].node.Pos()
+			end := occ.block.stmts[occ.start+c.statements-1].node.End()
+			if i == 0 {
+				info.Content = nodeSource(occ.block.fn, start, end)
+			}
+			info.Locations = append(info.Locations, cloneLocation(occ.block.fn, start, end))
+		}
+		result = append(result, info)
+	}
+
+	return result
+}
+
+// normalizeNode flattens n into node kinds and operators, abstracting
+// identifiers and literal values so renamed copies compare equal
+func normalizeNode(n ast.Node) []string {
+	var tokens []string
+	ast.Inspect(n, func(node ast.Node) bool {
+		switch x := node.(type) {
+		case nil:
+			tokens = append(tokens, ")")
+			return false
+		case *ast.CommentGroup, *ast.Comment:
+			return false
+		case *ast.Ident:
+			switch x.Name {
+			case "nil", "true", "false", "_":
+				tokens = append(tokens, x.Name)
+			default:
+				tokens = append(tokens, "id")
+			}
+		case *ast.BasicLit:
+			tokens = append(tokens, "lit:"+x.Kind.String())
+		case *ast.BinaryExpr:
+			tokens = append(tokens, "bin:"+x.Op.String())
+		case *ast.UnaryExpr:
+			tokens = append(tokens, "un:"+x.Op.String())
+		case *ast.AssignStmt:
+			tokens = append(tokens, "assign:"+x.Tok.String())
+		case *ast.IncDecStmt:
+			tokens = append(tokens, "incdec:"+x.Tok.String())
+		case *ast.BranchStmt:
+			tokens = append(tokens, "branch:"+x.Tok.String())
+		default:
+			tokens = append(tokens, strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast."))
+		}
+		return true
+	})
+	return tokens
+}
+
+func hashTokens(tokens []string) uint64 {
+	h := fnv.New64a()
+	for _, t := range tokens {
+		h.Write([]byte(t))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// tokenTrigrams returns the multiset of token trigrams and its size
+func tokenTrigrams(tokens []string) (map[uint64]int, int) {
+	grams := make(map[uint64]int)
+	size := 0
+	for i := 0; i+3 <= len(tokens); i++ {
+		grams[hashTokens(tokens[i:i+3])]++
+		size++
+	}
+	return grams, size
+}
+
+// diceSimilarity is the Sørensen–Dice coefficient of two multisets
+func diceSimilarity(a, b map[uint64]int, sizeA, sizeB int) float64 {
+	if sizeA+sizeB == 0 {
+		return 0
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	shared := 0
+	for gram, n := range a {
+		shared += min(n, b[gram])
+	}
+	return 2 * float64(shared) / float64(sizeA+sizeB)
+}
+
+func roundRatio(s float64) float64 {
+	return float64(int(s*1000+0.5)) / 1000
+}
+
+func cloneLocation(fn *cloneFunc, start, end token.Pos) DuplicateLocation {
+	return DuplicateLocation{
+		File:     fn.file,
+		Function: fn.name,
+		Position: newPosition(fn.fset.Position(start)),
+		EndLine:  fn.fset.Position(end).Line,
+	}
+}
+
+// nodeSource returns the source text between start and end, starting at
+// the beginning of the first line so indentation is preserved
+func nodeSource(fn *cloneFunc, start, end token.Pos) string {
+	from := fn.fset.Position(start).Offset
+	to := fn.fset.Position(end).Offset
+	if from < 0 || to > len(fn.src) || from > to {
+		return ""
+	}
+	for from > 0 && fn.src[from-1] != '\n' {
+		from--
+	}
+	return string(fn.src[from:to])
+}
+
+func duplicatedLines(d DuplicateInfo) int {
+	total := 0
+	for _, loc := range d.Locations {
+		total += loc.EndLine - loc.Position.Line + 1
+	}
+	return total
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
 	"strings"
@@ -24,13 +25,13 @@ type EmptyBlockIssue struct {
 	Position    Position `json:"position"`
 }
 
-func findEmptyBlocks(dir string) (*EmptyBlockAnalysis, error) {
+func findEmptyBlocks(ctx context.Context, dir string) (*EmptyBlockAnalysis, error) {
 	analysis := &EmptyBlockAnalysis{
 		EmptyBlocks: []EmptyBlock{},
 		Issues:      []EmptyBlockIssue{},
 	}
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		ast.Inspect(file, func(n ast.Node) bool {
 			switch node := n.(type) {
 			case *ast.IfStmt:
@@ -1,75 +1,139 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
+	"go/types"
+	"regexp"
 	"strings"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/types/typeutil"
 )
 
 // Error handling types
 type ErrorInfo struct {
-	File           string         `json:"file"`
+	File            string         `json:"file"`
 	UnhandledErrors []ErrorContext `json:"unhandled_errors,omitempty"`
-	ErrorChecks    []ErrorContext `json:"error_checks,omitempty"`
-	ErrorReturns   []ErrorContext `json:"error_returns,omitempty"`
+	ErrorChecks     []ErrorContext `json:"error_checks,omitempty"`
+	ErrorReturns    []ErrorContext `json:"error_returns,omitempty"`
 }
 
 type ErrorContext struct {
 	Context  string   `json:"context"`
 	Type     string   `json:"type"`
+	Call     string   `json:"call,omitempty"`
 	Position Position `json:"position"`
 }
 
-func findErrors(dir string) ([]ErrorInfo, error) {
+// defaultErrorIgnores are calls whose error is conventionally dropped:
+// printing to stdout and writers documented never to fail
+var defaultErrorIgnores = []string{
+	"fmt.Print*",
+	"fmt.Fprint*(*bytes.Buffer)",
+	"fmt.Fprint*(*strings.Builder)",
+	"(*bytes.Buffer).Write*",
+	"(*strings.Builder).Write*",
+}
+
+var errorInterface = types.Universe.Lookup("error").Type().Underlying().(*types.Interface)
+
+// errorIgnore is one allowlist entry: a callee name pattern, optionally
+// restricted to calls whose first argument has a given type
+type errorIgnore struct {
+	callee *regexp.Regexp
+	arg    string
+}
+
+// findErrors reports calls whose error result is discarded, using the
+// callee's signature rather than its name, along with error checks and
+// returns. Calls matching the allowlist (defaults, the errors section of
+// .gocp.yaml and ignore) are not reported.
+func findErrors(ctx context.Context, dir string, ignore []string) ([]ErrorInfo, error) {
+	config, _, err := loadConfig(dir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := append([]string{}, config.Errors.Ignore...)
+	patterns = append(patterns, ignore...)
+	if config.Errors.DefaultIgnores == nil || *config.Errors.DefaultIgnores {
+		patterns = append(patterns, defaultErrorIgnores...)
+	}
+	ignores := parseErrorIgnores(patterns)
+
 	var errors []ErrorInfo
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err = walkTypedFiles(ctx, dir, func(path string, src []byte, file *ast.File, pkg *packages.Package) error {
 		info := ErrorInfo{
 			File: path,
 		}
 
+		report := func(list *[]ErrorContext, kind string, node ast.Node, call *ast.CallExpr) {
+			pos := pkg.Fset.Position(node.Pos())
+			errCtx := ErrorContext{
+				Context:  extractContext(src, pos),
+				Type:     kind,
+				Position: newPosition(pos),
+			}
+			if call != nil {
+				errCtx.Call = calleeName(pkg.TypesInfo, call)
+			}
+			*list = append(*list, errCtx)
+		}
+
+		unchecked := func(kind string, node ast.Node, call *ast.CallExpr) {
+			if errorResult(pkg.TypesInfo, call) < 0 || ignoredCall(pkg.TypesInfo, call, ignores) {
+				return
+			}
+			report(&info.UnhandledErrors, kind, node, call)
+		}
+
 		ast.Inspect(file, func(n ast.Node) bool {
 			switch x := n.(type) {
-			// Find function calls that return errors but aren't checked
+			// Find calls whose error result is discarded
 			case *ast.ExprStmt:
-				if call, ok := x.X.(*ast.CallExpr); ok {
-					// Check if this function likely returns an error
-					if callReturnsError(call) {
-						pos := fset.Position(call.Pos())
-						context := extractContext(src, pos)
-						info.UnhandledErrors = append(info.UnhandledErrors, ErrorContext{
-							Context:  context,
-							Type:     "unchecked_call",
-							Position: newPosition(pos),
-						})
+				if call, ok := ast.Unparen(x.X).(*ast.CallExpr); ok {
+					unchecked("unchecked_call", x, call)
+				}
+
+			case *ast.DeferStmt:
+				unchecked("deferred_call", x, x.Call)
+
+			case *ast.GoStmt:
+				unchecked("goroutine_call", x, x.Call)
+
+			case *ast.AssignStmt:
+				if len(x.Rhs) == 1 && len(x.Lhs) > 1 {
+					// x, _ := f(): the error is the last result
+					call, ok := ast.Unparen(x.Rhs[0]).(*ast.CallExpr)
+					if ok && isBlank(x.Lhs[len(x.Lhs)-1]) && errorResult(pkg.TypesInfo, call) == len(x.Lhs)-1 && !ignoredCall(pkg.TypesInfo, call, ignores) {
+						report(&info.UnhandledErrors, "blank_assignment", x, call)
+					}
+					break
+				}
+				for i, rhs := range x.Rhs {
+					call, ok := ast.Unparen(rhs).(*ast.CallExpr)
+					if ok && i < len(x.Lhs) && isBlank(x.Lhs[i]) && errorResult(pkg.TypesInfo, call) == 0 && !ignoredCall(pkg.TypesInfo, call, ignores) {
+						report(&info.UnhandledErrors, "blank_assignment", x, call)
 					}
 				}
 
 			// Find error checks
 			case *ast.IfStmt:
-				if isErrorCheck(x) {
-					pos := fset.Position(x.Pos())
-					context := extractContext(src, pos)
-					info.ErrorChecks = append(info.ErrorChecks, ErrorContext{
-						Context:  context,
-						Type:     "error_check",
-						Position: newPosition(pos),
-					})
+				if isTypedErrorCheck(pkg.TypesInfo, x.Cond) {
+					report(&info.ErrorChecks, "error_check", x, nil)
 				}
 
-			// Find error returns
+			// Find returns of a possibly non-nil error
 			case *ast.ReturnStmt:
-				for _, result := range x.Results {
-					if ident, ok := result.(*ast.Ident); ok && (ident.Name == "err" || strings.Contains(ident.Name, "error")) {
-						pos := fset.Position(x.Pos())
-						context := extractContext(src, pos)
-						info.ErrorReturns = append(info.ErrorReturns, ErrorContext{
-							Context:  context,
-							Type:     "error_return",
-							Position: newPosition(pos),
-						})
-						break
-					}
+				if len(x.Results) == 0 {
+					break
+				}
+				last := x.Results[len(x.Results)-1]
+				if tv, ok := pkg.TypesInfo.Types[last]; ok && !tv.IsNil() && isErrorType(tv.Type) {
+					report(&info.ErrorReturns, "error_return", x, nil)
 				}
 			}
 			return true
@@ -84,19 +148,107 @@ func findErrors(dir string) ([]ErrorInfo, error) {
 	return errors, err
 }
 
-func callReturnsError(call *ast.CallExpr) bool {
-	// Simple heuristic: check if the function name suggests it returns an error
-	switch fun := call.Fun.(type) {
-	case *ast.Ident:
-		name := fun.Name
-		return strings.HasPrefix(name, "New") || strings.HasPrefix(name, "Create") ||
-			strings.HasPrefix(name, "Open") || strings.HasPrefix(name, "Read") ||
-			strings.HasPrefix(name, "Write") || strings.HasPrefix(name, "Parse")
-	case *ast.SelectorExpr:
-		name := fun.Sel.Name
-		return strings.HasPrefix(name, "New") || strings.HasPrefix(name, "Create") ||
-			strings.HasPrefix(name, "Open") || strings.HasPrefix(name, "Read") ||
-			strings.HasPrefix(name, "Write") || strings.HasPrefix(name, "Parse")
+// errorResult returns the index of the call's result implementing error
+// when it is the last one, or -1
+func errorResult(info *types.Info, call *ast.CallExpr) int {
+	tv, ok := info.Types[call.Fun]
+	if !ok || tv.IsType() || tv.IsBuiltin() {
+		return -1
+	}
+
+	switch t := info.TypeOf(call).(type) {
+	case *types.Tuple:
+		if t.Len() > 0 && isErrorType(t.At(t.Len()-1).Type()) {
+			return t.Len() - 1
+		}
+	case nil:
+	default:
+		if isErrorType(t) {
+			return 0
+		}
+	}
+	return -1
+}
+
+// isErrorType reports error and interfaces embedding it; concrete types
+// implementing error are values, not error results
+func isErrorType(t types.Type) bool {
+	return t != nil && types.IsInterface(t) && types.Implements(t, errorInterface)
+}
+
+// isTypedErrorCheck matches comparisons of an error against nil
+func isTypedErrorCheck(info *types.Info, cond ast.Expr) bool {
+	bin, ok := ast.Unparen(cond).(*ast.BinaryExpr)
+	if !ok {
+		return false
+	}
+	switch bin.Op {
+	case token.NEQ, token.EQL:
+		for _, pair := range [][2]ast.Expr{{bin.X, bin.Y}, {bin.Y, bin.X}} {
+			if tv, ok := info.Types[pair[1]]; ok && tv.IsNil() && isErrorType(info.TypeOf(pair[0])) {
+				return true
+			}
+		}
+	case token.LAND, token.LOR:
+		return isTypedErrorCheck(info, bin.X) || isTypedErrorCheck(info, bin.Y)
+	}
+	return false
+}
+
+func isBlank(expr ast.Expr) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == "_"
+}
+
+// calleeName renders the called function as in the allowlist: pkg.Func or
+// (recv).Method, falling back to the call expression for function values
+func calleeName(info *types.Info, call *ast.CallExpr) string {
+	if fn, ok := typeutil.Callee(info, call).(*types.Func); ok {
+		return qualifiedName(fn.Origin())
+	}
+	return exprToString(call.Fun)
+}
+
+// parseErrorIgnores compiles allowlist entries of the form name or
+// name(argtype), where * in name matches any sequence of characters
+func parseErrorIgnores(patterns []string) []errorIgnore {
+	var ignores []errorIgnore
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+
+		var arg string
+		// A trailing (type) restricts the first argument; a leading one is
+		// a method receiver
+		if strings.HasSuffix(pattern, ")") && !strings.HasPrefix(pattern, "(") || strings.Count(pattern, "(") > 1 {
+			if open := strings.LastIndex(pattern, "("); open > 0 {
+				pattern, arg = pattern[:open], pattern[open+1:len(pattern)-1]
+			}
+		}
+
+		expr := strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, `.*`)
+		ignores = append(ignores, errorIgnore{
+			callee: regexp.MustCompile("^" + expr + "$"),
+			arg:    arg,
+		})
+	}
+	return ignores
+}
+
+func ignoredCall(info *types.Info, call *ast.CallExpr, ignores []errorIgnore) bool {
+	name := calleeName(info, call)
+	for _, ignore := range ignores {
+		if !ignore.callee.MatchString(name) {
+			continue
+		}
+		if ignore.arg == "" {
+			return true
+		}
+		if len(call.Args) > 0 && types.TypeString(info.TypeOf(call.Args[0]), nil) == ignore.arg {
+			return true
+		}
 	}
 	return false
-}
\ No newline at end of file
+}
@@ -1,23 +1,27 @@
 package main
 
 import (
+	"context"
 	"go/ast"
-	"go/token"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/types/typeutil"
 )
 
 // Function call types
 type FunctionCall struct {
 	Caller   string   `json:"caller"`
+	Callee   string   `json:"callee"`
 	Context  string   `json:"context"`
 	Position Position `json:"position"`
 }
 
-func findFunctionCalls(dir string, functionName string) ([]FunctionCall, error) {
+func findFunctionCalls(ctx context.Context, dir string, functionName string) ([]FunctionCall, error) {
 	var calls []FunctionCall
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkTypedFiles(ctx, dir, func(path string, src []byte, file *ast.File, pkg *packages.Package) error {
 		currentFunc := ""
-		
+
 		ast.Inspect(file, func(n ast.Node) bool {
 			// Track current function context
 			if fn, ok := n.(*ast.FuncDecl); ok {
@@ -25,24 +29,15 @@ func findFunctionCalls(dir string, functionName string) ([]FunctionCall, error)
 				return true
 			}
 
-			// Find function calls
-			switch x := n.(type) {
-			case *ast.CallExpr:
-				var calledName string
-				switch fun := x.Fun.(type) {
-				case *ast.Ident:
-					calledName = fun.Name
-				case *ast.SelectorExpr:
-					calledName = fun.Sel.Name
-				}
-
-				if calledName == functionName {
-					pos := fset.Position(x.Pos())
-					context := extractContext(src, pos)
-					
+			// Find function calls resolved to their callee object
+			if call, ok := n.(*ast.CallExpr); ok {
+				callee := typeutil.Callee(pkg.TypesInfo, call)
+				if objectMatches(callee, functionName) {
+					pos := pkg.Fset.Position(call.Pos())
 					calls = append(calls, FunctionCall{
 						Caller:   currentFunc,
-						Context:  context,
+						Callee:   qualifiedName(callee),
+						Context:  extractContext(src, pos),
 						Position: newPosition(pos),
 					})
 				}
@@ -54,4 +49,4 @@ func findFunctionCalls(dir string, functionName string) ([]FunctionCall, error)
 	})
 
 	return calls, err
-}
\ No newline at end of file
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
 )
@@ -26,10 +27,10 @@ type Instance struct {
 	Position Position `json:"position"`
 }
 
-func findGenerics(dir string) ([]GenericInfo, error) {
+func findGenerics(ctx context.Context, dir string) ([]GenericInfo, error) {
 	var generics []GenericInfo
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		ast.Inspect(file, func(n ast.Node) bool {
 			switch x := n.(type) {
 			case *ast.GenDecl:
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
 	"path/filepath"
@@ -22,10 +23,10 @@ type ImportDetail struct {
 	Position Position `json:"position"`
 }
 
-func findImports(dir string) ([]ImportInfo, error) {
+func findImports(ctx context.Context, dir string) ([]ImportInfo, error) {
 	var imports []ImportInfo
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		info := ImportInfo{
 			Package: file.Name.Name,
 			File:    path,
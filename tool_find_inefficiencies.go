@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"go/ast"
 	"go/token"
@@ -21,10 +22,10 @@ type InefficiencyItem struct {
 	Position    Position `json:"position"`
 }
 
-func findInefficiencies(dir string) ([]InefficiencyInfo, error) {
+func findInefficiencies(ctx context.Context, dir string) ([]InefficiencyInfo, error) {
 	var inefficiencies []InefficiencyInfo
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		info := InefficiencyInfo{
 			File: path,
 		}
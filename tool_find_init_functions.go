@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
 	"sort"
@@ -28,7 +29,7 @@ type InitIssue struct {
 	Position    Position `json:"position"`
 }
 
-func findInitFunctions(dir string) (*InitAnalysis, error) {
+func findInitFunctions(ctx context.Context, dir string) (*InitAnalysis, error) {
 	analysis := &InitAnalysis{
 		InitFunctions: []InitFunction{},
 		Issues:        []InitIssue{},
@@ -37,7 +38,7 @@ func findInitFunctions(dir string) (*InitAnalysis, error) {
 
 	packageInits := make(map[string][]InitFunction) // package -> init functions
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		pkgName := file.Name.Name
 
 		ast.Inspect(file, func(n ast.Node) bool {
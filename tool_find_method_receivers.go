@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
 )
@@ -24,7 +25,7 @@ type ReceiverIssue struct {
 	Position    Position `json:"position"`
 }
 
-func findMethodReceivers(dir string) (*ReceiverAnalysis, error) {
+func findMethodReceivers(ctx context.Context, dir string) (*ReceiverAnalysis, error) {
 	analysis := &ReceiverAnalysis{
 		Methods: []MethodReceiver{},
 		Issues:  []ReceiverIssue{},
@@ -32,7 +33,7 @@ func findMethodReceivers(dir string) (*ReceiverAnalysis, error) {
 
 	typeReceivers := make(map[string]map[string]bool) // type -> receiver type -> exists
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		ast.Inspect(file, func(n ast.Node) bool {
 			if funcDecl, ok := n.(*ast.FuncDecl); ok && funcDecl.Recv != nil {
 				if len(funcDecl.Recv.List) > 0 {
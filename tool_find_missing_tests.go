@@ -1,36 +1,57 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"go/ast"
 	"go/token"
+	"sort"
 	"strings"
 )
 
 // Missing tests types
 type MissingTestInfo struct {
-	Function    string   `json:"function"`
-	Package     string   `json:"package"`
-	Complexity  int      `json:"complexity"`
-	Criticality string   `json:"criticality"`
-	Reason      string   `json:"reason"`
-	Position    Position `json:"position"`
+	Function    string            `json:"function"`
+	Package     string            `json:"package"`
+	Complexity  int               `json:"complexity"`
+	Cognitive   int               `json:"cognitive_complexity"`
+	Criticality string            `json:"criticality"`
+	Reason      string            `json:"reason"`
+	Coverage    *FunctionCoverage `json:"coverage,omitempty"`
+	Position    Position          `json:"position"`
 }
 
-func findMissingTests(dir string) ([]MissingTestInfo, error) {
+// findMissingTests reports exported functions lacking tests. By default a
+// function counts as tested when a Test<Name> exists; with coverage it must
+// actually be executed, and partially covered functions are reported too.
+func findMissingTests(ctx context.Context, dir string, withCoverage bool) ([]MissingTestInfo, error) {
 	var missingTests []MissingTestInfo
 
-	// Get all exported functions
-	exportedFuncs := make(map[string]*ExportedFunc)
+	var profile *coverageProfile
+	if withCoverage {
+		var err error
+		profile, err = collectCoverage(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Get all exported functions, with the test names that would cover them
+	type candidate struct {
+		info      MissingTestInfo
+		testNames []string
+	}
+	var exportedFuncs []candidate
 	testedFuncs := make(map[string]bool)
 
 	// Collect exported functions
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		if strings.HasSuffix(path, "_test.go") {
 			// Track tested functions
 			for _, decl := range file.Decls {
 				if fn, ok := decl.(*ast.FuncDecl); ok && strings.HasPrefix(fn.Name.Name, "Test") {
 					testedFunc := strings.TrimPrefix(fn.Name.Name, "Test")
-					testedFuncs[file.Name.Name+"."+testedFunc] = true
+					testedFuncs[strings.TrimSuffix(file.Name.Name, "_test")+"."+testedFunc] = true
 				}
 			}
 			return nil
@@ -38,15 +59,30 @@ func findMissingTests(dir string) ([]MissingTestInfo, error) {
 
 		// Collect exported functions
 		for _, decl := range file.Decls {
-			if fn, ok := decl.(*ast.FuncDecl); ok && ast.IsExported(fn.Name.Name) {
-				pos := fset.Position(fn.Pos())
-				key := file.Name.Name + "." + fn.Name.Name
-				exportedFuncs[key] = &ExportedFunc{
-					Name:     fn.Name.Name,
-					Package:  file.Name.Name,
-					Position: newPosition(pos),
-				}
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || !ast.IsExported(fn.Name.Name) || fn.Body == nil {
+				continue
+			}
+
+			metrics := measureFunction(fn, fset)
+			info := MissingTestInfo{
+				Function:    metrics.Function,
+				Package:     file.Name.Name,
+				Complexity:  metrics.Cyclomatic,
+				Cognitive:   metrics.Cognitive,
+				Criticality: determineCriticality(fn.Name.Name),
+				Position:    newPosition(fset.Position(fn.Pos())),
+			}
+			if profile != nil {
+				info.Coverage = profile.function(fset, fn)
 			}
+			exportedFuncs = append(exportedFuncs, candidate{
+				info: info,
+				testNames: []string{
+					file.Name.Name + "." + fn.Name.Name,
+					file.Name.Name + "." + strings.ReplaceAll(info.Function, ".", "_"),
+				},
+			})
 		}
 		return nil
 	})
@@ -56,28 +92,60 @@ func findMissingTests(dir string) ([]MissingTestInfo, error) {
 	}
 
 	// Find missing tests
-	for key, fn := range exportedFuncs {
-		if !testedFuncs[key] {
-			complexity := calculateComplexity(fn.Name)
-			criticality := determineCriticality(fn.Name)
-			
-			missingTests = append(missingTests, MissingTestInfo{
-				Function:    fn.Name,
-				Package:     fn.Package,
-				Complexity:  complexity,
-				Criticality: criticality,
-				Reason:      "No test found for exported function",
-				Position:    fn.Position,
-			})
+	for _, c := range exportedFuncs {
+		fn := c.info
+		hasTest := testedFuncs[c.testNames[0]] || testedFuncs[c.testNames[1]]
+
+		switch {
+		case fn.Coverage != nil && fn.Coverage.Statements > 0:
+			if fn.Coverage.Covered == fn.Coverage.Statements {
+				continue
+			}
+			if fn.Coverage.Covered == 0 {
+				fn.Reason = "Not executed by any test"
+			} else {
+				fn.Reason = fmt.Sprintf("Only %.1f%% of statements executed by tests", fn.Coverage.Percentage)
+			}
+		case profile != nil:
+			// No statements to cover, or no profile for this package
+			if fn.Coverage != nil || hasTest {
+				continue
+			}
+			fn.Reason = "No test found for exported function"
+		default:
+			if hasTest {
+				continue
+			}
+			fn.Reason = "No test found for exported function"
 		}
+		missingTests = append(missingTests, fn)
 	}
 
+	// Most complex and least covered first
+	sort.SliceStable(missingTests, func(i, j int) bool {
+		return testPriority(missingTests[i]) > testPriority(missingTests[j])
+	})
+
 	return missingTests, nil
 }
 
-func calculateComplexity(funcName string) int {
-	// Simplified complexity calculation
-	return len(funcName) % 10 + 1
+// testPriority weighs complexity by the share of the function left untested
+func testPriority(info MissingTestInfo) float64 {
+	untested := 1.0
+	if info.Coverage != nil && info.Coverage.Statements > 0 {
+		untested = 1 - info.Coverage.Percentage/100
+	}
+	return float64(info.Complexity) * untested
+}
+
+// funcDeclName returns Name for functions and Type.Name for methods
+func funcDeclName(fn *ast.FuncDecl) string {
+	if fn.Recv != nil && len(fn.Recv.List) > 0 {
+		if recv := getTypeName(fn.Recv.List[0].Type); recv != "" {
+			return recv + "." + fn.Name.Name
+		}
+	}
+	return fn.Name.Name
 }
 
 func determineCriticality(funcName string) string {
@@ -89,4 +157,4 @@ func determineCriticality(funcName string) string {
 		return "medium"
 	}
 	return "low"
-}
\ No newline at end of file
+}
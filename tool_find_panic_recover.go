@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
 )
@@ -24,13 +25,13 @@ type PanicRecoverIssue struct {
 	Position    Position `json:"position"`
 }
 
-func findPanicRecover(dir string) (*PanicRecoverAnalysis, error) {
+func findPanicRecover(ctx context.Context, dir string) (*PanicRecoverAnalysis, error) {
 	analysis := &PanicRecoverAnalysis{
 		Usages: []PanicRecoverUsage{},
 		Issues: []PanicRecoverIssue{},
 	}
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		// Track function boundaries and defer statements
 		var currentFunc *ast.FuncDecl
 		deferDepth := 0
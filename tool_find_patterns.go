@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"go/ast"
 	"go/token"
@@ -20,10 +21,10 @@ type PatternOccurrence struct {
 	Position    Position `json:"position"`
 }
 
-func findPatterns(dir string) ([]PatternInfo, error) {
+func findPatterns(ctx context.Context, dir string) ([]PatternInfo, error) {
 	var patterns []PatternInfo
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		// Look for singleton pattern
 		singletonPattern := PatternInfo{Pattern: "singleton"}
 		
@@ -1,47 +1,43 @@
 package main
 
 import (
+	"context"
 	"go/ast"
-	"go/token"
+
+	"golang.org/x/tools/go/packages"
 )
 
 type Reference struct {
 	Context  string   `json:"context"`
 	Kind     string   `json:"kind"`
+	Object   string   `json:"object"`
 	Position Position `json:"position"`
 }
 
-func findReferences(dir string, symbol string) ([]Reference, error) {
+func findReferences(ctx context.Context, dir string, symbol string) ([]Reference, error) {
 	var refs []Reference
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkTypedFiles(ctx, dir, func(path string, src []byte, file *ast.File, pkg *packages.Package) error {
+		selectors := make(map[*ast.Ident]bool)
 
 		ast.Inspect(file, func(n ast.Node) bool {
 			switch node := n.(type) {
+			case *ast.SelectorExpr:
+				selectors[node.Sel] = true
+
 			case *ast.Ident:
-				if node.Name == symbol {
-					pos := fset.Position(node.Pos())
-					kind := identifyReferenceKind(node)
-					context := extractContext(src, pos)
-					
-					refs = append(refs, Reference{
-						Context:  context,
-						Kind:     kind,
-						Position: newPosition(pos),
-					})
+				obj := pkg.TypesInfo.ObjectOf(node)
+				if !objectMatches(obj, symbol) {
+					return true
 				}
 
-			case *ast.SelectorExpr:
-				if node.Sel.Name == symbol {
-					pos := fset.Position(node.Sel.Pos())
-					context := extractContext(src, pos)
-					
-					refs = append(refs, Reference{
-						Context:  context,
-						Kind:     "selector",
-						Position: newPosition(pos),
-					})
-				}
+				pos := pkg.Fset.Position(node.Pos())
+				refs = append(refs, Reference{
+					Context:  extractContext(src, pos),
+					Kind:     identifyReferenceKind(node, pkg, selectors),
+					Object:   qualifiedName(obj),
+					Position: newPosition(pos),
+				})
 			}
 			return true
 		})
@@ -52,6 +48,12 @@ func findReferences(dir string, symbol string) ([]Reference, error) {
 	return refs, err
 }
 
-func identifyReferenceKind(ident *ast.Ident) string {
+func identifyReferenceKind(ident *ast.Ident, pkg *packages.Package, selectors map[*ast.Ident]bool) string {
+	if _, ok := pkg.TypesInfo.Defs[ident]; ok {
+		return "declaration"
+	}
+	if selectors[ident] {
+		return "selector"
+	}
 	return "identifier"
-}
\ No newline at end of file
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
 )
@@ -23,13 +24,13 @@ type ReflectionIssue struct {
 	Position    Position `json:"position"`
 }
 
-func findReflectionUsage(dir string) (*ReflectionAnalysis, error) {
+func findReflectionUsage(ctx context.Context, dir string) (*ReflectionAnalysis, error) {
 	analysis := &ReflectionAnalysis{
 		Usages: []ReflectionUsage{},
 		Issues: []ReflectionIssue{},
 	}
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		// Check if reflect package is imported
 		hasReflectImport := false
 		for _, imp := range file.Imports {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
 	"strings"
@@ -31,10 +32,10 @@ type TypeUsage struct {
 	Position Position `json:"position"`
 }
 
-func findStructUsage(dir string, structName string) ([]StructUsage, error) {
+func findStructUsage(ctx context.Context, dir string, structName string) ([]StructUsage, error) {
 	var usages []StructUsage
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		usage := StructUsage{
 			File: path,
 		}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
 	"strings"
@@ -14,10 +15,10 @@ type Symbol struct {
 	Position Position `json:"position"`
 }
 
-func findSymbols(dir string, pattern string) ([]Symbol, error) {
+func findSymbols(ctx context.Context, dir string, pattern string) ([]Symbol, error) {
 	var symbols []Symbol
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		if strings.HasSuffix(path, "_test.go") && !strings.Contains(pattern, "Test") {
 			return nil
 		}
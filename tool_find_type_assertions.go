@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
 )
@@ -24,13 +25,13 @@ type TypeAssertionIssue struct {
 	Position    Position `json:"position"`
 }
 
-func findTypeAssertions(dir string) (*TypeAssertionAnalysis, error) {
+func findTypeAssertions(ctx context.Context, dir string) (*TypeAssertionAnalysis, error) {
 	analysis := &TypeAssertionAnalysis{
 		Assertions: []TypeAssertion{},
 		Issues:     []TypeAssertionIssue{},
 	}
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		ast.Inspect(file, func(n ast.Node) bool {
 			switch node := n.(type) {
 			case *ast.TypeAssertExpr:
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"strings"
 )
@@ -44,15 +45,15 @@ type DocMethod struct {
 	Description string `json:"description"`
 }
 
-func generateDocs(dir string, format string) (interface{}, error) {
+func generateDocs(ctx context.Context, dir string, format string) (interface{}, error) {
 	if format == "markdown" {
-		return generateMarkdownDocs(dir)
+		return generateMarkdownDocs(ctx, dir)
 	}
-	return generateJsonDocs(dir)
+	return generateJsonDocs(ctx, dir)
 }
 
-func generateMarkdownDocs(dir string) (string, error) {
-	apis, err := extractApi(dir)
+func generateMarkdownDocs(ctx context.Context, dir string) (string, error) {
+	apis, err := extractApi(ctx, dir)
 	if err != nil {
 		return "", err
 	}
@@ -86,8 +87,8 @@ func generateMarkdownDocs(dir string) (string, error) {
 	return markdown.String(), nil
 }
 
-func generateJsonDocs(dir string) ([]DocInfo, error) {
-	apis, err := extractApi(dir)
+func generateJsonDocs(ctx context.Context, dir string) ([]DocInfo, error) {
+	apis, err := extractApi(ctx, dir)
 	if err != nil {
 		return nil, err
 	}
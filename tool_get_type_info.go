@@ -1,10 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"go/ast"
 	"go/token"
-	"strings"
+	"go/types"
 )
 
 type TypeInfo struct {
@@ -35,163 +35,102 @@ type MethodInfo struct {
 	Position  Position `json:"position"`
 }
 
-func getTypeInfo(dir string, typeName string) (*TypeInfo, error) {
-	var result *TypeInfo
-	
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
-		if result != nil {
-			return nil
-		}
-
-		ast.Inspect(file, func(n ast.Node) bool {
-			if result != nil {
-				return false
-			}
+func getTypeInfo(ctx context.Context, dir string, typeName string) (*TypeInfo, error) {
+	pkgs, err := loadPackages(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
 
-			switch decl := n.(type) {
-			case *ast.GenDecl:
-				for _, spec := range decl.Specs {
-					if ts, ok := spec.(*ast.TypeSpec); ok && ts.Name.Name == typeName {
-						pos := fset.Position(ts.Pos())
-						info := &TypeInfo{
-							Name:     typeName,
-							Package:  file.Name.Name,
-							Position: newPosition(pos),
-						}
-
-						switch t := ts.Type.(type) {
-						case *ast.StructType:
-							info.Kind = "struct"
-							info.Fields = extractFields(t, fset)
-							info.Embedded = extractEmbedded(t)
-
-						case *ast.InterfaceType:
-							info.Kind = "interface"
-							info.Interface = extractInterfaceMethods(t, fset)
-
-						case *ast.Ident:
-							info.Kind = "alias"
-							info.Underlying = t.Name
-
-						case *ast.SelectorExpr:
-							info.Kind = "alias"
-							if x, ok := t.X.(*ast.Ident); ok {
-								info.Underlying = x.Name + "." + t.Sel.Name
-							}
-
-						default:
-							info.Kind = "other"
-						}
-
-						info.Methods = extractMethods(file, typeName, fset)
-						result = info
-						return false
-					}
-				}
+	for _, pkg := range pkgs {
+		for _, name := range pkg.Types.Scope().Names() {
+			obj, ok := pkg.Types.Scope().Lookup(name).(*types.TypeName)
+			if !ok || !objectMatches(obj, typeName) {
+				continue
 			}
-			return true
-		})
-
-		return nil
-	})
-
-	if result == nil && err == nil {
-		return nil, fmt.Errorf("type %s not found", typeName)
+			return buildTypeInfo(obj, pkg.Fset), nil
+		}
 	}
 
-	return result, err
+	return nil, fmt.Errorf("type %s not found", typeName)
 }
 
-func extractFields(st *ast.StructType, fset *token.FileSet) []FieldInfo {
-	var fields []FieldInfo
-	
-	for _, field := range st.Fields.List {
-		fieldType := exprToString(field.Type)
-		tag := ""
-		if field.Tag != nil {
-			tag = field.Tag.Value
-		}
+func buildTypeInfo(obj *types.TypeName, fset *token.FileSet) *TypeInfo {
+	qualifier := types.RelativeTo(obj.Pkg())
+	info := &TypeInfo{
+		Name:     obj.Name(),
+		Package:  obj.Pkg().Name(),
+		Position: newPosition(fset.Position(obj.Pos())),
+	}
 
-		if len(field.Names) == 0 {
-			pos := fset.Position(field.Pos())
-			fields = append(fields, FieldInfo{
-				Name:     "",
+	switch t := obj.Type().Underlying().(type) {
+	case *types.Struct:
+		info.Kind = "struct"
+		for i := 0; i < t.NumFields(); i++ {
+			field := t.Field(i)
+			fieldType := types.TypeString(field.Type(), qualifier)
+			name := field.Name()
+			if field.Embedded() {
+				name = ""
+				info.Embedded = append(info.Embedded, fieldType)
+			}
+			info.Fields = append(info.Fields, FieldInfo{
+				Name:     name,
 				Type:     fieldType,
-				Tag:      tag,
-				Exported: true,
-				Position: newPosition(pos),
+				Tag:      t.Tag(i),
+				Exported: field.Exported(),
+				Position: newPosition(fset.Position(field.Pos())),
 			})
-		} else {
-			for _, name := range field.Names {
-				pos := fset.Position(name.Pos())
-				fields = append(fields, FieldInfo{
-					Name:     name.Name,
-					Type:     fieldType,
-					Tag:      tag,
-					Exported: ast.IsExported(name.Name),
-					Position: newPosition(pos),
-				})
-			}
 		}
-	}
-	
-	return fields
-}
 
-func extractEmbedded(st *ast.StructType) []string {
-	var embedded []string
-	
-	for _, field := range st.Fields.List {
-		if len(field.Names) == 0 {
-			embedded = append(embedded, exprToString(field.Type))
+	case *types.Interface:
+		info.Kind = "interface"
+		for i := 0; i < t.NumMethods(); i++ {
+			method := t.Method(i)
+			info.Interface = append(info.Interface, MethodInfo{
+				Name:      method.Name(),
+				Signature: types.TypeString(method.Type(), qualifier),
+				Exported:  method.Exported(),
+				Position:  newPosition(fset.Position(method.Pos())),
+			})
 		}
+
+	case *types.Basic:
+		info.Kind = "alias"
+		info.Underlying = t.Name()
+
+	default:
+		info.Kind = "other"
+		info.Underlying = types.TypeString(t, qualifier)
 	}
-	
-	return embedded
-}
 
-func extractInterfaceMethods(it *ast.InterfaceType, fset *token.FileSet) []MethodInfo {
-	var methods []MethodInfo
-	
-	for _, method := range it.Methods.List {
-		if len(method.Names) > 0 {
-			for _, name := range method.Names {
-				sig := exprToString(method.Type)
-				pos := fset.Position(name.Pos())
-				methods = append(methods, MethodInfo{
-					Name:      name.Name,
-					Signature: sig,
-					Exported:  ast.IsExported(name.Name),
-					Position:  newPosition(pos),
-				})
-			}
-		}
+	if obj.IsAlias() {
+		info.Kind = "alias"
+		info.Underlying = types.TypeString(types.Unalias(obj.Type()), qualifier)
 	}
-	
-	return methods
+
+	if _, isInterface := obj.Type().Underlying().(*types.Interface); !isInterface {
+		info.Methods = extractMethods(obj.Type(), fset, qualifier)
+	}
+
+	return info
 }
 
-func extractMethods(file *ast.File, typeName string, fset *token.FileSet) []MethodInfo {
+// extractMethods lists the method set of *T, including promoted methods
+func extractMethods(t types.Type, fset *token.FileSet, qualifier types.Qualifier) []MethodInfo {
 	var methods []MethodInfo
-	
-	for _, decl := range file.Decls {
-		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv != nil {
-			for _, recv := range fn.Recv.List {
-				recvType := exprToString(recv.Type)
-				if strings.Contains(recvType, typeName) {
-					sig := funcSignature(fn.Type)
-					pos := fset.Position(fn.Name.Pos())
-					methods = append(methods, MethodInfo{
-						Name:      fn.Name.Name,
-						Signature: sig,
-						Receiver:  recvType,
-						Exported:  ast.IsExported(fn.Name.Name),
-						Position:  newPosition(pos),
-					})
-				}
-			}
-		}
+
+	mset := types.NewMethodSet(types.NewPointer(t))
+	for i := 0; i < mset.Len(); i++ {
+		fn := mset.At(i).Obj().(*types.Func)
+		recv := fn.Signature().Recv()
+		methods = append(methods, MethodInfo{
+			Name:      fn.Name(),
+			Signature: types.TypeString(fn.Type(), qualifier),
+			Receiver:  types.TypeString(recv.Type(), qualifier),
+			Exported:  fn.Exported(),
+			Position:  newPosition(fset.Position(fn.Pos())),
+		})
 	}
-	
+
 	return methods
-}
\ No newline at end of file
+}
@@ -2,13 +2,52 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io"
 	"os/exec"
+	"time"
 )
 
+// goCommand prepares `go args...` in dir. When ctx is done the command's
+// whole process group is killed, including any binary go run or go test
+// started.
+func goCommand(ctx context.Context, dir string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = dir
+	killProcessGroup(cmd)
+	// Don't let orphans still holding the output pipes block Wait
+	cmd.WaitDelay = time.Second
+	return cmd
+}
+
+// interruption describes how ctx stopped a command, or returns "" if it
+// did not
+func interruption(ctx context.Context) string {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return "execution timeout exceeded"
+	case errors.Is(ctx.Err(), context.Canceled):
+		return "execution cancelled"
+	}
+	return ""
+}
+
 // runCommand executes a command and returns stdout, stderr, exit code, and error
 func runCommand(cmd *exec.Cmd) (stdout, stderr string, exitCode int, err error) {
+	return runCommandLines(cmd, nil)
+}
+
+// runCommandLines is runCommand, also passing each line of stdout to onLine
+// as the command writes it
+func runCommandLines(cmd *exec.Cmd, onLine func(line string)) (stdout, stderr string, exitCode int, err error) {
 	var stdoutBuf, stderrBuf bytes.Buffer
 	cmd.Stdout = &stdoutBuf
+	if onLine != nil {
+		lines := &lineWriter{onLine: onLine}
+		cmd.Stdout = io.MultiWriter(&stdoutBuf, lines)
+		defer lines.flush()
+	}
 	cmd.Stderr = &stderrBuf
 
 	err = cmd.Run()
@@ -22,4 +61,31 @@ func runCommand(cmd *exec.Cmd) (stdout, stderr string, exitCode int, err error)
 	}
 
 	return stdoutBuf.String(), stderrBuf.String(), exitCode, err
-}
\ No newline at end of file
+}
+
+// lineWriter splits what is written to it into lines
+type lineWriter struct {
+	onLine  func(line string)
+	partial []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.onLine(string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush passes on a last line without a newline
+func (w *lineWriter) flush() {
+	if len(w.partial) > 0 {
+		w.onLine(string(w.partial))
+		w.partial = nil
+	}
+}
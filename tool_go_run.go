@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
@@ -18,7 +17,7 @@ type GoRunResult struct {
 	WorkDir  string `json:"work_dir"`
 }
 
-func goRun(path string, flags []string, timeout time.Duration) (*GoRunResult, error) {
+func goRun(ctx context.Context, path string, flags []string, timeout time.Duration) (*GoRunResult, error) {
 	// Resolve absolute path
 	absPath, err := filepath.Abs(path)
 	if err != nil {
@@ -51,16 +50,24 @@ func goRun(path string, flags []string, timeout time.Duration) (*GoRunResult, er
 		target = filepath.Base(absPath)
 	}
 
+	flags, err = sandboxFlags(ctx, workDir, flags)
+	if err != nil {
+		return &GoRunResult{
+			Error:   err.Error(),
+			Command: "go run " + path,
+			WorkDir: workDir,
+		}, nil
+	}
+
 	// Build command arguments
 	args := []string{"run"}
 	args = append(args, flags...)
 	args = append(args, target)
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "go", args...)
-	cmd.Dir = workDir
+	cmd := goCommand(ctx, workDir, args...)
 
 	stdout, stderr, exitCode, cmdErr := runCommand(cmd)
 
@@ -72,12 +79,10 @@ func goRun(path string, flags []string, timeout time.Duration) (*GoRunResult, er
 		WorkDir:  workDir,
 	}
 
-	if cmdErr != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			result.Error = "execution timeout exceeded"
-		} else {
-			result.Error = cmdErr.Error()
-		}
+	if reason := interruption(ctx); reason != "" {
+		result.Error = reason
+	} else if cmdErr != nil {
+		result.Error = cmdErr.Error()
 	}
 
 	return result, nil
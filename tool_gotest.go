@@ -2,25 +2,80 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 type GoTestResult struct {
-	Stdout    string `json:"stdout"`
-	Stderr    string `json:"stderr"`
-	ExitCode  int    `json:"exit_code"`
-	Error     string `json:"error,omitempty"`
-	Command   string `json:"command"`
-	WorkDir   string `json:"work_dir"`
-	Passed    bool   `json:"passed"`
-	TestCount int    `json:"test_count,omitempty"`
+	Stdout       string              `json:"stdout"`
+	Stderr       string              `json:"stderr"`
+	ExitCode     int                 `json:"exit_code"`
+	Error        string              `json:"error,omitempty"`
+	Command      string              `json:"command"`
+	WorkDir      string              `json:"work_dir"`
+	Passed       bool                `json:"passed"`
+	TestCount    int                 `json:"test_count"`
+	Packages     []TestPackageResult `json:"packages"`
+	Tests        []TestCaseResult    `json:"tests"`
+	FirstFailure *TestFailure        `json:"first_failure,omitempty"`
 }
 
-func goTest(path string, flags []string, timeout time.Duration) (*GoTestResult, error) {
+type TestPackageResult struct {
+	Package string  `json:"package"`
+	Status  string  `json:"status"` // pass, fail or skip
+	Elapsed float64 `json:"elapsed"`
+	Passed  int     `json:"passed"`
+	Failed  int     `json:"failed"`
+	Skipped int     `json:"skipped"`
+	Output  string  `json:"output,omitempty"` // output not attributed to any test
+}
+
+// TestCaseResult is a test or subtest; Name is the full slash-separated name
+type TestCaseResult struct {
+	Package string       `json:"package"`
+	Name    string       `json:"name"`
+	Parent  string       `json:"parent,omitempty"`
+	Status  string       `json:"status"` // pass, fail, skip, or run if it never finished
+	Elapsed float64      `json:"elapsed"`
+	Output  string       `json:"output,omitempty"`
+	Failure *TestFailure `json:"failure,omitempty"`
+}
+
+type TestFailure struct {
+	Package string `json:"package"`
+	Test    string `json:"test,omitempty"`
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+// testEvent is a line of `go test -json` output, see `go doc test2json`
+type testEvent struct {
+	Action     string
+	Package    string
+	Test       string
+	Elapsed    float64
+	Output     string
+	ImportPath string // build-output and build-fail events
+}
+
+var (
+	// "    foo_test.go:12: message" as printed by t.Error and friends
+	testLogPattern = regexp.MustCompile(`^\s+([^\s:]+\.go):(\d+): ?(.*)$`)
+	// "\t/abs/path/foo_test.go:12 +0x1d" in a panic stack trace
+	stackFramePattern = regexp.MustCompile(`^\s+(/\S+\.go):(\d+)(?: \+0x[0-9a-f]+)?$`)
+	// "./foo.go:12:3: message" from the compiler
+	compileErrorPattern = regexp.MustCompile(`^(\S+\.go):(\d+)(?::\d+)?: (.*)$`)
+)
+
+func goTest(ctx context.Context, path string, patterns, flags []string, timeout time.Duration) (*GoTestResult, error) {
 	// Resolve absolute path
 	absPath, err := filepath.Abs(path)
 	if err != nil {
@@ -30,10 +85,6 @@ func goTest(path string, flags []string, timeout time.Duration) (*GoTestResult,
 		}, nil
 	}
 
-	// Determine working directory and target
-	var workDir string
-	var target string
-
 	// Check if path is a file or directory
 	info, err := os.Stat(absPath)
 	if err != nil {
@@ -43,31 +94,54 @@ func goTest(path string, flags []string, timeout time.Duration) (*GoTestResult,
 		}, nil
 	}
 
-	if info.IsDir() {
-		// Testing a package
-		workDir = absPath
-		target = "."
-	} else {
-		// Testing a specific file (though go test typically works with packages)
+	// Patterns are relative to the package directory, or to the directory
+	// of a file (though go test typically works with packages)
+	workDir := absPath
+	if !info.IsDir() {
 		workDir = filepath.Dir(absPath)
-		target = "."
+	}
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	err = checkTestPatterns(ctx, workDir, patterns)
+	if err == nil {
+		flags, err = sandboxFlags(ctx, workDir, flags)
+	}
+	if err != nil {
+		return &GoTestResult{
+			Error:   err.Error(),
+			Command: "go test " + strings.Join(patterns, " "),
+			WorkDir: workDir,
+		}, nil
 	}
 
-	// Build command arguments
+	// Build command arguments, always requesting the test2json event stream
 	args := []string{"test"}
+	if !contains(flags, "-json") {
+		args = append(args, "-json")
+	}
 	args = append(args, flags...)
-	args = append(args, target)
+	args = append(args, patterns...)
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "go", args...)
-	cmd.Dir = workDir
+	// The packages are counted as their events arrive, so the total grows
+	// until the last one starts
+	progress := startGrowingProgress(ctx, "testing packages")
 
-	stdout, stderr, exitCode, cmdErr := runCommand(cmd)
+	// Fold the event stream as it arrives, reporting finished packages
+	collector := newTestCollector(ctx, workDir)
+	cmd := goCommand(ctx, workDir, args...)
+	_, stderr, exitCode, cmdErr := runCommandLines(cmd, func(line string) {
+		finished, started := collector.finished, len(collector.pkgOrder)
+		collector.addLine(line)
+		if collector.finished > finished || len(collector.pkgOrder) > started {
+			progress(collector.finished, len(collector.pkgOrder))
+		}
+	})
 
 	result := &GoTestResult{
-		Stdout:   stdout,
 		Stderr:   stderr,
 		ExitCode: exitCode,
 		Command:  "go " + strings.Join(args, " "),
@@ -75,32 +149,356 @@ func goTest(path string, flags []string, timeout time.Duration) (*GoTestResult,
 		Passed:   exitCode == 0,
 	}
 
-	// Try to extract test count from output
-	if strings.Contains(stdout, "PASS") || strings.Contains(stdout, "FAIL") {
-		result.TestCount = countTests(stdout)
+	collector.addBuildOutput(stderr)
+	collector.finish(result)
+
+	if reason := interruption(ctx); reason != "" {
+		result.Error = reason
+	} else if cmdErr != nil {
+		result.Error = cmdErr.Error()
 	}
 
-	if cmdErr != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			result.Error = "execution timeout exceeded"
-		} else {
-			result.Error = cmdErr.Error()
+	return result, nil
+}
+
+// checkTestPatterns accepts relative package patterns such as ".", "./pkg"
+// or "./...", whose directories up to the first wildcard must pass the
+// sandbox like any path argument. Import paths are refused, since they may
+// name packages anywhere.
+func checkTestPatterns(ctx context.Context, dir string, patterns []string) error {
+	resolve := resolverFromContext(ctx)
+	for _, pattern := range patterns {
+		if pattern != "." && pattern != ".." && !strings.HasPrefix(pattern, "./") && !strings.HasPrefix(pattern, "../") {
+			return fmt.Errorf("package pattern %q must be relative, such as ./... or ./pkg", pattern)
+		}
+		// "./foo..." also matches ./foobar, so its whole directory is checked
+		prefix, _, wildcard := strings.Cut(pattern, "...")
+		checked := filepath.Join(dir, prefix)
+		if wildcard && !strings.HasSuffix(prefix, "/") {
+			checked = filepath.Dir(checked)
+		}
+		if _, err := resolve(checked); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	return result, nil
+// testCollector folds a test2json event stream into per-package and
+// per-test results
+type testCollector struct {
+	ctx      context.Context // for the go commands locating files
+	dir      string
+	pkgDirs  map[string]string
+	stdout   strings.Builder
+	packages map[string]*TestPackageResult
+	pkgOrder []string
+	tests    map[string]*TestCaseResult // keyed by package + " " + name
+	order    []string
+	output   map[string]*strings.Builder
+	failed   []string // tests in the order they failed
+	finished int      // packages with a final status
+	build    []buildLine
 }
 
-// Helper function to count tests from go test output
-func countTests(output string) int {
-	count := 0
+// buildLine is a line of compiler output and the package being built
+type buildLine struct {
+	pkg  string
+	text string
+}
+
+func newTestCollector(ctx context.Context, dir string) *testCollector {
+	return &testCollector{
+		ctx:      ctx,
+		dir:      dir,
+		pkgDirs:  make(map[string]string),
+		packages: make(map[string]*TestPackageResult),
+		tests:    make(map[string]*TestCaseResult),
+		output:   make(map[string]*strings.Builder),
+	}
+}
+
+// addLine records one line of `go test -json` output; lines that are not
+// events, such as output from a failed build, are kept verbatim
+func (c *testCollector) addLine(line string) {
+	var event testEvent
+	if !strings.HasPrefix(line, "{") || json.Unmarshal([]byte(line), &event) != nil {
+		c.stdout.WriteString(line + "\n")
+		c.build = append(c.build, buildLine{text: line})
+		return
+	}
+	c.add(event)
+}
+
+func (c *testCollector) add(event testEvent) {
+	switch event.Action {
+	case "build-output":
+		c.stdout.WriteString(event.Output)
+		pkg, _, _ := strings.Cut(event.ImportPath, " ")
+		c.build = append(c.build, buildLine{pkg: pkg, text: strings.TrimRight(event.Output, "\n")})
+		return
+	case "build-fail":
+		return
+	}
+
+	c.stdout.WriteString(event.Output)
+	if event.Package == "" {
+		return
+	}
+
+	pkg := c.packages[event.Package]
+	if pkg == nil {
+		pkg = &TestPackageResult{Package: event.Package}
+		c.packages[event.Package] = pkg
+		c.pkgOrder = append(c.pkgOrder, event.Package)
+		c.output[event.Package] = &strings.Builder{}
+	}
+
+	if event.Test == "" {
+		switch event.Action {
+		case "output":
+			c.output[event.Package].WriteString(event.Output)
+		case "pass", "fail", "skip":
+			if pkg.Status == "" {
+				c.finished++
+			}
+			pkg.Status = event.Action
+			pkg.Elapsed = event.Elapsed
+		}
+		return
+	}
+
+	key := event.Package + " " + event.Test
+	test := c.tests[key]
+	if test == nil {
+		test = &TestCaseResult{Package: event.Package, Name: event.Test, Status: "run"}
+		if idx := strings.LastIndex(event.Test, "/"); idx >= 0 {
+			test.Parent = event.Test[:idx]
+		}
+		c.tests[key] = test
+		c.order = append(c.order, key)
+		c.output[key] = &strings.Builder{}
+	}
+
+	switch event.Action {
+	case "output":
+		if !isTestFraming(event.Output) {
+			c.output[key].WriteString(event.Output)
+		}
+	case "pass", "fail", "skip":
+		test.Status = event.Action
+		test.Elapsed = event.Elapsed
+		switch event.Action {
+		case "pass":
+			pkg.Passed++
+		case "fail":
+			pkg.Failed++
+			c.failed = append(c.failed, key)
+		case "skip":
+			pkg.Skipped++
+		}
+	}
+}
+
+// addBuildOutput records compiler output printed outside the event stream
+func (c *testCollector) addBuildOutput(stderr string) {
+	for _, line := range strings.Split(stderr, "\n") {
+		if line != "" {
+			c.build = append(c.build, buildLine{text: line})
+		}
+	}
+}
+
+func (c *testCollector) finish(result *GoTestResult) {
+	result.Stdout = c.stdout.String()
+	result.Packages = []TestPackageResult{}
+	result.Tests = []TestCaseResult{}
+
+	failedChildren := make(map[string]bool)
+	for _, key := range c.failed {
+		if test := c.tests[key]; test.Parent != "" {
+			failedChildren[test.Package+" "+test.Parent] = true
+		}
+	}
+
+	for _, key := range c.order {
+		test := c.tests[key]
+		test.Output = c.output[key].String()
+		if test.Status == "fail" || test.Status == "run" {
+			test.Failure = c.failureIn(test.Package, test.Name, test.Output)
+			// A parent failing only because a subtest did has nothing to add
+			if test.Failure != nil && test.Failure.File == "" && failedChildren[key] {
+				test.Failure = nil
+			}
+		}
+	}
+
+	for _, key := range c.failed {
+		if failure := c.tests[key].Failure; failure != nil && failure.File != "" {
+			result.FirstFailure = failure
+			break
+		}
+	}
+	if result.FirstFailure == nil && len(c.failed) > 0 {
+		result.FirstFailure = c.tests[c.failed[0]].Failure
+	}
+
+	for _, name := range c.pkgOrder {
+		pkg := c.packages[name]
+		if pkg.Status == "fail" || pkg.Status == "" {
+			pkg.Output = c.output[name].String()
+			if result.FirstFailure == nil {
+				result.FirstFailure = c.failureIn(name, "", pkg.Output)
+			}
+		}
+		result.Packages = append(result.Packages, *pkg)
+	}
+
+	if result.FirstFailure == nil {
+		result.FirstFailure = c.buildFailure()
+	}
+
+	for _, key := range c.order {
+		result.Tests = append(result.Tests, *c.tests[key])
+	}
+	result.TestCount = len(result.Tests)
+}
+
+// failureIn locates the first failure in a test's output: a t.Error style
+// log line, or else the innermost non-runtime frame of a panic
+func (c *testCollector) failureIn(pkg, test, output string) *TestFailure {
 	lines := strings.Split(output, "\n")
-	for _, line := range lines {
-		if strings.HasPrefix(strings.TrimSpace(line), "--- PASS:") ||
-			strings.HasPrefix(strings.TrimSpace(line), "--- FAIL:") ||
-			strings.HasPrefix(strings.TrimSpace(line), "--- SKIP:") {
-			count++
+	failure := &TestFailure{Package: pkg, Test: test}
+
+	for i, line := range lines {
+		if m := testLogPattern.FindStringSubmatch(line); m != nil {
+			failure.File = c.resolveFile(pkg, m[1])
+			failure.Line, _ = strconv.Atoi(m[2])
+			failure.Message = strings.TrimSpace(m[3])
+			// Indented continuation lines belong to the same message
+			for _, next := range lines[i+1:] {
+				if !strings.HasPrefix(next, "        ") || testLogPattern.MatchString(next) {
+					break
+				}
+				failure.Message += "\n" + strings.TrimSpace(next)
+			}
+			return failure
 		}
 	}
-	return count
-}
\ No newline at end of file
+
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "panic: ") {
+			continue
+		}
+		failure.Message = strings.TrimPrefix(line, "panic: ")
+		for _, frame := range lines[i+1:] {
+			m := stackFramePattern.FindStringSubmatch(frame)
+			if m == nil || strings.HasPrefix(m[1], filepath.Join(c.goroot(), "src")+string(filepath.Separator)) {
+				continue
+			}
+			failure.File = m[1]
+			failure.Line, _ = strconv.Atoi(m[2])
+			break
+		}
+		return failure
+	}
+
+	if test == "" {
+		return nil
+	}
+	failure.Message = "test failed without a recognizable failure message"
+	return failure
+}
+
+// buildFailure reports the first compiler error, if the build failed
+func (c *testCollector) buildFailure() *TestFailure {
+	for _, line := range c.build {
+		if m := compileErrorPattern.FindStringSubmatch(strings.TrimSpace(line.text)); m != nil {
+			lineNo, _ := strconv.Atoi(m[2])
+			return &TestFailure{
+				Package: line.pkg,
+				File:    c.resolveFile(line.pkg, m[1]),
+				Line:    lineNo,
+				Message: m[3],
+			}
+		}
+	}
+	return nil
+}
+
+// resolveFile turns a relative file name printed by go test for pkg into a
+// path. Test logs name files relative to the package directory and
+// compiler errors relative to the directory tests were run in, so both are
+// tried in that order.
+func (c *testCollector) resolveFile(pkg, file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	for _, dir := range []string{c.packageDir(pkg), c.dir} {
+		if dir == "" {
+			continue
+		}
+		candidate := filepath.Join(dir, file)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return file
+}
+
+// packageDir returns the directory of the package with import path pkg,
+// asking the go command once per package
+func (c *testCollector) packageDir(pkg string) string {
+	if pkg == "" {
+		return ""
+	}
+	dir, ok := c.pkgDirs[pkg]
+	if !ok {
+		if out, err := goCommand(c.ctx, c.dir, "list", "-f", "{{.Dir}}", pkg).Output(); err == nil {
+			dir = strings.TrimSpace(string(out))
+		}
+		c.pkgDirs[pkg] = dir
+	}
+	return dir
+}
+
+// isTestFraming reports whether a line is one test2json already reflects in
+// the event actions, such as "=== RUN" or "--- PASS:"
+func isTestFraming(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	for _, prefix := range []string{"=== RUN", "=== PAUSE", "=== CONT", "=== NAME", "--- PASS:", "--- FAIL:", "--- SKIP:"} {
+		if strings.HasPrefix(trimmed, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// goroot returns the GOROOT of the go command used to run tests, whose
+// frames are skipped when locating a panic. It is asked under a timeout of
+// its own, since the call's context may already be done when the failures
+// are read.
+func (c *testCollector) goroot() string {
+	gorootCache.Lock()
+	defer gorootCache.Unlock()
+
+	if gorootCache.dir == "" {
+		ctx, cancel := context.WithTimeout(context.Background(), gorootTimeout)
+		defer cancel()
+		out, err := goCommand(ctx, c.dir, "env", "GOROOT").Output()
+		if err != nil {
+			return ""
+		}
+		gorootCache.dir = strings.TrimSpace(string(out))
+	}
+	return gorootCache.dir
+}
+
+// gorootTimeout bounds the go command reporting GOROOT
+const gorootTimeout = 10 * time.Second
+
+// gorootCache holds the GOROOT once a go command has reported it
+var gorootCache struct {
+	sync.Mutex
+	dir string
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// events renders test2json events as the lines go test -json prints
+func events(t *testing.T, evs ...testEvent) []string {
+	t.Helper()
+
+	var lines []string
+	for _, ev := range evs {
+		line, err := json.Marshal(ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, string(line))
+	}
+	return lines
+}
+
+func TestTestCollector(t *testing.T) {
+	root := writeModule(t, map[string]string{
+		"a/a_test.go": "package a\n",
+		"b/b.go":      "package b\n",
+	})
+
+	tests := []struct {
+		name        string
+		lines       []string
+		stderr      string
+		wantFailure *TestFailure
+		wantTests   map[string]string // name to status
+		wantCounts  [3]int            // passed, failed, skipped of the first package
+	}{
+		{
+			name: "t.Error with continuation",
+			lines: events(t,
+				testEvent{Action: "start", Package: "example.com/m/a"},
+				testEvent{Action: "run", Package: "example.com/m/a", Test: "TestA"},
+				testEvent{Action: "output", Package: "example.com/m/a", Test: "TestA", Output: "=== RUN   TestA\n"},
+				testEvent{Action: "output", Package: "example.com/m/a", Test: "TestA", Output: "    a_test.go:7: got 1\n"},
+				testEvent{Action: "output", Package: "example.com/m/a", Test: "TestA", Output: "        want 2\n"},
+				testEvent{Action: "output", Package: "example.com/m/a", Test: "TestA", Output: "--- FAIL: TestA (0.00s)\n"},
+				testEvent{Action: "fail", Package: "example.com/m/a", Test: "TestA"},
+				testEvent{Action: "run", Package: "example.com/m/a", Test: "TestB"},
+				testEvent{Action: "pass", Package: "example.com/m/a", Test: "TestB"},
+				testEvent{Action: "fail", Package: "example.com/m/a"},
+			),
+			wantFailure: &TestFailure{
+				Package: "example.com/m/a",
+				Test:    "TestA",
+				File:    filepath.Join(root, "a", "a_test.go"),
+				Line:    7,
+				Message: "got 1\nwant 2",
+			},
+			wantTests:  map[string]string{"TestA": "fail", "TestB": "pass"},
+			wantCounts: [3]int{1, 1, 0},
+		},
+		{
+			name: "failing subtest blames the subtest",
+			lines: events(t,
+				testEvent{Action: "run", Package: "example.com/m/a", Test: "TestT"},
+				testEvent{Action: "run", Package: "example.com/m/a", Test: "TestT/case"},
+				testEvent{Action: "output", Package: "example.com/m/a", Test: "TestT/case", Output: "    a_test.go:12: bad case\n"},
+				testEvent{Action: "fail", Package: "example.com/m/a", Test: "TestT/case"},
+				testEvent{Action: "fail", Package: "example.com/m/a", Test: "TestT"},
+				testEvent{Action: "skip", Package: "example.com/m/a", Test: "TestS"},
+				testEvent{Action: "fail", Package: "example.com/m/a"},
+			),
+			wantFailure: &TestFailure{
+				Package: "example.com/m/a",
+				Test:    "TestT/case",
+				File:    filepath.Join(root, "a", "a_test.go"),
+				Line:    12,
+				Message: "bad case",
+			},
+			wantTests:  map[string]string{"TestT": "fail", "TestT/case": "fail", "TestS": "skip"},
+			wantCounts: [3]int{0, 2, 1},
+		},
+		{
+			name: "panic points at the innermost frame outside GOROOT",
+			lines: events(t,
+				testEvent{Action: "run", Package: "example.com/m/a", Test: "TestP"},
+				testEvent{Action: "output", Package: "example.com/m/a", Test: "TestP", Output: "panic: runtime error: index out of range [3] with length 0 [recovered]\n"},
+				testEvent{Action: "output", Package: "example.com/m/a", Test: "TestP", Output: "goroutine 7 [running]:\n"},
+				testEvent{Action: "output", Package: "example.com/m/a", Test: "TestP", Output: "testing.tRunner.func1.2({0x5a8b20, 0xc000012345})\n"},
+				testEvent{Action: "output", Package: "example.com/m/a", Test: "TestP", Output: "\t" + filepath.Join(gorootForTest(t, root), "src", "testing", "testing.go") + ":1632 +0x230\n"},
+				testEvent{Action: "output", Package: "example.com/m/a", Test: "TestP", Output: "example.com/m/a.TestP(0xc000003a00)\n"},
+				testEvent{Action: "output", Package: "example.com/m/a", Test: "TestP", Output: "\t" + filepath.Join(root, "a", "a_test.go") + ":9 +0x1d\n"},
+				testEvent{Action: "fail", Package: "example.com/m/a", Test: "TestP"},
+				testEvent{Action: "fail", Package: "example.com/m/a"},
+			),
+			wantFailure: &TestFailure{
+				Package: "example.com/m/a",
+				Test:    "TestP",
+				File:    filepath.Join(root, "a", "a_test.go"),
+				Line:    9,
+				Message: "runtime error: index out of range [3] with length 0 [recovered]",
+			},
+			wantTests:  map[string]string{"TestP": "fail"},
+			wantCounts: [3]int{0, 1, 0},
+		},
+		{
+			name: "compile error resolved against the run directory",
+			lines: events(t,
+				testEvent{Action: "build-output", ImportPath: "example.com/m/b [example.com/m/b.test]", Output: "# example.com/m/b\n"},
+				testEvent{Action: "build-output", ImportPath: "example.com/m/b [example.com/m/b.test]", Output: "b/b.go:3:2: undefined: x\n"},
+				testEvent{Action: "build-fail", ImportPath: "example.com/m/b [example.com/m/b.test]"},
+				testEvent{Action: "start", Package: "example.com/m/b"},
+				testEvent{Action: "output", Package: "example.com/m/b", Output: "FAIL\texample.com/m/b [build failed]\n"},
+				testEvent{Action: "fail", Package: "example.com/m/b"},
+			),
+			wantFailure: &TestFailure{
+				Package: "example.com/m/b",
+				File:    filepath.Join(root, "b", "b.go"),
+				Line:    3,
+				Message: "undefined: x",
+			},
+			wantTests: map[string]string{},
+		},
+		{
+			name:   "compile error outside the event stream",
+			lines:  []string{"# example.com/m/b", "not json"},
+			stderr: "b/b.go:5: syntax error\n",
+			wantFailure: &TestFailure{
+				File:    filepath.Join(root, "b", "b.go"),
+				Line:    5,
+				Message: "syntax error",
+			},
+			wantTests: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCollector(context.Background(), root)
+			for _, line := range tt.lines {
+				c.addLine(line)
+			}
+			c.addBuildOutput(tt.stderr)
+			result := &GoTestResult{}
+			c.finish(result)
+
+			if !reflect.DeepEqual(result.FirstFailure, tt.wantFailure) {
+				t.Errorf("FirstFailure = %+v, want %+v", result.FirstFailure, tt.wantFailure)
+			}
+
+			statuses := make(map[string]string)
+			for _, test := range result.Tests {
+				statuses[test.Name] = test.Status
+				if strings.Contains(test.Output, "=== RUN") || strings.Contains(test.Output, "--- FAIL") {
+					t.Errorf("%s output keeps test framing: %q", test.Name, test.Output)
+				}
+			}
+			if !reflect.DeepEqual(statuses, tt.wantTests) {
+				t.Errorf("test statuses = %v, want %v", statuses, tt.wantTests)
+			}
+			if result.TestCount != len(tt.wantTests) {
+				t.Errorf("TestCount = %d, want %d", result.TestCount, len(tt.wantTests))
+			}
+
+			if len(result.Packages) > 0 {
+				pkg := result.Packages[0]
+				if got := [3]int{pkg.Passed, pkg.Failed, pkg.Skipped}; got != tt.wantCounts {
+					t.Errorf("package counts = %v, want %v", got, tt.wantCounts)
+				}
+			}
+		})
+	}
+}
+
+func gorootForTest(t *testing.T, dir string) string {
+	t.Helper()
+
+	goroot := (&testCollector{dir: dir}).goroot()
+	if goroot == "" {
+		t.Fatal("go env GOROOT failed")
+	}
+	return goroot
+}
+
+// GOROOT is still found for a call whose context has ended
+func TestGorootAfterCancel(t *testing.T) {
+	gorootCache.Lock()
+	gorootCache.dir = ""
+	gorootCache.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if goroot := newTestCollector(ctx, t.TempDir()).goroot(); goroot == "" {
+		t.Errorf("goroot() under a cancelled call = %q, want GOROOT", goroot)
+	}
+}
+
+func TestCheckTestPatterns(t *testing.T) {
+	root := writeModule(t, map[string]string{"a/a.go": "package a\n"})
+	ctx := context.WithValue(context.Background(), pathResolverKey{}, pathResolver(func(path string) (string, error) {
+		return checkWithin(path, []string{root})
+	}))
+
+	tests := []struct {
+		dir      string
+		patterns []string
+		wantErr  string
+	}{
+		{root, []string{"."}, ""},
+		{root, []string{"./..."}, ""},
+		{root, []string{"./a", "./a/..."}, ""},
+		{filepath.Join(root, "a"), []string{"..."}, "must be relative"},
+		{filepath.Join(root, "a"), []string{"../..."}, ""},
+		{root, []string{"../..."}, "outside the allowed roots"},
+		{root, []string{"./a..."}, ""},
+		{root, []string{"example.com/m/..."}, "must be relative"},
+		{root, []string{"std"}, "must be relative"},
+	}
+
+	for _, tt := range tests {
+		err := checkTestPatterns(ctx, tt.dir, tt.patterns)
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("checkTestPatterns(%s, %q) error = %v, want %q", tt.dir, tt.patterns, err, tt.wantErr)
+		}
+	}
+}
+
+func TestGoTestPackages(t *testing.T) {
+	root := writeModule(t, map[string]string{
+		"a/a_test.go": "package a\n\nimport \"testing\"\n\nfunc TestA(t *testing.T) {}\n",
+		"b/b_test.go": "package b\n\nimport \"testing\"\n\nfunc TestB(t *testing.T) { t.Error(\"broken\") }\n",
+	})
+
+	result, err := goTest(context.Background(), root, []string{"./..."}, nil, time.Minute)
+	if err != nil {
+		t.Fatalf("goTest() error = %v", err)
+	}
+	if result.Passed || result.ExitCode == 0 {
+		t.Errorf("goTest() passed with a failing test: %+v", result)
+	}
+
+	statuses := make(map[string]string)
+	for _, pkg := range result.Packages {
+		statuses[pkg.Package] = pkg.Status
+	}
+	want := map[string]string{"example.com/m/a": "pass", "example.com/m/b": "fail"}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("packages = %v, want %v", statuses, want)
+	}
+	if f := result.FirstFailure; f == nil || f.File != filepath.Join(root, "b", "b_test.go") || f.Line != 5 {
+		t.Errorf("FirstFailure = %+v, want b_test.go:5", f)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+)
+
+type DefinitionInfo struct {
+	Name        string    `json:"name"`
+	Kind        string    `json:"kind"`
+	Object      string    `json:"object"`
+	Package     string    `json:"package,omitempty"`
+	PackagePath string    `json:"package_path,omitempty"`
+	Position    *Position `json:"position,omitempty"`
+}
+
+type HoverInfo struct {
+	DefinitionInfo
+	Type      string `json:"type,omitempty"`
+	Signature string `json:"signature"`
+	Doc       string `json:"doc,omitempty"`
+}
+
+func gotoDefinition(ctx context.Context, file string, line, column int) (*DefinitionInfo, error) {
+	obj, pkg, index, err := objectAt(ctx, file, line, column)
+	if err != nil {
+		return nil, err
+	}
+
+	def := definitionOf(obj, pkg.Fset, index)
+	return &def, nil
+}
+
+func hover(ctx context.Context, file string, line, column int) (*HoverInfo, error) {
+	obj, pkg, index, err := objectAt(ctx, file, line, column)
+	if err != nil {
+		return nil, err
+	}
+
+	qualifier := packageNameQualifier(pkg.Types)
+	info := &HoverInfo{
+		DefinitionInfo: definitionOf(obj, pkg.Fset, index),
+		Signature:      types.ObjectString(obj, qualifier),
+	}
+
+	switch o := obj.(type) {
+	case *types.PkgName:
+		if imported := index[o.Imported()]; imported != nil {
+			info.Doc = packageSynopsis(imported)
+		}
+	case *types.TypeName:
+		info.Type = types.TypeString(o.Type().Underlying(), qualifier)
+		info.Doc = declarationDoc(obj, index)
+	default:
+		if obj.Type() != nil {
+			info.Type = types.TypeString(obj.Type(), qualifier)
+		}
+		info.Doc = declarationDoc(obj, index)
+	}
+
+	return info, nil
+}
+
+// objectAt resolves the identifier at file:line:column in the workspace
+// containing file
+func objectAt(ctx context.Context, file string, line, column int) (types.Object, *packages.Package, map[*types.Package]*packages.Package, error) {
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to resolve %s: %w", file, err)
+	}
+
+	pkgs, _, err := loadModulePackages(ctx, filepath.Dir(absFile))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	ident, pkg, err := identAtPosition(pkgs, absFile, line, column)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	obj := identObject(pkg.TypesInfo, ident)
+	if obj == nil {
+		return nil, nil, nil, fmt.Errorf("identifier %s does not refer to an object", ident.Name)
+	}
+
+	return obj, pkg, packageIndex(pkgs), nil
+}
+
+func definitionOf(obj types.Object, fset *token.FileSet, index map[*types.Package]*packages.Package) DefinitionInfo {
+	def := DefinitionInfo{
+		Name:   obj.Name(),
+		Kind:   objectKind(obj),
+		Object: qualifiedName(obj),
+	}
+
+	if pkgName, ok := obj.(*types.PkgName); ok {
+		imported := pkgName.Imported()
+		def.Object = imported.Path()
+		def.Package = imported.Name()
+		def.PackagePath = imported.Path()
+		if pkg := index[imported]; pkg != nil && len(pkg.Syntax) > 0 {
+			pos := newPosition(pkg.Fset.Position(packageClause(pkg).Name.Pos()))
+			def.Position = &pos
+		}
+		return def
+	}
+
+	if obj.Pkg() != nil {
+		def.Package = obj.Pkg().Name()
+		def.PackagePath = obj.Pkg().Path()
+	}
+	if obj.Pos().IsValid() {
+		pos := newPosition(fset.Position(obj.Pos()))
+		def.Position = &pos
+	}
+
+	return def
+}
+
+func objectKind(obj types.Object) string {
+	switch o := obj.(type) {
+	case *types.Func:
+		if o.Signature().Recv() != nil {
+			return "method"
+		}
+		return "function"
+	case *types.TypeName:
+		if types.IsInterface(o.Type()) {
+			return "interface"
+		}
+		if _, ok := o.Type().Underlying().(*types.Struct); ok {
+			return "struct"
+		}
+		return "type"
+	case *types.Var:
+		if o.IsField() {
+			return "field"
+		}
+		return "variable"
+	case *types.Const:
+		return "constant"
+	case *types.PkgName:
+		return "package"
+	case *types.Label:
+		return "label"
+	case *types.Builtin:
+		return "builtin"
+	case *types.Nil:
+		return "nil"
+	}
+	return "unknown"
+}
+
+// declarationDoc returns the doc comment attached to the declaration of obj,
+// searching dependency sources as well as the workspace
+func declarationDoc(obj types.Object, index map[*types.Package]*packages.Package) string {
+	pkg := index[obj.Pkg()]
+	if pkg == nil || !obj.Pos().IsValid() {
+		return ""
+	}
+
+	file := fileForPos(pkg, obj.Pos())
+	if file == nil {
+		return ""
+	}
+
+	path, _ := astutil.PathEnclosingInterval(file, obj.Pos(), obj.Pos())
+	for _, n := range path {
+		switch node := n.(type) {
+		case *ast.FuncDecl:
+			return strings.TrimSpace(node.Doc.Text())
+		case *ast.Field:
+			if node.Doc != nil {
+				return strings.TrimSpace(node.Doc.Text())
+			}
+			return strings.TrimSpace(node.Comment.Text())
+		case *ast.TypeSpec:
+			if node.Doc != nil {
+				return strings.TrimSpace(node.Doc.Text())
+			}
+		case *ast.ValueSpec:
+			if node.Doc != nil {
+				return strings.TrimSpace(node.Doc.Text())
+			}
+			if node.Comment != nil {
+				return strings.TrimSpace(node.Comment.Text())
+			}
+		case *ast.GenDecl:
+			return strings.TrimSpace(node.Doc.Text())
+		}
+	}
+
+	return ""
+}
+
+// packageClause returns the file carrying the package doc comment, or the
+// first file when none does
+func packageClause(pkg *packages.Package) *ast.File {
+	for _, file := range pkg.Syntax {
+		if file.Doc != nil {
+			return file
+		}
+	}
+	return pkg.Syntax[0]
+}
+
+// packageSynopsis returns the first paragraph of the package doc comment
+func packageSynopsis(pkg *packages.Package) string {
+	if len(pkg.Syntax) == 0 {
+		return ""
+	}
+	text := strings.TrimSpace(packageClause(pkg).Doc.Text())
+	if idx := strings.Index(text, "\n\n"); idx >= 0 {
+		text = text[:idx]
+	}
+	return text
+}
+
+// packageNameQualifier prints other packages by name rather than full path
+func packageNameQualifier(current *types.Package) types.Qualifier {
+	return func(pkg *types.Package) string {
+		if pkg == current {
+			return ""
+		}
+		return pkg.Name()
+	}
+}
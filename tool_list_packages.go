@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/ast"
 	"go/token"
 	"path/filepath"
@@ -15,10 +16,10 @@ type Package struct {
 	Imports    []string `json:"imports"`
 }
 
-func listPackages(dir string, includeTests bool) ([]Package, error) {
+func listPackages(ctx context.Context, dir string, includeTests bool) ([]Package, error) {
 	packages := make(map[string]*Package)
 
-	err := walkGoFiles(dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+	err := walkGoFiles(ctx, dir, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
 		// Skip test files if not requested
 		if !includeTests && strings.HasSuffix(path, "_test.go") {
 			return nil
@@ -17,6 +17,8 @@ type WriteRangeResult struct {
 	LinesWritten int    `json:"lines_written"`
 	BytesWritten int    `json:"bytes_written"`
 	Message      string `json:"message,omitempty"`
+	DryRun       bool   `json:"dry_run,omitempty"`
+	Diff         string `json:"diff,omitempty"`
 }
 
 // Helper function to convert line/column positions to byte offsets
@@ -102,31 +104,43 @@ func lineColToByteRange(data []byte, startLine, endLine, startCol, endCol int) (
 	return startByte, endByte, nil
 }
 
-func readRange(file string, startLine, endLine, startCol, endCol, startByte, endByte int) (*ReadRangeResult, error) {
-	data, err := os.ReadFile(file)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
-	}
-
+// resolveRange converts line/column positions to a byte range when no byte
+// range is given, and checks the range against data
+func resolveRange(data []byte, startLine, endLine, startCol, endCol, startByte, endByte int) (int, int, error) {
+	var err error
 	// Convert line/column to byte range if needed
 	if startByte < 0 || endByte < 0 {
 		startByte, endByte, err = lineColToByteRange(data, startLine, endLine, startCol, endCol)
 		if err != nil {
-			return nil, err
+			return 0, 0, err
 		}
 	}
 
 	// Validate byte range
 	if startByte < 0 || startByte > len(data) {
-		return nil, fmt.Errorf("start byte %d out of range (file size: %d)", startByte, len(data))
+		return 0, 0, fmt.Errorf("start byte %d out of range (file size: %d)", startByte, len(data))
 	}
 	if endByte < startByte {
-		return nil, fmt.Errorf("end byte %d is before start byte %d", endByte, startByte)
+		return 0, 0, fmt.Errorf("end byte %d is before start byte %d", endByte, startByte)
 	}
 	if endByte > len(data) {
 		endByte = len(data)
 	}
 
+	return startByte, endByte, nil
+}
+
+func readRange(file string, startLine, endLine, startCol, endCol, startByte, endByte int) (*ReadRangeResult, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	startByte, endByte, err = resolveRange(data, startLine, endLine, startCol, endCol, startByte, endByte)
+	if err != nil {
+		return nil, err
+	}
+
 	// Extract content
 	content := string(data[startByte:endByte])
 	
@@ -137,29 +151,15 @@ func readRange(file string, startLine, endLine, startCol, endCol, startByte, end
 	}, nil
 }
 
-func writeRange(file string, content string, startLine, endLine, startCol, endCol, startByte, endByte int, confirmOld string) (*WriteRangeResult, error) {
+func writeRange(file string, content string, startLine, endLine, startCol, endCol, startByte, endByte int, confirmOld string, dryRun bool) (*WriteRangeResult, error) {
 	data, err := os.ReadFile(file)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
 
-	// Convert line/column to byte range if needed
-	if startByte < 0 || endByte < 0 {
-		startByte, endByte, err = lineColToByteRange(data, startLine, endLine, startCol, endCol)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	// Validate byte range
-	if startByte < 0 || startByte > len(data) {
-		return nil, fmt.Errorf("start byte %d out of range (file size: %d)", startByte, len(data))
-	}
-	if endByte < startByte {
-		return nil, fmt.Errorf("end byte %d is before start byte %d", endByte, startByte)
-	}
-	if endByte > len(data) {
-		endByte = len(data)
+	startByte, endByte, err = resolveRange(data, startLine, endLine, startCol, endCol, startByte, endByte)
+	if err != nil {
+		return nil, err
 	}
 
 	// Extract old content
@@ -179,16 +179,23 @@ func writeRange(file string, content string, startLine, endLine, startCol, endCo
 	newData = append(newData, []byte(content)...)
 	newData = append(newData, data[endByte:]...)
 
-	// Write the file
-	err = os.WriteFile(file, newData, 0644)
-	if err != nil {
-		return nil, fmt.Errorf("failed to write file: %w", err)
-	}
-
-	return &WriteRangeResult{
+	result := &WriteRangeResult{
 		Success:      true,
 		LinesWritten: strings.Count(content, "\n") + 1,
 		BytesWritten: len(content),
 		Message:      "Successfully written",
-	}, nil
+		DryRun:       dryRun,
+		Diff:         unifiedDiff(file, string(data), string(newData)),
+	}
+	if dryRun {
+		result.Message = "Dry run, file not written"
+		return result, nil
+	}
+
+	// Write the file, unless it changed since it was read
+	if err := writeFile(file, newData, data); err != nil {
+		return nil, fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return result, nil
 }
\ No newline at end of file
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"sort"
+
+	"golang.org/x/tools/go/packages"
+)
+
+type RenameResult struct {
+	Object     string       `json:"object"`
+	OldName    string       `json:"old_name"`
+	NewName    string       `json:"new_name"`
+	DryRun     bool         `json:"dry_run"`
+	Files      []RenameFile `json:"files"`
+	TotalEdits int          `json:"total_edits"`
+}
+
+type RenameFile struct {
+	File  string `json:"file"`
+	Edits int    `json:"edits"`
+	Diff  string `json:"diff"`
+}
+
+func renameSymbol(ctx context.Context, dir, file string, line, column int, symbol, newName string, dryRun bool) (*RenameResult, error) {
+	if !token.IsIdentifier(newName) || newName == "_" {
+		return nil, fmt.Errorf("%q is not a valid identifier", newName)
+	}
+
+	state, root, err := loadModule(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	pkgs := state.pkgs
+
+	target, err := resolveObject(pkgs, file, line, column, symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := pkgs[0].Fset
+	if err := checkRenameable(fset, root, target); err != nil {
+		return nil, err
+	}
+	if target.Name() == newName {
+		return nil, fmt.Errorf("%s is already named %s", qualifiedName(target), newName)
+	}
+
+	group, err := renameGroup(pkgs, root, target)
+	if err != nil {
+		return nil, err
+	}
+
+	edits, err := collectRenameEdits(pkgs, group, newName)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RenameResult{
+		Object:  qualifiedName(target),
+		OldName: target.Name(),
+		NewName: newName,
+		DryRun:  dryRun,
+		Files:   []RenameFile{},
+	}
+
+	overlay := make(map[string][]byte)
+	originals := make(map[string][]byte)
+	var paths []string
+	for path := range edits {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		// The offsets are into the source the packages were parsed from,
+		// which the file must still hold
+		src, ok := state.sources[path]
+		if !ok {
+			return nil, fmt.Errorf("%s was not loaded from source", path)
+		}
+		current, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if !bytes.Equal(current, src) {
+			return nil, fmt.Errorf("%s changed since it was loaded; try again", path)
+		}
+		updated, err := applyEdits(src, edits[path])
+		if err != nil {
+			return nil, fmt.Errorf("failed to rename in %s: %w", path, err)
+		}
+		overlay[path] = updated
+		originals[path] = src
+
+		result.Files = append(result.Files, RenameFile{
+			File:  path,
+			Edits: len(edits[path]),
+			Diff:  unifiedDiff(path, string(src), string(updated)),
+		})
+		result.TotalEdits += len(edits[path])
+	}
+
+	if err := verifyRename(ctx, root, pkgs, overlay); err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return result, nil
+	}
+
+	tx, err := newFileTransaction()
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		if err := tx.write(path, overlay[path], originals[path]); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.commit(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func checkRenameable(fset *token.FileSet, root string, obj types.Object) error {
+	switch obj.(type) {
+	case *types.PkgName:
+		return fmt.Errorf("renaming package imports is not supported")
+	case *types.Builtin, *types.Nil:
+		return fmt.Errorf("cannot rename builtin %s", obj.Name())
+	}
+	if obj.Pkg() == nil || !obj.Pos().IsValid() {
+		return fmt.Errorf("cannot rename predeclared %s", obj.Name())
+	}
+	if !isWithin(root, fset.Position(obj.Pos()).Filename) {
+		return fmt.Errorf("%s is declared outside the workspace", qualifiedName(obj))
+	}
+	return nil
+}
+
+// renameGroup returns every object that must be renamed together with
+// target, keyed by objectKey: embedded fields named after a renamed type and
+// methods linked to it through interface satisfaction within the workspace
+func renameGroup(pkgs []*packages.Package, root string, target types.Object) (map[string]types.Object, error) {
+	fset := pkgs[0].Fset
+	group := map[string]types.Object{objectKey(fset, target): target}
+
+	switch obj := target.(type) {
+	case *types.TypeName:
+		for _, pkg := range pkgs {
+			for _, def := range pkg.TypesInfo.Defs {
+				field, ok := def.(*types.Var)
+				if !ok || !field.Embedded() {
+					continue
+				}
+				if named, ok := derefType(field.Type()).(*types.Named); ok && objectKey(fset, named.Obj()) == objectKey(fset, obj) {
+					group[objectKey(fset, field)] = field
+				}
+			}
+		}
+
+	case *types.Func:
+		if obj.Signature().Recv() == nil {
+			break
+		}
+		if err := linkInterfaceMethods(pkgs, root, obj.Name(), group); err != nil {
+			return nil, err
+		}
+	}
+
+	return group, nil
+}
+
+// linkInterfaceMethods grows group until every interface method and concrete
+// method named name that satisfy one another are renamed together
+func linkInterfaceMethods(pkgs []*packages.Package, root string, name string, group map[string]types.Object) error {
+	fset := pkgs[0].Fset
+
+	var ifaces []*types.Named
+	var concrete []*types.Named
+	for _, pkg := range pkgs {
+		scope := pkg.Types.Scope()
+		for _, n := range scope.Names() {
+			typeName, ok := scope.Lookup(n).(*types.TypeName)
+			if !ok || typeName.IsAlias() {
+				continue
+			}
+			named, ok := typeName.Type().(*types.Named)
+			if !ok {
+				continue
+			}
+			if types.IsInterface(named) {
+				ifaces = append(ifaces, named)
+			} else {
+				concrete = append(concrete, named)
+			}
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, iface := range ifaces {
+			ifaceMethod, _, _ := types.LookupFieldOrMethod(iface, false, iface.Obj().Pkg(), name)
+			if ifaceMethod == nil {
+				continue
+			}
+			ifaceType := iface.Underlying().(*types.Interface)
+
+			for _, t := range concrete {
+				if !types.Implements(t, ifaceType) && !types.Implements(types.NewPointer(t), ifaceType) {
+					continue
+				}
+				method, _, _ := types.LookupFieldOrMethod(t, true, t.Obj().Pkg(), name)
+				if method == nil {
+					continue
+				}
+
+				_, ifaceIn := group[objectKey(fset, ifaceMethod)]
+				_, methodIn := group[objectKey(fset, method)]
+				if ifaceIn == methodIn {
+					continue
+				}
+
+				for _, obj := range []types.Object{ifaceMethod, method} {
+					if !isWithin(root, fset.Position(obj.Pos()).Filename) {
+						return fmt.Errorf("%s must also be renamed but is declared outside the workspace", qualifiedName(obj))
+					}
+					group[objectKey(fset, obj)] = obj
+				}
+				changed = true
+			}
+		}
+	}
+
+	return nil
+}
+
+func derefType(t types.Type) types.Type {
+	if ptr, ok := t.(*types.Pointer); ok {
+		return ptr.Elem()
+	}
+	return t
+}
+
+// collectRenameEdits finds every declaration and use of the group, rejecting
+// renames that would be captured by or shadow another declaration
+func collectRenameEdits(pkgs []*packages.Package, group map[string]types.Object, newName string) (map[string][]textEdit, error) {
+	edits := make(map[string][]textEdit)
+	seen := make(map[token.Pos]bool)
+
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Syntax {
+			selectors := make(map[*ast.Ident]bool)
+			var inspectErr error
+
+			ast.Inspect(file, func(n ast.Node) bool {
+				if inspectErr != nil {
+					return false
+				}
+				switch node := n.(type) {
+				case *ast.SelectorExpr:
+					selectors[node.Sel] = true
+				case *ast.Ident:
+					obj, ok := renamedObject(pkg.TypesInfo, node, pkg.Fset, group)
+					if !ok || seen[node.Pos()] {
+						return true
+					}
+					seen[node.Pos()] = true
+
+					if !selectors[node] {
+						if err := checkShadowing(pkg, node, obj, newName); err != nil {
+							inspectErr = err
+							return false
+						}
+					}
+
+					pos := pkg.Fset.Position(node.Pos())
+					edits[pos.Filename] = append(edits[pos.Filename], textEdit{
+						start: pos.Offset,
+						end:   pos.Offset + len(node.Name),
+						text:  newName,
+					})
+				}
+				return true
+			})
+
+			if inspectErr != nil {
+				return nil, inspectErr
+			}
+		}
+	}
+
+	return edits, nil
+}
+
+func renamedObject(info *types.Info, ident *ast.Ident, fset *token.FileSet, group map[string]types.Object) (types.Object, bool) {
+	for _, obj := range []types.Object{info.Defs[ident], info.Uses[ident]} {
+		if obj == nil {
+			continue
+		}
+		if _, ok := group[objectKey(fset, obj)]; ok {
+			return obj, true
+		}
+	}
+	return nil, false
+}
+
+// checkShadowing rejects a rename when newName already resolves to a
+// different object at ident, or is already declared alongside obj
+func checkShadowing(pkg *packages.Package, ident *ast.Ident, obj types.Object, newName string) error {
+	if field, ok := obj.(*types.Var); ok && field.IsField() {
+		return nil
+	}
+	if fn, ok := obj.(*types.Func); ok && fn.Signature().Recv() != nil {
+		return nil
+	}
+
+	if parent := obj.Parent(); parent != nil {
+		if existing := parent.Lookup(newName); existing != nil {
+			pos := pkg.Fset.Position(existing.Pos())
+			return fmt.Errorf("renaming %s to %s conflicts with declaration at %s", obj.Name(), newName, pos)
+		}
+	}
+
+	scope := pkg.Types.Scope().Innermost(ident.Pos())
+	if scope == nil {
+		return nil
+	}
+	if _, existing := scope.LookupParent(newName, ident.Pos()); existing != nil {
+		pos := pkg.Fset.Position(ident.Pos())
+		return fmt.Errorf("renaming %s to %s at %s would refer to %s instead", obj.Name(), newName, pos, qualifiedName(existing))
+	}
+	return nil
+}
+
+// verifyRename type-checks the renamed sources and rejects the rename if it
+// introduces errors that were not already present
+func verifyRename(ctx context.Context, root string, before []*packages.Package, overlay map[string][]byte) error {
+	after, _, err := loadWorkspace(ctx, root, overlay)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]bool)
+	for _, pkg := range before {
+		for _, e := range pkg.Errors {
+			existing[e.Msg] = true
+		}
+	}
+
+	var introduced []string
+	for _, pkg := range after {
+		for _, e := range pkg.Errors {
+			if !existing[e.Msg] {
+				introduced = append(introduced, e.Error())
+			}
+		}
+	}
+
+	if len(introduced) > 0 {
+		sort.Strings(introduced)
+		return fmt.Errorf("rename would introduce errors: %v", introduced)
+	}
+	return nil
+}
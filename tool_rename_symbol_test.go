@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenameSymbol(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		symbol  string
+		newName string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "interface-linked methods",
+			src: `package a
+
+type Shape interface{ Area() int }
+
+type Square struct{}
+
+func (Square) Area() int { return 1 }
+
+func Total(s Shape) int { return s.Area() + Square{}.Area() }
+`,
+			symbol:  "Square.Area",
+			newName: "Size",
+			want: `package a
+
+type Shape interface{ Size() int }
+
+type Square struct{}
+
+func (Square) Size() int { return 1 }
+
+func Total(s Shape) int { return s.Size() + Square{}.Size() }
+`,
+		},
+		{
+			name: "interface method renames its implementations",
+			src: `package a
+
+type Shape interface{ Area() int }
+
+type Square struct{}
+
+func (*Square) Area() int { return 1 }
+
+var _ Shape = &Square{}
+`,
+			symbol:  "Shape.Area",
+			newName: "Size",
+			want: `package a
+
+type Shape interface{ Size() int }
+
+type Square struct{}
+
+func (*Square) Size() int { return 1 }
+
+var _ Shape = &Square{}
+`,
+		},
+		{
+			name: "embedded field follows its type",
+			src: `package a
+
+type Base struct{}
+
+type T struct{ Base }
+
+func Get(t T) Base { return t.Base }
+`,
+			symbol:  "a.Base",
+			newName: "Core",
+			want: `package a
+
+type Core struct{}
+
+type T struct{ Core }
+
+func Get(t T) Core { return t.Core }
+`,
+		},
+		{
+			name:    "conflicting declaration",
+			src:     "package a\n\nfunc A() {}\n\nfunc B() {}\n",
+			symbol:  "A",
+			newName: "B",
+			wantErr: "conflicts with declaration",
+		},
+		{
+			name:    "captured by a local",
+			src:     "package a\n\nvar x = 1\n\nfunc F() int {\n\ty := 2\n\treturn x + y\n}\n",
+			symbol:  "x",
+			newName: "y",
+			wantErr: "would refer to",
+		},
+		{
+			name:    "invalid identifier",
+			src:     "package a\n\nfunc A() {}\n",
+			symbol:  "A",
+			newName: "1A",
+			wantErr: "not a valid identifier",
+		},
+		{
+			name:    "same name",
+			src:     "package a\n\nfunc A() {}\n",
+			symbol:  "A",
+			newName: "A",
+			wantErr: "already named",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writeModule(t, map[string]string{"a.go": tt.src})
+			path := filepath.Join(root, "a.go")
+
+			result, err := renameSymbol(context.Background(), root, "", 0, 0, tt.symbol, tt.newName, false)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("renameSymbol() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				if got, _ := os.ReadFile(path); string(got) != tt.src {
+					t.Errorf("failed rename changed the file to\n%s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("renameSymbol() error = %v", err)
+			}
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("renamed file =\n%s\nwant\n%s", got, tt.want)
+			}
+			if result.TotalEdits != strings.Count(tt.want, tt.newName) {
+				t.Errorf("TotalEdits = %d, want %d", result.TotalEdits, strings.Count(tt.want, tt.newName))
+			}
+		})
+	}
+}
+
+func TestRenameSymbolDryRun(t *testing.T) {
+	src := "package a\n\nfunc A() {}\n\nvar _ = A\n"
+	root := writeModule(t, map[string]string{"a.go": src})
+	path := filepath.Join(root, "a.go")
+
+	result, err := renameSymbol(context.Background(), root, "", 0, 0, "A", "B", true)
+	if err != nil {
+		t.Fatalf("renameSymbol() error = %v", err)
+	}
+	if len(result.Files) != 1 || !strings.Contains(result.Files[0].Diff, "+var _ = B") {
+		t.Errorf("dry run files = %+v, want a diff renaming the use", result.Files)
+	}
+	if got, _ := os.ReadFile(path); string(got) != src {
+		t.Errorf("dry run changed the file to\n%s", got)
+	}
+}
+
+// Edits are computed against the loaded source; a file that no longer
+// holds it must not be rewritten at those offsets
+func TestRenameSymbolChangedFile(t *testing.T) {
+	src := "package a\n\nfunc A() {}\n\nvar _ = A\n"
+	root := writeModule(t, map[string]string{"a.go": src})
+	path := filepath.Join(root, "a.go")
+
+	if _, err := renameSymbol(context.Background(), root, "", 0, 0, "A", "B", true); err != nil {
+		t.Fatalf("renameSymbol() error = %v", err)
+	}
+
+	// Same size and mtime, so the cached load still looks current
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := strings.Replace(src, "var _ = A", "var _ =A ", 1)
+	if err := os.WriteFile(path, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = renameSymbol(context.Background(), root, "", 0, 0, "A", "B", false)
+	if err == nil || !strings.Contains(err.Error(), "changed since it was loaded") {
+		t.Fatalf("renameSymbol() error = %v, want the file reported as changed", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != edited {
+		t.Errorf("file was rewritten to\n%s", got)
+	}
+}
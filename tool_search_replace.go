@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"os"
@@ -13,6 +14,7 @@ type SearchReplaceResult struct {
 	Files       []FileSearchReplaceResult `json:"files"`
 	TotalMatches int                      `json:"total_matches"`
 	TotalReplaced int                     `json:"total_replaced,omitempty"`
+	DryRun       bool                     `json:"dry_run,omitempty"`
 }
 
 type FileSearchReplaceResult struct {
@@ -20,6 +22,7 @@ type FileSearchReplaceResult struct {
 	Matches      []SearchMatch       `json:"matches,omitempty"`
 	Replaced     int                 `json:"replaced,omitempty"`
 	Error        string              `json:"error,omitempty"`
+	Diff         string              `json:"diff,omitempty"`
 }
 
 type SearchMatch struct {
@@ -35,9 +38,10 @@ type SearchMatch struct {
 	EndByte    int    `json:"end_byte"`
 }
 
-func searchReplace(paths []string, pattern string, replacement *string, useRegex, caseInsensitive bool, includeContext bool, beforePattern, afterPattern string, replaceAll bool) (*SearchReplaceResult, error) {
+func searchReplace(ctx context.Context, paths []string, pattern string, replacement *string, useRegex, caseInsensitive bool, includeContext bool, beforePattern, afterPattern string, replaceAll bool, dryRun bool) (*SearchReplaceResult, error) {
 	result := &SearchReplaceResult{
-		Files: []FileSearchReplaceResult{},
+		Files:  []FileSearchReplaceResult{},
+		DryRun: dryRun,
 	}
 
 	// Prepare search/replace function
@@ -192,6 +196,10 @@ func searchReplace(paths []string, pattern string, replacement *string, useRegex
 	}
 
 	for _, path := range paths {
+		if ctx.Err() != nil {
+			break
+		}
+
 		info, err := os.Stat(path)
 		if err != nil {
 			result.Files = append(result.Files, FileSearchReplaceResult{
@@ -204,16 +212,24 @@ func searchReplace(paths []string, pattern string, replacement *string, useRegex
 		if info.IsDir() {
 			// Process directory tree
 			err := filepath.WalkDir(path, func(filePath string, d fs.DirEntry, err error) error {
+				if ctx.Err() != nil {
+					return filepath.SkipAll
+				}
 				if err != nil || d.IsDir() {
 					return nil
 				}
+
+				// Don't follow symlinks out of the tree being replaced in
+				if d.Type()&fs.ModeSymlink != 0 {
+					return nil
+				}
 				
 				// Skip non-text files
 				if !isTextFile(filePath) {
 					return nil
 				}
 
-				fileResult := processFile(filePath, searchFunc, replaceFunc, includeContext, replaceAll)
+				fileResult := processFile(filePath, searchFunc, replaceFunc, includeContext, replaceAll, dryRun)
 				if len(fileResult.Matches) > 0 || fileResult.Replaced > 0 || fileResult.Error != "" {
 					result.Files = append(result.Files, fileResult)
 					result.TotalMatches += len(fileResult.Matches)
@@ -226,7 +242,7 @@ func searchReplace(paths []string, pattern string, replacement *string, useRegex
 			}
 		} else {
 			// Process single file
-			fileResult := processFile(path, searchFunc, replaceFunc, includeContext, replaceAll)
+			fileResult := processFile(path, searchFunc, replaceFunc, includeContext, replaceAll, dryRun)
 			if len(fileResult.Matches) > 0 || fileResult.Replaced > 0 || fileResult.Error != "" {
 				result.Files = append(result.Files, fileResult)
 				result.TotalMatches += len(fileResult.Matches)
@@ -239,7 +255,7 @@ func searchReplace(paths []string, pattern string, replacement *string, useRegex
 }
 
 
-func processFile(path string, searchFunc func(string) [][]int, replaceFunc func(string) string, includeContext bool, replaceAll bool) FileSearchReplaceResult {
+func processFile(path string, searchFunc func(string) [][]int, replaceFunc func(string) string, includeContext bool, replaceAll bool, dryRun bool) FileSearchReplaceResult {
 	result := FileSearchReplaceResult{
 		Path: path,
 	}
@@ -267,8 +283,11 @@ func processFile(path string, searchFunc func(string) [][]int, replaceFunc func(
 		
 		if result.Replaced > 0 {
 			newContent := replaceFunc(content)
-			err = os.WriteFile(path, []byte(newContent), 0644)
-			if err != nil {
+			result.Diff = unifiedDiff(path, content, newContent)
+			if dryRun {
+				return result
+			}
+			if err := writeFile(path, []byte(newContent), data); err != nil {
 				result.Error = fmt.Sprintf("write error: %v", err)
 				result.Replaced = 0
 			}
@@ -0,0 +1,600 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Metavariables are rewritten to identifiers with these prefixes so that
+// patterns parse as ordinary Go
+const (
+	metavarPrefix     = "gocp_mv_"
+	listMetavarPrefix = "gocp_mvs_"
+)
+
+var metavarPattern = regexp.MustCompile(`\$(\*?)([A-Za-z_][A-Za-z0-9_]*)`)
+
+type StructuralReplaceResult struct {
+	Pattern      string                 `json:"pattern"`
+	Replacement  string                 `json:"replacement,omitempty"`
+	DryRun       bool                   `json:"dry_run"`
+	Files        []StructuralFileResult `json:"files"`
+	TotalMatches int                    `json:"total_matches"`
+}
+
+type StructuralFileResult struct {
+	File    string            `json:"file"`
+	Matches []StructuralMatch `json:"matches"`
+	Diff    string            `json:"diff,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+type StructuralMatch struct {
+	Text        string            `json:"text"`
+	Replacement string            `json:"replacement,omitempty"`
+	Bindings    map[string]string `json:"bindings,omitempty"`
+	Position    Position          `json:"position"`
+}
+
+// structPattern is a parsed pattern: a single expression or a sequence of
+// statements
+type structPattern struct {
+	expr  ast.Expr
+	stmts []ast.Stmt
+	names map[string]bool
+}
+
+// structMatcher matches a pattern against the syntax of one file, binding
+// $name metavariables to nodes and $*name to lists of nodes
+type structMatcher struct {
+	pkg         *packages.Package
+	constraints map[string]string
+	bindings    map[string]any
+}
+
+// structuralReplace finds code matching pattern in the Go files under dir
+// and, when replacement is set, rewrites each match from the template.
+// Per-file diffs are returned; files are written unless dryRun is set, and
+// only if every file could be rewritten.
+func structuralReplace(ctx context.Context, dir, pattern string, replacement *string, constraints map[string]string, dryRun bool) (*StructuralReplaceResult, error) {
+	pat, err := parseStructPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	for name := range constraints {
+		if !pat.names[name] {
+			return nil, fmt.Errorf("constraint on $%s, which the pattern does not use", name)
+		}
+	}
+	if replacement != nil {
+		for _, m := range metavarPattern.FindAllStringSubmatch(*replacement, -1) {
+			if !pat.names[m[2]] || m[2] == "_" {
+				return nil, fmt.Errorf("replacement uses $%s, which the pattern does not bind", m[2])
+			}
+		}
+	}
+
+	result := &StructuralReplaceResult{
+		Pattern: pattern,
+		DryRun:  dryRun,
+		Files:   []StructuralFileResult{},
+	}
+	if replacement != nil {
+		result.Replacement = *replacement
+	}
+
+	tx, err := newFileTransaction()
+	if err != nil {
+		return nil, err
+	}
+
+	err = walkTypedFiles(ctx, dir, func(path string, src []byte, file *ast.File, pkg *packages.Package) error {
+		m := &structMatcher{pkg: pkg, constraints: constraints}
+		fileResult := StructuralFileResult{File: path, Matches: []StructuralMatch{}}
+		var edits []textEdit
+
+		m.find(pat, file, func(start, end token.Pos) {
+			startPos := pkg.Fset.Position(start)
+			from, to := startPos.Offset, pkg.Fset.Position(end).Offset
+
+			match := StructuralMatch{
+				Text:     string(src[from:to]),
+				Bindings: m.bindingText(src),
+				Position: newPosition(startPos),
+			}
+			if replacement != nil {
+				match.Replacement = m.expand(*replacement, src, lineIndent(src, from))
+				edits = append(edits, textEdit{start: from, end: to, text: match.Replacement})
+			}
+			fileResult.Matches = append(fileResult.Matches, match)
+		})
+
+		if len(fileResult.Matches) == 0 {
+			return nil
+		}
+		result.TotalMatches += len(fileResult.Matches)
+
+		if replacement != nil {
+			updated, err := rewriteSource(path, src, edits)
+			if err != nil {
+				fileResult.Error = err.Error()
+			} else {
+				fileResult.Diff = unifiedDiff(path, string(src), string(updated))
+				if fileResult.Diff != "" {
+					if err := tx.write(path, updated, src); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		result.Files = append(result.Files, fileResult)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(result.Files, func(i, j int) bool {
+		return result.Files[i].File < result.Files[j].File
+	})
+
+	if dryRun {
+		return result, nil
+	}
+
+	// A cancelled walk saw only some of the files, and a rewrite that
+	// failed in one file leaves the others inconsistent with it; replace in
+	// none of them
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var failed []string
+	for _, fileResult := range result.Files {
+		if fileResult.Error != "" {
+			failed = append(failed, fmt.Sprintf("%s: %s", fileResult.File, fileResult.Error))
+		}
+	}
+	if len(failed) > 0 {
+		return nil, fmt.Errorf("no files written, as %d could not be rewritten: %s", len(failed), strings.Join(failed, "; "))
+	}
+	if err := tx.commit(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// parseStructPattern parses pattern as an expression or, failing that, as
+// a list of statements
+func parseStructPattern(pattern string) (*structPattern, error) {
+	pat := &structPattern{names: make(map[string]bool)}
+	for _, m := range metavarPattern.FindAllStringSubmatch(pattern, -1) {
+		pat.names[m[2]] = true
+	}
+
+	source := metavarPattern.ReplaceAllStringFunc(pattern, func(s string) string {
+		m := metavarPattern.FindStringSubmatch(s)
+		if m[1] == "*" {
+			return listMetavarPrefix + m[2]
+		}
+		return metavarPrefix + m[2]
+	})
+
+	if expr, err := parser.ParseExpr(source); err == nil {
+		pat.expr = expr
+		return pat, nil
+	}
+
+	file, err := parser.ParseFile(token.NewFileSet(), "pattern.go", "package p; func _() {\n"+source+"\n}", 0)
+	if err != nil {
+		return nil, fmt.Errorf("pattern is not a Go expression or statement list: %w", err)
+	}
+	pat.stmts = file.Decls[0].(*ast.FuncDecl).Body.List
+	if len(pat.stmts) == 0 {
+		return nil, fmt.Errorf("empty pattern")
+	}
+	return pat, nil
+}
+
+// find calls report with the extent of each non-overlapping match in file,
+// leaving the bindings of that match in m
+func (m *structMatcher) find(pat *structPattern, file *ast.File, report func(start, end token.Pos)) {
+	if pat.expr != nil {
+		ast.Inspect(file, func(n ast.Node) bool {
+			expr, ok := n.(ast.Expr)
+			if !ok {
+				return true
+			}
+			m.bindings = make(map[string]any)
+			if m.matchNode(pat.expr, expr) {
+				report(expr.Pos(), expr.End())
+				return false
+			}
+			return true
+		})
+		return
+	}
+
+	patNodes := stmtNodes(pat.stmts)
+	var matched [][2]token.Pos
+	ast.Inspect(file, func(n ast.Node) bool {
+		// Blocks nested in a match would give overlapping edits
+		for _, r := range matched {
+			if n != nil && n.Pos() >= r[0] && n.End() <= r[1] {
+				return false
+			}
+		}
+
+		var list []ast.Stmt
+		switch x := n.(type) {
+		case *ast.BlockStmt:
+			list = x.List
+		case *ast.CaseClause:
+			list = x.Body
+		case *ast.CommClause:
+			list = x.Body
+		default:
+			return true
+		}
+
+		nodes := stmtNodes(list)
+		for i := 0; i < len(nodes); {
+			end := -1
+			// Shortest window first, so $* lists stop at the first match of
+			// what follows them
+			for j := i + 1; j <= len(nodes); j++ {
+				m.bindings = make(map[string]any)
+				if m.matchList(patNodes, nodes[i:j]) {
+					end = j
+					break
+				}
+			}
+			if end < 0 {
+				i++
+				continue
+			}
+			report(nodes[i].Pos(), nodes[end-1].End())
+			matched = append(matched, [2]token.Pos{nodes[i].Pos(), nodes[end-1].End()})
+			i = end
+		}
+		return true
+	})
+}
+
+func (m *structMatcher) matchNode(p, n ast.Node) bool {
+	if isNilNode(p) || isNilNode(n) {
+		return isNilNode(p) && isNilNode(n)
+	}
+
+	if name, ok := metavarName(p, metavarPrefix); ok {
+		return m.bind(name, n)
+	}
+	// A metavariable statement matches any statement
+	if stmt, ok := p.(*ast.ExprStmt); ok {
+		if name, ok := metavarName(stmt.X, metavarPrefix); ok {
+			if _, ok := n.(ast.Stmt); ok {
+				return m.bind(name, n)
+			}
+		}
+	}
+
+	pv, nv := reflect.ValueOf(p), reflect.ValueOf(n)
+	if pv.Type() != nv.Type() {
+		return false
+	}
+	return m.matchFields(pv.Elem(), nv.Elem())
+}
+
+var (
+	nodeType         = reflect.TypeOf((*ast.Node)(nil)).Elem()
+	posType          = reflect.TypeOf(token.NoPos)
+	objectType       = reflect.TypeOf((*ast.Object)(nil))
+	scopeType        = reflect.TypeOf((*ast.Scope)(nil))
+	commentGroupType = reflect.TypeOf((*ast.CommentGroup)(nil))
+)
+
+// matchFields compares the fields of two syntax nodes of the same type,
+// ignoring positions, comments and resolver objects
+func (m *structMatcher) matchFields(p, n reflect.Value) bool {
+	for i := 0; i < p.NumField(); i++ {
+		pf, nf := p.Field(i), n.Field(i)
+		switch t := pf.Type(); {
+		case t == posType || t == objectType || t == scopeType || t == commentGroupType:
+			continue
+
+		case t.Implements(nodeType):
+			pn, _ := pf.Interface().(ast.Node)
+			nn, _ := nf.Interface().(ast.Node)
+			if !m.matchNode(pn, nn) {
+				return false
+			}
+
+		case t.Kind() == reflect.Slice && t.Elem().Implements(nodeType):
+			if !m.matchList(sliceNodes(pf), sliceNodes(nf)) {
+				return false
+			}
+
+		default:
+			if pf.Interface() != nf.Interface() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matchList matches a pattern list, in which $*name elements consume any
+// number of nodes, against ns in its entirety
+func (m *structMatcher) matchList(ps, ns []ast.Node) bool {
+	if len(ps) == 0 {
+		return len(ns) == 0
+	}
+
+	saved := m.save()
+	if name, ok := listMetavarName(ps[0]); ok {
+		for k := 0; k <= len(ns); k++ {
+			if m.bind(name, ns[:k]) && m.matchList(ps[1:], ns[k:]) {
+				return true
+			}
+			m.bindings = saved
+			saved = m.save()
+		}
+		return false
+	}
+
+	if len(ns) > 0 && m.matchNode(ps[0], ns[0]) && m.matchList(ps[1:], ns[1:]) {
+		return true
+	}
+	m.bindings = saved
+	return false
+}
+
+func (m *structMatcher) save() map[string]any {
+	saved := make(map[string]any, len(m.bindings))
+	for k, v := range m.bindings {
+		saved[k] = v
+	}
+	return saved
+}
+
+// bind records value for name, or checks it against an earlier binding;
+// the same metavariable must match the same code each time
+func (m *structMatcher) bind(name string, value any) bool {
+	if name == "_" {
+		return true
+	}
+
+	if bound, ok := m.bindings[name]; ok {
+		plain := &structMatcher{}
+		switch bound := bound.(type) {
+		case ast.Node:
+			n, ok := value.(ast.Node)
+			return ok && plain.matchNode(bound, n)
+		case []ast.Node:
+			n, ok := value.([]ast.Node)
+			return ok && plain.matchList(bound, n)
+		}
+		return false
+	}
+
+	if constraint, ok := m.constraints[name]; ok {
+		expr, ok := value.(ast.Expr)
+		if !ok || !m.satisfies(expr, constraint) {
+			return false
+		}
+	}
+
+	m.bindings[name] = value
+	return true
+}
+
+// satisfies reports whether the type of expr is identical to the
+// constraint, or it or its pointer implements it when the constraint is an
+// interface. The
+// constraint is resolved in the scope of expr, so it may use the file's
+// import names.
+func (m *structMatcher) satisfies(expr ast.Expr, constraint string) bool {
+	if m.pkg == nil || m.pkg.TypesInfo == nil {
+		return false
+	}
+	t := m.pkg.TypesInfo.TypeOf(expr)
+	if t == nil {
+		return false
+	}
+
+	tv, err := types.Eval(m.pkg.Fset, m.pkg.Types, expr.Pos(), constraint)
+	if err != nil || !tv.IsType() {
+		// Not resolvable here, e.g. a package this file does not import
+		return types.TypeString(t, func(p *types.Package) string { return p.Name() }) == constraint ||
+			types.TypeString(t, nil) == constraint
+	}
+
+	if types.Identical(t, tv.Type) {
+		return true
+	}
+	if iface, ok := tv.Type.Underlying().(*types.Interface); ok {
+		// Method calls take the address of variables implicitly
+		return types.Implements(t, iface) || types.Implements(types.NewPointer(t), iface)
+	}
+	return false
+}
+
+// bindingText renders the current bindings as source text
+func (m *structMatcher) bindingText(src []byte) map[string]string {
+	if len(m.bindings) == 0 {
+		return nil
+	}
+	text := make(map[string]string, len(m.bindings))
+	for name, value := range m.bindings {
+		text[name] = m.source(src, value)
+	}
+	return text
+}
+
+func (m *structMatcher) source(src []byte, value any) string {
+	var start, end token.Pos
+	switch v := value.(type) {
+	case ast.Node:
+		start, end = v.Pos(), v.End()
+	case []ast.Node:
+		if len(v) == 0 {
+			return ""
+		}
+		start, end = v[0].Pos(), v[len(v)-1].End()
+	}
+	return string(src[m.pkg.Fset.Position(start).Offset:m.pkg.Fset.Position(end).Offset])
+}
+
+// expand fills the replacement template with the bound source text,
+// indenting continuation lines to match the replaced code. An empty list
+// takes the comma separating it from its neighbours with it, so that
+// f($a, $*rest) expands to f(a) rather than f(a, ).
+func (m *structMatcher) expand(template string, src []byte, indent string) string {
+	template = strings.ReplaceAll(template, "\n", "\n"+indent)
+
+	var b strings.Builder
+	last := 0
+	for _, loc := range metavarPattern.FindAllStringSubmatchIndex(template, -1) {
+		b.WriteString(template[last:loc[0]])
+		last = loc[1]
+
+		text := m.source(src, m.bindings[template[loc[4]:loc[5]]])
+		if text != "" || loc[3] == loc[2] {
+			b.WriteString(text)
+			continue
+		}
+		before := strings.TrimRight(b.String(), " \t")
+		if strings.HasSuffix(before, ",") {
+			b.Reset()
+			b.WriteString(strings.TrimSuffix(before, ","))
+			continue
+		}
+		if rest := strings.TrimLeft(template[last:], " \t"); strings.HasPrefix(rest, ",") {
+			last = len(template) - len(strings.TrimLeft(rest[1:], " \t"))
+		}
+	}
+	b.WriteString(template[last:])
+	return b.String()
+}
+
+// rewriteSource applies edits, rejecting results that no longer parse and
+// keeping gofmt-clean files gofmt-clean
+func rewriteSource(path string, src []byte, edits []textEdit) ([]byte, error) {
+	updated, err := applyEdits(src, edits)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), path, updated, parser.ParseComments); err != nil {
+		return nil, fmt.Errorf("rewrite produces invalid Go: %w", err)
+	}
+
+	if formatted, err := format.Source(src); err == nil && bytes.Equal(formatted, src) {
+		if formatted, err := format.Source(updated); err == nil {
+			updated = formatted
+		}
+	}
+	return updated, nil
+}
+
+// lineIndent returns the leading whitespace of the line containing offset
+func lineIndent(src []byte, offset int) string {
+	start := bytes.LastIndexByte(src[:offset], '\n') + 1
+	end := start
+	for end < len(src) && (src[end] == ' ' || src[end] == '\t') {
+		end++
+	}
+	return string(src[start:end])
+}
+
+func metavarName(n ast.Node, prefix string) (string, bool) {
+	ident, ok := n.(*ast.Ident)
+	if !ok || !strings.HasPrefix(ident.Name, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(ident.Name, prefix), true
+}
+
+// listMetavarName recognizes $*name as a list element: an expression, a
+// statement or an unnamed field
+func listMetavarName(n ast.Node) (string, bool) {
+	switch x := n.(type) {
+	case *ast.ExprStmt:
+		n = x.X
+	case *ast.Field:
+		if len(x.Names) == 0 {
+			n = x.Type
+		}
+	}
+	return metavarName(n, listMetavarPrefix)
+}
+
+func isNilNode(n ast.Node) bool {
+	if n == nil {
+		return true
+	}
+	v := reflect.ValueOf(n)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+func sliceNodes(v reflect.Value) []ast.Node {
+	nodes := make([]ast.Node, v.Len())
+	for i := range nodes {
+		nodes[i], _ = v.Index(i).Interface().(ast.Node)
+	}
+	return nodes
+}
+
+func stmtNodes(stmts []ast.Stmt) []ast.Node {
+	nodes := make([]ast.Node, len(stmts))
+	for i, stmt := range stmts {
+		nodes[i] = stmt
+	}
+	return nodes
+}
+
+// parseConstraints reads comma-separated name:type entries, allowing commas
+// inside brackets and parentheses (e.g. "m:map[string]int,f:func(int, int)")
+func parseConstraints(spec string) (map[string]string, error) {
+	constraints := make(map[string]string)
+	depth, start := 0, 0
+	for i := 0; i <= len(spec); i++ {
+		if i < len(spec) {
+			switch spec[i] {
+			case '(', '[', '{':
+				depth++
+			case ')', ']', '}':
+				depth--
+			}
+			if spec[i] != ',' || depth > 0 {
+				continue
+			}
+		}
+
+		entry := strings.TrimSpace(spec[start:i])
+		start = i + 1
+		if entry == "" {
+			continue
+		}
+		name, typ, ok := strings.Cut(entry, ":")
+		name = strings.TrimPrefix(strings.TrimSpace(name), "$")
+		typ = strings.TrimSpace(typ)
+		if !ok || name == "" || typ == "" {
+			return nil, fmt.Errorf("invalid constraint %q, want name:type", entry)
+		}
+		constraints[name] = typ
+	}
+	return constraints, nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const structuralSource = `package a
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+type counter struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (c *counter) inc() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n++
+}
+
+func logs(name string, n int) {
+	log.Printf("start")
+	log.Printf("%s=%d", name, n)
+	log.Printf("%s %s", name, name)
+	fmt.Println(name == name, n == n+1)
+}
+
+func writers(b *bytes.Buffer, s *strings.Builder) {
+	fmt.Fprint(b, "x")
+	fmt.Fprint(s, "y")
+}
+`
+
+func TestStructuralMatch(t *testing.T) {
+	root := writeModule(t, map[string]string{"a.go": structuralSource})
+
+	tests := []struct {
+		name        string
+		pattern     string
+		replacement string
+		constraints string
+		want        []string // matched text
+		wantRepl    []string
+		wantErr     string
+	}{
+		{
+			name:        "list metavariable matches any number of arguments",
+			pattern:     "log.Printf($f, $*args)",
+			replacement: "log.Print(fmt.Sprintf($f, $*args))",
+			want:        []string{`log.Printf("start")`, `log.Printf("%s=%d", name, n)`, `log.Printf("%s %s", name, name)`},
+			wantRepl:    []string{`log.Print(fmt.Sprintf("start"))`, `log.Print(fmt.Sprintf("%s=%d", name, n))`, `log.Print(fmt.Sprintf("%s %s", name, name))`},
+		},
+		{
+			name:        "empty list leading the replacement",
+			pattern:     "log.Printf($f, $*args)",
+			replacement: "log.Print($*args, $f)",
+			want:        []string{`log.Printf("start")`, `log.Printf("%s=%d", name, n)`, `log.Printf("%s %s", name, name)`},
+			wantRepl:    []string{`log.Print("start")`, `log.Print(name, n, "%s=%d")`, `log.Print(name, name, "%s %s")`},
+		},
+		{
+			name:    "list metavariable between fixed arguments",
+			pattern: "log.Printf($f, $*_, n)",
+			want:    []string{`log.Printf("%s=%d", name, n)`},
+		},
+		{
+			name:    "repeated metavariable must bind the same code",
+			pattern: "$x == $x",
+			want:    []string{"name == name"},
+		},
+		{
+			name:        "statement sequence",
+			pattern:     "$m.Lock(); defer $m.Unlock()",
+			replacement: "defer lock(&$m)()",
+			want:        []string{"c.mu.Lock()\n\tdefer c.mu.Unlock()"},
+			wantRepl:    []string{"defer lock(&c.mu)()"},
+		},
+		{
+			name:        "identical type constraint",
+			pattern:     "fmt.Fprint($w, $*_)",
+			constraints: "w:*bytes.Buffer",
+			want:        []string{`fmt.Fprint(b, "x")`},
+		},
+		{
+			name:        "interface constraint",
+			pattern:     "fmt.Fprint($w, $*_)",
+			constraints: "w:fmt.Stringer",
+			want:        []string{`fmt.Fprint(b, "x")`, `fmt.Fprint(s, "y")`},
+		},
+		{
+			name:        "constraint on a pointer's address",
+			pattern:     "$m.Lock()",
+			constraints: "m:sync.Locker",
+			want:        []string{"c.mu.Lock()"},
+		},
+		{
+			name:        "unsatisfied constraint",
+			pattern:     "$x == $y",
+			constraints: "x:string,y:string",
+			want:        []string{"name == name"},
+		},
+		{
+			name:        "constraint on an unused metavariable",
+			pattern:     "$x == $y",
+			constraints: "z:int",
+			wantErr:     "does not use",
+		},
+		{
+			name:        "replacement with an unbound metavariable",
+			pattern:     "$x == $y",
+			replacement: "$z",
+			wantErr:     "does not bind",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			constraints, err := parseConstraints(tt.constraints)
+			if err != nil {
+				t.Fatalf("parseConstraints() error = %v", err)
+			}
+			var replacement *string
+			if tt.replacement != "" {
+				replacement = &tt.replacement
+			}
+
+			result, err := structuralReplace(context.Background(), root, tt.pattern, replacement, constraints, true)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("structuralReplace() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("structuralReplace() error = %v", err)
+			}
+
+			var got, gotRepl []string
+			for _, file := range result.Files {
+				for _, m := range file.Matches {
+					got = append(got, m.Text)
+					if m.Replacement != "" {
+						gotRepl = append(gotRepl, m.Replacement)
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matches = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(gotRepl, tt.wantRepl) {
+				t.Errorf("replacements = %q, want %q", gotRepl, tt.wantRepl)
+			}
+		})
+	}
+}
+
+func TestStructuralReplaceWrites(t *testing.T) {
+	root := writeModule(t, map[string]string{
+		"a.go": "package a\n\nfunc f(x int) int { return x + 0 }\n",
+		"b.go": "package a\n\nfunc g(y int) int { return y + 0 }\n",
+	})
+	replacement := "$x"
+
+	result, err := structuralReplace(context.Background(), root, "$x + 0", &replacement, nil, false)
+	if err != nil {
+		t.Fatalf("structuralReplace() error = %v", err)
+	}
+	if result.TotalMatches != 2 {
+		t.Errorf("TotalMatches = %d, want 2", result.TotalMatches)
+	}
+	for name, want := range map[string]string{
+		"a.go": "package a\n\nfunc f(x int) int { return x }\n",
+		"b.go": "package a\n\nfunc g(y int) int { return y }\n",
+	} {
+		if got, _ := os.ReadFile(filepath.Join(root, name)); string(got) != want {
+			t.Errorf("%s =\n%s\nwant\n%s", name, got, want)
+		}
+	}
+}
+
+// A rewrite that no longer parses in one file leaves every file untouched
+func TestStructuralReplaceAbortsOnFailure(t *testing.T) {
+	files := map[string]string{
+		"a.go": "package a\n\nfunc f(x int) int { return x + 0 }\n",
+		"b.go": "package a\n\nvar y = 1\n\nvar _ = []int{y + 0}\n",
+	}
+	root := writeModule(t, files)
+	replacement := "$x +"
+
+	_, err := structuralReplace(context.Background(), root, "$x + 0", &replacement, nil, false)
+	if err == nil || !strings.Contains(err.Error(), "no files written") {
+		t.Fatalf("structuralReplace() error = %v, want nothing written", err)
+	}
+	for name, want := range files {
+		if got, _ := os.ReadFile(filepath.Join(root, name)); string(got) != want {
+			t.Errorf("%s was changed to\n%s", name, got)
+		}
+	}
+}
+
+func TestParseConstraints(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"", map[string]string{}, false},
+		{"x:*sync.Mutex, $err:error", map[string]string{"x": "*sync.Mutex", "err": "error"}, false},
+		{"m:map[string]int,f:func(int, int) bool", map[string]string{"m": "map[string]int", "f": "func(int, int) bool"}, false},
+		{"x", nil, true},
+		{"x:", nil, true},
+		{":int", nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseConstraints(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseConstraints(%q) = %v, want an error", tt.spec, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseConstraints(%q) = %v, %v, want %v", tt.spec, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fileTransaction writes a set of files all or nothing. New contents are
+// staged in temporary files next to their targets and renamed into place;
+// if any step fails, files already replaced are restored.
+type fileTransaction struct {
+	id      string
+	changes []*fileChange
+}
+
+type fileChange struct {
+	path     string
+	target   string      // path with symlinks resolved, the file actually replaced
+	content  []byte      // nil deletes the file
+	original []byte      // nil if the file did not exist
+	info     os.FileInfo // of the original, whose mode and owner are kept
+	temp     string
+	applied  bool
+}
+
+func newFileTransaction() (*fileTransaction, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	return &fileTransaction{id: hex.EncodeToString(id)}, nil
+}
+
+// writeFile replaces a single file through a transaction, failing if it
+// no longer contains original
+func writeFile(path string, content, original []byte) error {
+	tx, err := newFileTransaction()
+	if err != nil {
+		return err
+	}
+	if err := tx.write(path, content, original); err != nil {
+		return err
+	}
+	return tx.commit()
+}
+
+// write stages content for path, which may appear in a transaction only
+// once. original is what the caller validated against, nil for a file it
+// expects to create; commit fails if the file no longer matches.
+func (t *fileTransaction) write(path string, content, original []byte) error {
+	if content == nil {
+		content = []byte{}
+	}
+	return t.add(&fileChange{path: path, content: content, original: original})
+}
+
+// remove stages the deletion of path, which must still contain original
+// and may appear in a transaction only once
+func (t *fileTransaction) remove(path string, original []byte) error {
+	return t.add(&fileChange{path: path, original: original})
+}
+
+// add stages change, refusing a second change to the same file, whose
+// original would be stale once the first was applied
+func (t *fileTransaction) add(change *fileChange) error {
+	for _, c := range t.changes {
+		if filepath.Clean(c.path) == filepath.Clean(change.path) {
+			return fmt.Errorf("%s is changed twice in one transaction", change.path)
+		}
+	}
+	t.changes = append(t.changes, change)
+	return nil
+}
+
+func (t *fileTransaction) commit() error {
+	defer t.cleanup()
+
+	if err := t.stage(); err != nil {
+		return err
+	}
+
+	for _, c := range t.changes {
+		var err error
+		if c.content == nil {
+			err = os.Remove(c.target)
+		} else {
+			err = os.Rename(c.temp, c.target)
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to replace %s: %w", c.path, err)
+			if rollbackErr := t.rollback(); rollbackErr != nil {
+				return fmt.Errorf("%w; rollback failed: %v", err, rollbackErr)
+			}
+			return fmt.Errorf("%w; rolled back", err)
+		}
+		c.applied = true
+	}
+
+	return nil
+}
+
+// stage checks every file against the contents the caller validated and
+// writes the temporary files, before anything is replaced. Symlinks are
+// resolved so that the file they point to is replaced, not the link.
+func (t *fileTransaction) stage() error {
+	targets := make(map[string]string)
+	for _, c := range t.changes {
+		var err error
+		if c.target, err = resolveTarget(c.path); err != nil {
+			return err
+		}
+		if other, ok := targets[c.target]; ok {
+			return fmt.Errorf("%s and %s are the same file", other, c.path)
+		}
+		targets[c.target] = c.path
+
+		current, err := os.ReadFile(c.target)
+		switch {
+		case err == nil:
+			if c.original == nil {
+				return fmt.Errorf("%s already exists", c.path)
+			}
+			if !bytes.Equal(current, c.original) {
+				return fmt.Errorf("%s changed since the edits were validated", c.path)
+			}
+			if c.info, err = os.Stat(c.target); err != nil {
+				return fmt.Errorf("failed to stat %s: %w", c.path, err)
+			}
+		case errors.Is(err, os.ErrNotExist):
+			if c.original != nil {
+				return fmt.Errorf("%s was removed since the edits were validated", c.path)
+			}
+		default:
+			return fmt.Errorf("failed to read %s: %w", c.path, err)
+		}
+
+		if c.content == nil {
+			continue
+		}
+		if c.temp, err = t.writeTemp(c.target, c.content, c.info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveTarget follows symlinks in path. A file that does not exist yet
+// is resolved through its directory, and a dangling link is replaced
+// itself.
+func resolveTarget(path string) (string, error) {
+	target, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		return target, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return path, nil
+	}
+	return filepath.Join(dir, filepath.Base(path)), nil
+}
+
+// writeTemp writes content to a new file next to path, with the mode and
+// owner of info, or mode 0644 if info is nil
+func (t *fileTransaction) writeTemp(path string, content []byte, info os.FileInfo) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".gocp-"+t.id+"-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to stage %s: %w", path, err)
+	}
+	name := f.Name()
+
+	_, err = f.Write(content)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	perm := os.FileMode(0644)
+	if info != nil {
+		perm = info.Mode().Perm()
+		if err == nil {
+			err = chownLike(name, info)
+		}
+	}
+	if err == nil {
+		// After chown, which may clear mode bits
+		err = os.Chmod(name, perm)
+	}
+	if err != nil {
+		os.Remove(name)
+		return "", fmt.Errorf("failed to stage %s: %w", path, err)
+	}
+	return name, nil
+}
+
+// rollback restores the original contents of every replaced file, newest
+// first
+func (t *fileTransaction) rollback() error {
+	var failed []string
+	for i := len(t.changes) - 1; i >= 0; i-- {
+		c := t.changes[i]
+		if !c.applied {
+			continue
+		}
+
+		var err error
+		if c.original == nil {
+			err = os.Remove(c.target)
+		} else {
+			var temp string
+			if temp, err = t.writeTemp(c.target, c.original, c.info); err == nil {
+				if err = os.Rename(temp, c.target); err != nil {
+					os.Remove(temp)
+				}
+			}
+		}
+		if err != nil {
+			failed = append(failed, c.path)
+			continue
+		}
+		c.applied = false
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("could not restore %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (t *fileTransaction) cleanup() {
+	for _, c := range t.changes {
+		if c.temp != "" && !c.applied {
+			os.Remove(c.temp)
+		}
+	}
+}
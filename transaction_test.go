@@ -0,0 +1,215 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// readFiles returns the contents of names in dir, with "" for a missing file
+func readFiles(t *testing.T, dir string, names ...string) map[string]string {
+	t.Helper()
+	got := make(map[string]string)
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		got[name] = string(data)
+	}
+	return got
+}
+
+func TestFileTransactionCommit(t *testing.T) {
+	dir := t.TempDir()
+	a, b, c := filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "c")
+	touch(t, a, "old a")
+	touch(t, b, "old b")
+
+	tx, err := newFileTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range []error{
+		tx.write(a, []byte("new a"), []byte("old a")),
+		tx.remove(b, []byte("old b")),
+		tx.write(c, []byte("new c"), nil),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.commit(); err != nil {
+		t.Fatalf("commit() error = %v", err)
+	}
+
+	got := readFiles(t, dir, "a", "b", "c")
+	if got["a"] != "new a" || got["b"] != "" || got["c"] != "new c" {
+		t.Errorf("files after commit = %q", got)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("directory holds %d entries, want a and c without temporary files", len(entries))
+	}
+}
+
+// A file that no longer holds what the caller validated stops the whole
+// transaction before anything is written
+func TestFileTransactionConflict(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(dir string)
+		wantErr string
+	}{
+		{
+			name:    "changed",
+			setup:   func(dir string) { touch(t, filepath.Join(dir, "b"), "edited b") },
+			wantErr: "changed since",
+		},
+		{
+			name:    "removed",
+			setup:   func(dir string) { os.Remove(filepath.Join(dir, "b")) },
+			wantErr: "was removed",
+		},
+		{
+			name:    "created",
+			setup:   func(dir string) { touch(t, filepath.Join(dir, "c"), "other c") },
+			wantErr: "already exists",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			touch(t, filepath.Join(dir, "a"), "old a")
+			touch(t, filepath.Join(dir, "b"), "old b")
+
+			tx, err := newFileTransaction()
+			if err != nil {
+				t.Fatal(err)
+			}
+			tx.write(filepath.Join(dir, "a"), []byte("new a"), []byte("old a"))
+			tx.write(filepath.Join(dir, "b"), []byte("new b"), []byte("old b"))
+			tx.write(filepath.Join(dir, "c"), []byte("new c"), nil)
+			tt.setup(dir)
+			before := readFiles(t, dir, "a", "b", "c")
+
+			err = tx.commit()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("commit() error = %v, want one containing %q", err, tt.wantErr)
+			}
+			if got := readFiles(t, dir, "a", "b", "c"); got["a"] != before["a"] || got["b"] != before["b"] || got["c"] != before["c"] {
+				t.Errorf("files after a failed commit = %q, want %q", got, before)
+			}
+		})
+	}
+}
+
+func TestFileTransactionRollback(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	touch(t, a, "old a")
+
+	tx, err := newFileTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.write(a, []byte("new a"), []byte("old a"))
+	tx.write(b, []byte("new b"), nil)
+	if err := tx.stage(); err != nil {
+		t.Fatal(err)
+	}
+	defer tx.cleanup()
+
+	// Apply both as commit would, then undo them as after a later failure
+	for _, c := range tx.changes {
+		if err := os.Rename(c.temp, c.target); err != nil {
+			t.Fatal(err)
+		}
+		c.applied = true
+	}
+	if err := tx.rollback(); err != nil {
+		t.Fatalf("rollback() error = %v", err)
+	}
+
+	if got := readFiles(t, dir, "a", "b"); got["a"] != "old a" || got["b"] != "" {
+		t.Errorf("files after rollback = %q, want a restored and b removed", got)
+	}
+}
+
+func TestFileTransactionDuplicate(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a")
+	touch(t, a, "a")
+	if err := os.Symlink(a, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := newFileTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.write(a, []byte("x"), []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.write(filepath.Join(dir, ".", "a"), []byte("y"), []byte("a")); err == nil {
+		t.Errorf("write() of the same path twice succeeded")
+	}
+
+	// A link to a staged file is only found once both are resolved
+	if err := tx.write(filepath.Join(dir, "link"), []byte("y"), []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.commit(); err == nil || !strings.Contains(err.Error(), "same file") {
+		t.Errorf("commit() error = %v, want the same file changed twice", err)
+	}
+	if got := readFiles(t, dir, "a"); got["a"] != "a" {
+		t.Errorf("a = %q after a failed commit", got["a"])
+	}
+}
+
+// Writing through a symlink replaces the file it points to and keeps the
+// link, and the replaced file keeps its mode and owner
+func TestFileTransactionKeepsFile(t *testing.T) {
+	dir := t.TempDir()
+	real := filepath.Join(dir, "real")
+	link := filepath.Join(dir, "link")
+	touch(t, real, "old")
+	if err := os.Chmod(real, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("real", link); err != nil {
+		t.Fatal(err)
+	}
+	owned := os.Getuid() == 0
+	if owned {
+		if err := os.Chown(real, 1234, 5678); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := writeFile(link, []byte("new"), []byte("old")); err != nil {
+		t.Fatalf("writeFile() error = %v", err)
+	}
+
+	if target, err := os.Readlink(link); err != nil || target != "real" {
+		t.Errorf("link = %q, %v; want it still pointing at real", target, err)
+	}
+	info, err := os.Stat(real)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFiles(t, dir, "real"); got["real"] != "new" {
+		t.Errorf("real = %q, want new", got["real"])
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); owned && ok && (stat.Uid != 1234 || stat.Gid != 5678) {
+		t.Errorf("owner = %d:%d, want 1234:5678", stat.Uid, stat.Gid)
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	transportStdio = "stdio"
+	transportHTTP  = "http"
+	transportSSE   = "sse"
+)
+
+// HTTP clients choose the workspace root of their session with this header
+// or query parameter; the SSE transport carries the query of the event
+// stream URL over to every message
+const (
+	sessionRootHeader = "X-Gocp-Root"
+	sessionRootParam  = "root"
+)
+
+// streamableEndpoint is where the streamable HTTP transport is mounted
+const streamableEndpoint = "/mcp"
+
+// maxRequestBody bounds a posted message, which is read whole to find its
+// JSON-RPC ID
+const maxRequestBody = 10 << 20
+
+type serveOptions struct {
+	transport string
+	listen    string
+	authToken string
+	noAuth    bool // serve HTTP without a token, knowingly
+}
+
+type sessionRootKey struct{}
+
+// serve runs the MCP server over the chosen transport until it fails
+func serve(mcpServer *server.MCPServer, opts serveOptions) error {
+	switch opts.transport {
+	case transportStdio:
+		return serveStdio(mcpServer)
+
+	case transportHTTP:
+		mux := http.NewServeMux()
+		mux.Handle(streamableEndpoint, server.NewStreamableHTTPServer(mcpServer,
+			server.WithEndpointPath(streamableEndpoint),
+			server.WithHTTPContextFunc(sessionRootContext),
+		))
+		return listenHTTP(mux, opts)
+
+	case transportSSE:
+		return listenHTTP(server.NewSSEServer(mcpServer,
+			server.WithSSEContextFunc(sessionRootContext),
+			server.WithAppendQueryToMessageEndpoint(),
+		), opts)
+	}
+
+	return fmt.Errorf("unknown transport %q (want %s, %s or %s)", opts.transport, transportStdio, transportHTTP, transportSSE)
+}
+
+// serveStdio serves a single client over stdin and stdout. Unlike
+// server.ServeStdio it runs tool calls concurrently, so that the client's
+// cancellation notifications are read while a call is still running.
+func serveStdio(mcpServer *server.MCPServer) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	session := &stdioSession{notifications: make(chan mcp.JSONRPCNotification, 100)}
+	if err := mcpServer.RegisterSession(ctx, session); err != nil {
+		return fmt.Errorf("failed to register session: %w", err)
+	}
+	defer mcpServer.UnregisterSession(ctx, session.SessionID())
+	ctx = mcpServer.WithContext(ctx, session)
+
+	// One writer, so that the notifications sent while handling a request,
+	// such as its progress, precede the response
+	responses := make(chan mcp.JSONRPCMessage)
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		encoder := json.NewEncoder(os.Stdout)
+		write := func(message any) {
+			if err := encoder.Encode(message); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write message: %v\n", err)
+			}
+		}
+		for {
+			select {
+			case notification := <-session.notifications:
+				write(notification)
+			case response, ok := <-responses:
+				if !ok {
+					return
+				}
+				for drained := false; !drained; {
+					select {
+					case notification := <-session.notifications:
+						write(notification)
+					default:
+						drained = true
+					}
+				}
+				write(response)
+			}
+		}
+	}()
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReader(os.Stdin)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(bytes.TrimSpace(line)) > 0 {
+				lines <- line
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	var calls sync.WaitGroup
+	defer func() {
+		calls.Wait()
+		close(responses)
+		<-written
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to read stdin: %w", err)
+		case line := <-lines:
+			var message struct {
+				Method string `json:"method"`
+			}
+			concurrent := json.Unmarshal(line, &message) == nil && message.Method == string(mcp.MethodToolsCall)
+
+			handle := func() {
+				if response := mcpServer.HandleMessage(withRequestID(ctx, line), line); response != nil {
+					responses <- response
+				}
+			}
+			// Everything else stays in order, as it would with
+			// server.ServeStdio
+			if concurrent {
+				calls.Add(1)
+				go func() {
+					defer calls.Done()
+					handle()
+				}()
+			} else {
+				handle()
+			}
+		}
+	}
+}
+
+// stdioSession is the one client session of the stdio transport
+type stdioSession struct {
+	notifications chan mcp.JSONRPCNotification
+	initialized   atomic.Bool
+}
+
+func (s *stdioSession) SessionID() string {
+	return "stdio"
+}
+
+func (s *stdioSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+func (s *stdioSession) Initialize() {
+	s.initialized.Store(true)
+}
+
+func (s *stdioSession) Initialized() bool {
+	return s.initialized.Load()
+}
+
+func listenHTTP(handler http.Handler, opts serveOptions) error {
+	handler = recordRequestIDs(handler)
+	switch {
+	case opts.authToken != "":
+		handler = requireBearer(opts.authToken, handler)
+	case opts.noAuth:
+		fmt.Fprintf(os.Stderr, "Warning: serving %s on %s without authentication\n", opts.transport, opts.listen)
+	default:
+		return fmt.Errorf("refusing to serve %s without an auth token; set -auth-token or pass -insecure-no-auth", opts.transport)
+	}
+
+	listenHost, _, err := net.SplitHostPort(opts.listen)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", opts.listen, err)
+	}
+	handler = checkOrigin(listenHost, handler)
+
+	srv := &http.Server{
+		Addr:              opts.listen,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return srv.ListenAndServe()
+}
+
+// requireBearer rejects requests without the bearer token
+func requireBearer(token string, next http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gocp"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkOrigin rejects requests whose Host or Origin names a host other than
+// the one listened on, localhost or a loopback address, as the MCP spec asks
+// of HTTP servers to defeat DNS rebinding: a page whose domain has been
+// rebound to this server's address still sends its own name in both
+func checkOrigin(listenHost string, next http.Handler) http.Handler {
+	listenIP := net.ParseIP(strings.Trim(listenHost, "[]"))
+	allowed := func(host string) bool {
+		host = strings.TrimSuffix(strings.ToLower(host), ".")
+		if ip := net.ParseIP(host); ip != nil {
+			return ip.IsLoopback() || (listenIP != nil && !listenIP.IsUnspecified() && ip.Equal(listenIP))
+		}
+		return host == "localhost" || strings.HasSuffix(host, ".localhost") ||
+			(listenHost != "" && strings.EqualFold(host, listenHost))
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !allowed(strings.Trim(host, "[]")) {
+			http.Error(w, "forbidden host", http.StatusForbidden)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || u.Host == "" || !allowed(u.Hostname()) {
+				http.Error(w, "forbidden origin", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// recordRequestIDs puts the JSON-RPC ID of every posted message in the
+// request context, which both HTTP transports carry through to the tool
+// handlers
+func recordRequestIDs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.Body != nil {
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			if err != nil {
+				http.Error(w, "failed to read request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r = r.WithContext(withRequestID(r.Context(), body))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func sessionRootContext(ctx context.Context, r *http.Request) context.Context {
+	root := r.Header.Get(sessionRootHeader)
+	if root == "" {
+		root = r.URL.Query().Get(sessionRootParam)
+	}
+	if root == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, sessionRootKey{}, root)
+}
+
+func sessionRoot(ctx context.Context) (string, bool) {
+	root, ok := ctx.Value(sessionRootKey{}).(string)
+	return root, ok
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		listenHost string
+		host       string
+		origin     string
+		want       int
+	}{
+		{"localhost", "localhost:8080", "", http.StatusOK},
+		{"localhost", "app.localhost:8080", "http://localhost:3000", http.StatusOK},
+		{"localhost", "127.0.0.1:8080", "", http.StatusOK},
+		{"localhost", "[::1]:8080", "http://127.0.0.2", http.StatusOK},
+		{"localhost", "example.com:8080", "", http.StatusForbidden},
+		{"localhost", "localhost:8080", "http://example.com", http.StatusForbidden},
+		{"localhost", "localhost:8080", "null", http.StatusForbidden},
+		// A rebound name may resolve to any address, so only loopback and
+		// the listen address itself are trusted
+		{"localhost", "192.0.2.1:8080", "", http.StatusForbidden},
+		{"192.0.2.1", "192.0.2.1:8080", "http://192.0.2.1", http.StatusOK},
+		{"192.0.2.1", "192.0.2.2:8080", "", http.StatusForbidden},
+		{"", "192.0.2.1:8080", "", http.StatusForbidden},
+		{"0.0.0.0", "0.0.0.0:8080", "", http.StatusForbidden},
+		{"gocp.internal", "GOCP.internal.:8080", "", http.StatusOK},
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, tt := range tests {
+		handler := checkOrigin(tt.listenHost, ok)
+		r := httptest.NewRequest(http.MethodGet, "/mcp", nil)
+		r.Host = tt.host
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("listening on %q, Host %q, Origin %q: status %d, want %d", tt.listenHost, tt.host, tt.origin, w.Code, tt.want)
+		}
+	}
+}
+
+func TestRecordRequestIDs(t *testing.T) {
+	var gotBody string
+	var gotID any
+	handler := recordRequestIDs(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		if id, ok := r.Context().Value(requestIDKey{}).(mcp.RequestId); ok {
+			gotID = id.Value()
+		}
+	}))
+
+	message := `{"jsonrpc":"2.0","id":7,"method":"tools/call"}`
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(message)))
+	if w.Code != http.StatusOK || gotBody != message {
+		t.Errorf("status %d, body %q; want the message passed on", w.Code, gotBody)
+	}
+	if gotID != int64(7) {
+		t.Errorf("request ID = %v (%T), want 7", gotID, gotID)
+	}
+
+	gotBody = ""
+	large := strings.NewReader(`{"id":1,"params":"` + strings.Repeat("x", maxRequestBody) + `"}`)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/mcp", large))
+	if w.Code != http.StatusRequestEntityTooLarge || gotBody != "" {
+		t.Errorf("oversized message: status %d, want %d and the handler not called", w.Code, http.StatusRequestEntityTooLarge)
+	}
+}
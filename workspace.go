@@ -0,0 +1,615 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+)
+
+// workspaces caches parsed and type-checked state per workspace root for the
+// lifetime of the server process
+var workspaces = newWorkspaceIndex()
+
+type workspaceIndex struct {
+	mu    sync.Mutex
+	roots map[string]*workspace
+}
+
+type workspace struct {
+	root string
+
+	mu              sync.Mutex
+	files           map[string]*cachedFile
+	syntaxRefreshed time.Time
+
+	typedMu      sync.Mutex
+	typed        *typedState
+	typedStamps  map[string]fileStamp // files and directories typed was built from
+	typedLoaded  time.Time
+	loadDuration time.Duration
+
+	// SSA state is built lazily from pkgs and discarded when they reload
+	ssaMu         sync.Mutex
+	ssaGeneration int
+	program       *ssa.Program
+	callGraphs    map[string]*callgraph.Graph
+}
+
+// typedState is one consistent set of type-checked packages and the
+// sources they were parsed from. Refreshing the workspace replaces it, so
+// callers may keep reading the one they were given.
+type typedState struct {
+	pkgs       []*packages.Package
+	sources    map[string][]byte
+	generation int // changes with every refresh
+	loadedBase int // base of the FileSet after the full load
+}
+
+// cachedFile holds the syntax of one file in a FileSet of its own, which is
+// dropped with it when the file is reparsed or forgotten
+type cachedFile struct {
+	stamp fileStamp
+	src   []byte
+	file  *ast.File
+	fset  *token.FileSet
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+type IndexStatus struct {
+	Root            string   `json:"root"`
+	SyntaxFiles     int      `json:"syntax_files"`
+	SyntaxRefreshed string   `json:"syntax_refreshed,omitempty"`
+	Packages        int      `json:"packages"`
+	TypedFiles      int      `json:"typed_files"`
+	TypedLoaded     string   `json:"typed_loaded,omitempty"`
+	LoadDuration    string   `json:"load_duration,omitempty"`
+	StaleFiles      []string `json:"stale_files,omitempty"`
+}
+
+func newWorkspaceIndex() *workspaceIndex {
+	return &workspaceIndex{
+		roots: make(map[string]*workspace),
+	}
+}
+
+// forDir returns the workspace owning dir, rooted at the nearest enclosing
+// go.mod or at dir itself when there is none
+func (idx *workspaceIndex) forDir(dir string) (*workspace, string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+
+	root := findModuleRoot(absDir)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	ws, ok := idx.roots[root]
+	if !ok {
+		ws = &workspace{
+			root:  root,
+			files: make(map[string]*cachedFile),
+		}
+		idx.roots[root] = ws
+	}
+
+	return ws, absDir, nil
+}
+
+func (idx *workspaceIndex) all() []*workspace {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var result []*workspace
+	for _, ws := range idx.roots {
+		result = append(result, ws)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].root < result[j].root
+	})
+	return result
+}
+
+func findModuleRoot(dir string) string {
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			return d
+		}
+		if filepath.Dir(d) == d {
+			return dir
+		}
+	}
+}
+
+func statFile(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// parsedFile returns the cached syntax for path, reparsing it only when its
+// mtime or size changed since it was last seen
+func (ws *workspace) parsedFile(path string, info fs.FileInfo) (*cachedFile, error) {
+	stamp := fileStamp{modTime: info.ModTime(), size: info.Size()}
+
+	ws.mu.Lock()
+	cached, ok := ws.files[path]
+	ws.mu.Unlock()
+	if ok && cached.stamp == stamp {
+		return cached, nil
+	}
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	cached = &cachedFile{stamp: stamp, src: src, file: file, fset: fset}
+
+	ws.mu.Lock()
+	ws.files[path] = cached
+	ws.syntaxRefreshed = time.Now()
+	ws.mu.Unlock()
+
+	return cached, nil
+}
+
+// forget drops cached syntax for files under dir that no longer exist
+func (ws *workspace) forget(dir string, seen map[string]bool) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	for path := range ws.files {
+		if !seen[path] && isWithin(dir, path) {
+			delete(ws.files, path)
+		}
+	}
+}
+
+// await runs load in the background and waits for it until ctx is done. A
+// load given the same ctx stops soon after, releasing the workspace for the
+// next call; its results must not be read.
+func await(ctx context.Context, load func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- load()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// load returns the typed state of the workspace, brought up to date for the
+// packages under scope and the workspace packages they import. Changes
+// elsewhere are picked up by the call that needs them. Cancelling ctx stops
+// a full load, leaving the previous state in place.
+func (ws *workspace) load(ctx context.Context, scope string) (*typedState, error) {
+	ws.typedMu.Lock()
+	defer ws.typedMu.Unlock()
+
+	if ws.typed == nil {
+		return ws.reload(ctx)
+	}
+
+	stale := ws.staleFiles(scope)
+	if len(stale) == 0 {
+		return ws.typed, nil
+	}
+	if state, ok := ws.recheck(stale); ok {
+		ws.typed = state
+		ws.typedLoaded = time.Now()
+		return state, nil
+	}
+	return ws.reload(ctx)
+}
+
+// reload loads and type-checks the whole workspace into a new FileSet; the
+// caller must hold typedMu
+func (ws *workspace) reload(ctx context.Context) (*typedState, error) {
+	// Stamp before loading so edits made during the load mark it stale
+	stamps := make(map[string]fileStamp)
+	for _, path := range workspaceSources(ws.root) {
+		if stamp, err := statFile(path); err == nil {
+			stamps[path] = stamp
+		}
+	}
+
+	start := time.Now()
+	pkgs, sources, err := loadWorkspace(ctx, ws.root, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	generation := 1
+	if ws.typed != nil {
+		generation = ws.typed.generation + 1
+	}
+	ws.typed = &typedState{pkgs: pkgs, sources: sources, generation: generation}
+	if len(pkgs) > 0 {
+		ws.typed.loadedBase = pkgs[0].Fset.Base()
+	}
+	ws.typedStamps = stamps
+	ws.typedLoaded = time.Now()
+	ws.loadDuration = time.Since(start)
+
+	return ws.typed, nil
+}
+
+// staleFiles lists the stamped files and directories under scope, in the
+// workspace packages imported from there or at the root, such as go.mod,
+// that were modified since they were type-checked. It stats only those; a
+// changed directory stands for files added to or removed from it. The
+// caller must hold typedMu.
+func (ws *workspace) staleFiles(scope string) []string {
+	depDirs := make(map[string]bool)
+	var inScope []*packages.Package
+	for _, pkg := range ws.typed.pkgs {
+		if isWithin(scope, pkg.Dir) {
+			inScope = append(inScope, pkg)
+		}
+	}
+	packages.Visit(inScope, nil, func(pkg *packages.Package) {
+		if pkg.Dir != "" && isWithin(ws.root, pkg.Dir) {
+			depDirs[pkg.Dir] = true
+		}
+	})
+
+	var stale []string
+	for path, old := range ws.typedStamps {
+		relevant := isWithin(scope, path) || depDirs[path] || depDirs[filepath.Dir(path)] || filepath.Dir(path) == ws.root
+		if !relevant {
+			continue
+		}
+		if stamp, err := statFile(path); err != nil || stamp != old {
+			stale = append(stale, path)
+		}
+	}
+
+	sort.Strings(stale)
+	return stale
+}
+
+// recheck type-checks again only the packages containing the stale files
+// and the workspace packages importing them, directly or not, reusing
+// everything else of the current state. It declines, leaving a full
+// reload, for changes that may alter the package graph: directories,
+// module files, files outside any package, cgo packages and edits to a
+// file's package clause, build constraints or imports. Rechecked files are
+// added to the FileSet of the full load, so once they have doubled it a
+// reload starts a new one. The caller must hold typedMu.
+func (ws *workspace) recheck(stale []string) (*typedState, bool) {
+	state := ws.typed
+	if len(state.pkgs) == 0 {
+		return nil, false
+	}
+	fset := state.pkgs[0].Fset
+	if fset.Base() > 2*state.loadedBase {
+		return nil, false
+	}
+
+	// Every package the workspace packages reach, with the packages
+	// importing each
+	containing := make(map[string][]*packages.Package)
+	importers := make(map[*packages.Package][]*packages.Package)
+	packages.Visit(state.pkgs, nil, func(pkg *packages.Package) {
+		for _, imp := range pkg.Imports {
+			importers[imp] = append(importers[imp], pkg)
+		}
+		if !isWithin(ws.root, pkg.Dir) {
+			return
+		}
+		for _, path := range pkg.CompiledGoFiles {
+			containing[path] = append(containing[path], pkg)
+		}
+	})
+
+	stamps := make(map[string]fileStamp)
+	sources := make(map[string][]byte)
+	parsed := make(map[string]*ast.File)
+	affected := make(map[*packages.Package]bool)
+	var mark func(pkg *packages.Package)
+	mark = func(pkg *packages.Package) {
+		if affected[pkg] {
+			return
+		}
+		affected[pkg] = true
+		for _, importer := range importers[pkg] {
+			mark(importer)
+		}
+	}
+
+	for _, path := range stale {
+		pkgs := containing[path]
+		if len(pkgs) == 0 {
+			return nil, false
+		}
+		stamp, err := statFile(path)
+		if err != nil {
+			return nil, false
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, false
+		}
+		file, err := parser.ParseFile(fset, path, src, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			return nil, false
+		}
+
+		for _, pkg := range pkgs {
+			if len(pkg.CompiledGoFiles) != len(pkg.GoFiles) {
+				return nil, false
+			}
+			for _, e := range pkg.Errors {
+				if e.Kind != packages.TypeError {
+					return nil, false
+				}
+			}
+			old := syntaxFor(pkg, path)
+			if old == nil || fileHeader(old) != fileHeader(file) {
+				return nil, false
+			}
+			mark(pkg)
+		}
+
+		stamps[path], sources[path], parsed[path] = stamp, src, file
+	}
+
+	// Check dependencies before the packages importing them
+	rechecked := make(map[*packages.Package]*packages.Package)
+	var check func(pkg *packages.Package)
+	check = func(pkg *packages.Package) {
+		if _, ok := rechecked[pkg]; ok || !affected[pkg] {
+			return
+		}
+		rechecked[pkg] = nil
+		for _, imp := range pkg.Imports {
+			check(imp)
+		}
+		rechecked[pkg] = typeCheck(pkg, parsed, rechecked)
+	}
+	for pkg := range affected {
+		check(pkg)
+	}
+
+	pkgs := make([]*packages.Package, len(state.pkgs))
+	for i, pkg := range state.pkgs {
+		if updated := rechecked[pkg]; updated != nil {
+			pkg = updated
+		}
+		pkgs[i] = pkg
+	}
+
+	merged := make(map[string][]byte, len(state.sources))
+	for path, src := range state.sources {
+		merged[path] = src
+	}
+	for path, src := range sources {
+		merged[path] = src
+	}
+	for path, stamp := range stamps {
+		ws.typedStamps[path] = stamp
+	}
+
+	return &typedState{pkgs: pkgs, sources: merged, generation: state.generation + 1, loadedBase: state.loadedBase}, true
+}
+
+// typeCheck returns a copy of pkg type-checked again with the files in
+// parsed replacing its own, importing the rechecked copies of its imports
+func typeCheck(pkg *packages.Package, parsed map[string]*ast.File, rechecked map[*packages.Package]*packages.Package) *packages.Package {
+	updated := *pkg
+	updated.Imports = make(map[string]*packages.Package, len(pkg.Imports))
+	for path, imp := range pkg.Imports {
+		if r := rechecked[imp]; r != nil {
+			imp = r
+		}
+		updated.Imports[path] = imp
+	}
+
+	updated.Syntax = make([]*ast.File, len(pkg.Syntax))
+	for i, file := range pkg.Syntax {
+		if f, ok := parsed[pkg.Fset.File(file.Pos()).Name()]; ok {
+			file = f
+		}
+		updated.Syntax[i] = file
+	}
+
+	updated.Types = types.NewPackage(pkg.PkgPath, pkg.Name)
+	updated.TypesInfo = &types.Info{
+		Types:        make(map[ast.Expr]types.TypeAndValue),
+		Defs:         make(map[*ast.Ident]types.Object),
+		Uses:         make(map[*ast.Ident]types.Object),
+		Implicits:    make(map[ast.Node]types.Object),
+		Instances:    make(map[*ast.Ident]types.Instance),
+		Scopes:       make(map[ast.Node]*types.Scope),
+		Selections:   make(map[*ast.SelectorExpr]*types.Selection),
+		FileVersions: make(map[*ast.File]string),
+	}
+	updated.Errors = nil
+	updated.TypeErrors = nil
+
+	conf := &types.Config{
+		Importer: importerFunc(func(path string) (*types.Package, error) {
+			if path == "unsafe" {
+				return types.Unsafe, nil
+			}
+			if imp, ok := updated.Imports[path]; ok && imp.Types != nil {
+				return imp.Types, nil
+			}
+			return nil, fmt.Errorf("no package for import %q", path)
+		}),
+		Sizes: pkg.TypesSizes,
+		Error: func(err error) {
+			if typeErr, ok := err.(types.Error); ok {
+				updated.TypeErrors = append(updated.TypeErrors, typeErr)
+				updated.Errors = append(updated.Errors, packages.Error{
+					Pos:  typeErr.Fset.Position(typeErr.Pos).String(),
+					Msg:  typeErr.Msg,
+					Kind: packages.TypeError,
+				})
+			}
+		},
+	}
+	if pkg.Module != nil && pkg.Module.GoVersion != "" {
+		conf.GoVersion = "go" + pkg.Module.GoVersion
+	}
+	// Errors are collected above, as go/packages does
+	_ = types.NewChecker(conf, pkg.Fset, updated.Types, updated.TypesInfo).Files(updated.Syntax)
+
+	updated.IllTyped = len(updated.Errors) > 0
+	for _, imp := range updated.Imports {
+		updated.IllTyped = updated.IllTyped || imp.IllTyped
+	}
+	return &updated
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) {
+	return f(path)
+}
+
+// syntaxFor returns the syntax tree pkg has for the file at path
+func syntaxFor(pkg *packages.Package, path string) *ast.File {
+	for _, file := range pkg.Syntax {
+		if pkg.Fset.File(file.Pos()).Name() == path {
+			return file
+		}
+	}
+	return nil
+}
+
+// fileHeader renders what of a file decides the packages it belongs to
+// and what they import: build constraints, package clause and imports
+func fileHeader(file *ast.File) string {
+	var b strings.Builder
+	for _, group := range file.Comments {
+		if group.Pos() >= file.Package {
+			break
+		}
+		b.WriteString(group.Text())
+	}
+	b.WriteString("package " + file.Name.Name + "\n")
+	for _, spec := range file.Imports {
+		if spec.Name != nil {
+			b.WriteString(spec.Name.Name + " ")
+		}
+		b.WriteString(spec.Path.Value + "\n")
+	}
+	return b.String()
+}
+
+// workspaceSources lists the directories and files the go command
+// considers when loading root/..., skipping nested modules and directories
+// it ignores
+func workspaceSources(root string) []string {
+	var paths []string
+
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if d.IsDir() {
+			name := d.Name()
+			if path != root {
+				if name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+					return filepath.SkipDir
+				}
+				if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+					return filepath.SkipDir
+				}
+			}
+			paths = append(paths, path)
+			return nil
+		}
+
+		if strings.HasSuffix(path, ".go") || d.Name() == "go.mod" || d.Name() == "go.sum" || d.Name() == "go.work" {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+
+	return paths
+}
+
+func (ws *workspace) status() IndexStatus {
+	status := IndexStatus{Root: ws.root}
+
+	ws.mu.Lock()
+	status.SyntaxFiles = len(ws.files)
+	if !ws.syntaxRefreshed.IsZero() {
+		status.SyntaxRefreshed = ws.syntaxRefreshed.Format(time.RFC3339)
+	}
+	ws.mu.Unlock()
+
+	ws.typedMu.Lock()
+	defer ws.typedMu.Unlock()
+
+	if ws.typed != nil {
+		status.Packages = len(ws.typed.pkgs)
+		for _, pkg := range ws.typed.pkgs {
+			status.TypedFiles += len(pkg.Syntax)
+		}
+		status.TypedLoaded = ws.typedLoaded.Format(time.RFC3339)
+		status.LoadDuration = ws.loadDuration.String()
+		status.StaleFiles = ws.staleFiles(ws.root)
+	}
+
+	return status
+}
+
+func indexStatus(dir string) ([]IndexStatus, error) {
+	if dir == "" {
+		var statuses []IndexStatus
+		for _, ws := range workspaces.all() {
+			statuses = append(statuses, ws.status())
+		}
+		return statuses, nil
+	}
+
+	ws, _, err := workspaces.forDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return []IndexStatus{ws.status()}, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"go/ast"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeModule writes files, keyed by slash-separated path, into a new
+// module rooted at a temporary directory and returns its resolved path. A
+// go.mod is added unless files has one.
+func writeModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := files["go.mod"]; !ok {
+		files["go.mod"] = "module example.com/m\n\ngo 1.21\n"
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// touch rewrites path with content and moves its mtime forward, so that
+// the change is seen even on filesystems with coarse timestamps
+func touch(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func funcNames(file *ast.File) []string {
+	var names []string
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			names = append(names, fn.Name.Name)
+		}
+	}
+	return names
+}
+
+func TestWalkGoFilesFollowsSymlinks(t *testing.T) {
+	target := writeModule(t, map[string]string{"a.go": "package a\n\nfunc Before() {}\n"})
+	root := writeModule(t, map[string]string{})
+	if err := os.Symlink(filepath.Join(target, "a.go"), filepath.Join(root, "a.go")); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+
+	walk := func() []string {
+		var names []string
+		err := walkGoFiles(context.Background(), root, func(path string, src []byte, file *ast.File, fset *token.FileSet) error {
+			names = append(names, funcNames(file)...)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("walkGoFiles() error = %v", err)
+		}
+		return names
+	}
+
+	if got := walk(); strings.Join(got, ",") != "Before" {
+		t.Fatalf("first walk found %v, want [Before]", got)
+	}
+	touch(t, filepath.Join(target, "a.go"), "package a\n\nfunc After() {}\n")
+	if got := walk(); strings.Join(got, ",") != "After" {
+		t.Errorf("walk after editing the symlink's target found %v, want [After]", got)
+	}
+}
+
+func TestParsedFileFileSet(t *testing.T) {
+	root := writeModule(t, map[string]string{"a.go": "package a\n"})
+	path := filepath.Join(root, "a.go")
+	ws, _, err := workspaces.forDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		touch(t, path, "package a\n\nfunc F() {}\n"+strings.Repeat("\n", i))
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cached, err := ws.parsedFile(path, info)
+		if err != nil {
+			t.Fatalf("parsedFile() error = %v", err)
+		}
+		// A FileSet holding only this file ends one past it
+		if want := int(info.Size()) + 2; cached.fset.Base() != want {
+			t.Errorf("reparse %d: FileSet base = %d, want %d", i, cached.fset.Base(), want)
+		}
+	}
+}
+
+func TestLoadCancelled(t *testing.T) {
+	root := writeModule(t, map[string]string{"a.go": "package a\n"})
+	ws, _, err := workspaces.forDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ws.load(ctx, root); err == nil {
+		t.Fatalf("load() with a cancelled context succeeded")
+	}
+	if ws.typed != nil {
+		t.Errorf("a cancelled load left typed state behind")
+	}
+
+	state, err := ws.load(context.Background(), root)
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	if len(state.pkgs) != 1 {
+		t.Errorf("load() found %d packages, want 1", len(state.pkgs))
+	}
+}
+
+func TestRecheck(t *testing.T) {
+	root := writeModule(t, map[string]string{
+		"a/a.go": "package a\n\nfunc A() int { return 1 }\n",
+		"b/b.go": "package b\n\nimport \"example.com/m/a\"\n\nvar B = a.A()\n",
+	})
+	ws, _, err := workspaces.forDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := ws.load(context.Background(), root)
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+
+	// A body edit rechecks a and its importer b without a full load
+	touch(t, filepath.Join(root, "a/a.go"), "package a\n\nfunc A() int { return 2 }\n")
+	loaded := ws.typedLoaded
+	duration := ws.loadDuration
+	second, err := ws.load(context.Background(), root)
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	if second.generation != first.generation+1 || ws.loadDuration != duration || !ws.typedLoaded.After(loaded) {
+		t.Errorf("body edit was not rechecked incrementally")
+	}
+	if got := string(second.sources[filepath.Join(root, "a/a.go")]); !strings.Contains(got, "return 2") {
+		t.Errorf("rechecked source = %q, want the edit", got)
+	}
+
+	// An import change needs the package graph again
+	if _, ok := ws.recheck([]string{filepath.Join(root, "go.mod")}); ok {
+		t.Errorf("recheck() accepted a change to go.mod")
+	}
+	touch(t, filepath.Join(root, "a/a.go"), "package a\n\nimport \"fmt\"\n\nfunc A() int { fmt.Println(); return 3 }\n")
+	if _, ok := ws.recheck(ws.staleFiles(root)); ok {
+		t.Errorf("recheck() accepted an import change")
+	}
+}